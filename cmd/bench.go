@@ -2,6 +2,7 @@
 package cmd
 
 import (
+	"fmt"
 	"net"
 
 	"github.com/pkg/errors"
@@ -30,11 +31,11 @@ functions and configured the provider.`,
 
 		var bench srk.Benchmark
 		benchArgs := srk.BenchArgs{
-			benchCmdConfig.functionName,
-			benchCmdConfig.functionArgs,
-			benchCmdConfig.benchParams,
-			benchCmdConfig.trackingUrl,
-			benchCmdConfig.logFile,
+			FName:       benchCmdConfig.functionName,
+			FArgs:       benchCmdConfig.functionArgs,
+			BParams:     benchCmdConfig.benchParams,
+			TrackingUrl: benchCmdConfig.trackingUrl,
+			Output:      benchCmdConfig.logFile,
 		}
 
 		switch benchCmdConfig.benchName {
@@ -46,8 +47,25 @@ functions and configured the provider.`,
 				return errors.Wrap(err, "Failed to initialize OneShot benchmark")
 			}
 
+		case "mix":
+			var err error
+			benchLogger := srkManager.Logger.WithField("module", "benchmark.mix")
+			bench, err = cfbench.NewMix(benchLogger)
+			if err != nil {
+				return errors.Wrap(err, "Failed to initialize Mix benchmark")
+			}
+
 		case "concurrency-scan":
-			return errors.New("Concurrency scan not implemented yet")
+			var err error
+			benchLogger := srkManager.Logger.WithField("module", "benchmark.concurrency-scan")
+			bench, err = cfbench.NewConcurrencySweep(benchLogger)
+			if err != nil {
+				return errors.Wrap(err, "Failed to initialize ConcurrencySweep benchmark")
+			}
+			if benchArgs.TrackingUrl == "" {
+				benchArgs.TrackingUrl = fmt.Sprintf("http://%s:3000/", getLocalIp())
+			}
+
 		default:
 			return errors.New("Unrecognized benchmark: " + benchCmdConfig.benchName)
 		}
@@ -55,35 +73,6 @@ functions and configured the provider.`,
 		if err := bench.RunBench(srkManager.Provider, &benchArgs); err != nil {
 			return err
 		}
-		//Parse the benchmark args
-		// XXX this is here as documentation for when we get around to implementing concurrency-sweep
-		// var scanArgs cfbench.ConcurrencySweepArgs
-		// if err := json.Unmarshal([]byte(benchCmdConfig.benchParams), &scanArgs); err != nil {
-		// 	panic(err)
-		// }
-		//
-		// var functionArgsData map[string]interface{}
-		// if err := json.Unmarshal([]byte(benchCmdConfig.functionArgs), &functionArgsData); err != nil {
-		// 	panic(err)
-		// }
-		//
-		// if benchCmdConfig.trackingUrl == "" {
-		// 	ip := getLocalIp()
-		// 	benchCmdConfig.trackingUrl = fmt.Sprintf("http://%s:3000/", ip)
-		// }
-		// log.Printf("using tracking url %s", benchCmdConfig.trackingUrl)
-		//
-		// switch benchCmdConfig.mode {
-		// case "concurrency_scan":
-		// 	transitions := cfbench.GenSweepTransitions(scanArgs)
-		// 	cfbench.ConcurrencySweep(benchCmdConfig.functionName,
-		// 		functionArgsData,
-		// 		transitions,
-		// 		benchCmdConfig.trackingUrl,
-		// 		benchCmdConfig.logFile)
-		// default:
-		// 	panic("unknown mode")
-		// }
 		return nil
 	},
 }
@@ -91,11 +80,11 @@ functions and configured the provider.`,
 func init() {
 	rootCmd.AddCommand(benchCmd)
 
-	benchCmd.Flags().StringVarP(&benchCmdConfig.benchName, "benchmark", "b", "", "Which benchmark to run")
+	benchCmd.Flags().StringVarP(&benchCmdConfig.benchName, "benchmark", "b", "", "Which benchmark to run (one-shot, mix, concurrency-scan)")
 	benchCmd.Flags().StringVarP(&benchCmdConfig.functionName, "function-name", "n", "", "The function to run")
-	benchCmd.Flags().StringVarP(&benchCmdConfig.functionArgs, "function-args", "a", "{}", "Arguments to the function")
+	benchCmd.Flags().StringVarP(&benchCmdConfig.functionArgs, "function-args", "a", "{}", "Arguments to the function (a template rendered for every invocation)")
 	benchCmd.Flags().StringVarP(&benchCmdConfig.benchParams, "params", "p", "{}", "Parameters for the benchmark")
-	benchCmd.Flags().StringVarP(&benchCmdConfig.trackingUrl, "trackingUrl", "u", "", "URL for posting responses")
+	benchCmd.Flags().StringVarP(&benchCmdConfig.trackingUrl, "trackingUrl", "u", "", "URL for posting responses (concurrency-scan, default: port 3000 of a local address)")
 	benchCmd.Flags().StringVarP(&benchCmdConfig.logFile, "output", "o", "", "Output File")
 }
 
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/serverlessresearch/srk/pkg/srkmgr"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A function service whose functions report to the tracking URL like
+// functions using the cfbench library do
+type trackedService struct {
+	m           sync.Mutex
+	invocations int
+}
+
+func (s *trackedService) Package(rawDir string) (string, error) { return rawDir, nil }
+func (s *trackedService) Install(rawDir string, env map[string]string, runtime string) error {
+	return nil
+}
+func (s *trackedService) Remove(fName string) error                        { return nil }
+func (s *trackedService) List() ([]srk.FunctionInfo, error)                { return nil, nil }
+func (s *trackedService) Describe(fName string) (*srk.FunctionInfo, error) { return nil, nil }
+func (s *trackedService) Destroy()                                         {}
+func (s *trackedService) ReportStats() (map[string]float64, error) {
+	return nil, nil
+}
+func (s *trackedService) ResetStats() error { return nil }
+
+func (s *trackedService) Invoke(fName string, args string) (*srk.InvokeResult, error) {
+	s.m.Lock()
+	s.invocations++
+	s.m.Unlock()
+
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &event); err != nil {
+		return nil, err
+	}
+	base := strings.TrimRight(event["tracking_url"].(string), "/") + "/"
+	report := func(path string, action string) error {
+		body := fmt.Sprintf(`{"action": %q, "uuid": %q}`, action, event["uuid"])
+		resp, err := http.Post(base+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	for _, step := range [][2]string{{"event", "begin"}, {"event", "end"}, {"data", "report"}} {
+		if err := report(step[0], step[1]); err != nil {
+			return nil, err
+		}
+	}
+	return &srk.InvokeResult{Body: []byte(`{}`)}, nil
+}
+
+func runBench(t *testing.T, flags ...string) error {
+	benchCmd.Flags().VisitAll(func(flag *pflag.Flag) { flag.Value.Set(flag.DefValue) })
+	require.Nil(t, benchCmd.Flags().Parse(flags))
+	return benchCmd.RunE(benchCmd, nil)
+}
+
+func TestBenchConcurrencyScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-bench")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "sweep.log")
+
+	// a free port for the experiment server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	service := &trackedService{}
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	srkManager = &srkmgr.SrkManager{Provider: &srk.Provider{Faas: service}, Logger: logger}
+	defer func() { srkManager = nil }()
+
+	err = runBench(t, "--benchmark", "concurrency-scan", "--function-name", "sleep",
+		"--params", `{"shape": "exponential", "begin_concurrency": 1, "num_steps": 2, "step_duration": 1}`,
+		"--trackingUrl", fmt.Sprintf("http://127.0.0.1:%d/", port), "--output", output)
+	require.Nil(t, err)
+
+	raw, err := ioutil.ReadFile(output)
+	require.Nil(t, err)
+	assert.NotZero(t, service.invocations)
+	assert.Equal(t, service.invocations, strings.Count(string(raw), `"action": "end"`))
+	assert.Equal(t, service.invocations, strings.Count(string(raw), `"action": "report"`))
+
+	// invalid shapes are rejected before anything is invoked
+	err = runBench(t, "--benchmark", "concurrency-scan", "--function-name", "sleep",
+		"--params", `{"num_steps": -1, "step_duration": 1}`,
+		"--trackingUrl", fmt.Sprintf("http://127.0.0.1:%d/", port), "--output", output)
+	assert.NotNil(t, err)
+}
@@ -20,6 +20,12 @@ var cleanCmd = &cobra.Command{
 		var cleanGlob string
 		if cleanName != "" {
 			cleanGlob = srkManager.GetRawPath(cleanName) + "*"
+			if matches, _ := filepath.Glob(cleanGlob); len(matches) == 0 {
+				if info, err := srkManager.Provider.Faas.Describe(cleanName); err == nil && info != nil {
+					return errors.Errorf("Function %s has no local files, use \"remove\" to remove it from the service", cleanName)
+				}
+				return errors.Errorf("Function %s not found", cleanName)
+			}
 		} else {
 			cleanGlob = filepath.Join(srkManager.Cfg.GetString("buildDir"), "functions", "*")
 		}
@@ -27,6 +33,9 @@ var cleanCmd = &cobra.Command{
 		if err := srkManager.CleanDirectory(cleanGlob); err != nil {
 			return errors.Wrap(err, "Failed to clean function")
 		}
+		if err := srkManager.RecordClean(cleanName); err != nil {
+			srkManager.Logger.Warnf("Failed to update the function index: %v", err)
+		}
 
 		srkManager.Logger.Info("Successfully cleaned function")
 		return nil
@@ -12,12 +12,15 @@ import (
 )
 
 var createCmdConfig struct {
-	source  string
-	include []string
-	files   []string
-	name    string
-	env     map[string]string
-	runtime string
+	source   string
+	include  []string
+	files    []string
+	name     string
+	env      map[string]string
+	runtime  string
+	settings []string
+	publish  bool
+	alias    string
 }
 
 var createCmd = &cobra.Command{
@@ -48,6 +51,10 @@ function package" and "srk function install".`,
 		}
 		srkManager.Logger.Info("Created raw function: " + rawDir)
 
+		if err := setFunctionSettings(funcName, createCmdConfig.settings); err != nil {
+			return err
+		}
+
 		pkgPath, err := srkManager.Provider.Faas.Package(rawDir)
 		if err != nil {
 			return errors.Wrap(err, "Packaging failed")
@@ -58,7 +65,9 @@ function package" and "srk function install".`,
 			return errors.Wrap(err, "Installation failed")
 		}
 		srkManager.Logger.Info("Successfully installed function")
-		return nil
+		recordInstall(funcName, createCmdConfig.runtime)
+
+		return publishFunction(funcName, createCmdConfig.publish, createCmdConfig.alias)
 	},
 }
 
@@ -71,6 +80,9 @@ func init() {
 	createCmd.Flags().StringSliceVarP(&createCmdConfig.files, "files", "f", []string{}, "additional files to include")
 	createCmd.Flags().StringToStringVarP(&createCmdConfig.env, "env", "e", make(map[string]string), "list of environment vars to set for function execution: var1=value1,var2=value2")
 	createCmd.Flags().StringVarP(&createCmdConfig.runtime, "runtime", "r", "", "runtime to use for function execution")
+	createCmd.Flags().StringArrayVar(&createCmdConfig.settings, "set", []string{}, "service specific function setting KEY=VALUE, e.g. memory=1024 (can be repeated)")
+	createCmd.Flags().BoolVar(&createCmdConfig.publish, "publish", false, "publish a new version of the function")
+	createCmd.Flags().StringVarP(&createCmdConfig.alias, "alias", "a", "", "alias to point to the published version, invoke it as NAME:ALIAS")
 	// The actual default is derived from the source option, so we set it
 	// something that will be clear in the help output until we have all the
 	// options parsed
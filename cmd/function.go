@@ -4,6 +4,10 @@
 package cmd
 
 import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
 	"github.com/spf13/cobra"
 )
 
@@ -17,3 +21,24 @@ var functionCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(functionCmd)
 }
+
+// Pass settings given as KEY=VALUE on the command line to the FaaS service
+func setFunctionSettings(fName string, rawSettings []string) error {
+	if len(rawSettings) == 0 {
+		return nil
+	}
+	service, ok := srkManager.Provider.Faas.(srk.SettingsService)
+	if !ok {
+		return errors.New("The configured FaaS service does not support function settings")
+	}
+
+	settings := make(map[string]string)
+	for _, setting := range rawSettings {
+		kv := strings.SplitN(setting, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return errors.Errorf("Setting '%s' must have the form KEY=VALUE", setting)
+		}
+		settings[kv[0]] = kv[1]
+	}
+	return service.SetFunctionSettings(fName, settings)
+}
@@ -8,9 +8,12 @@ import (
 )
 
 var installCmdConfig struct {
-	name    string
-	env     map[string]string
-	runtime string
+	name     string
+	env      map[string]string
+	runtime  string
+	settings []string
+	publish  bool
+	alias    string
 }
 
 // installCmd represents the install command
@@ -24,18 +27,46 @@ var installCmd = &cobra.Command{
 		runtime := installCmdConfig.runtime
 		rawDir := srkManager.GetRawPath(installCmdConfig.name)
 
+		if err := setFunctionSettings(installCmdConfig.name, installCmdConfig.settings); err != nil {
+			return err
+		}
+		warnIfStale(installCmdConfig.name)
+
 		if err := srkManager.Provider.Faas.Install(rawDir, env, runtime); err != nil {
 			return errors.Wrap(err, "Installation failed")
 		}
 		srkManager.Logger.Info("Successfully installed function")
-		return nil
+		recordInstall(installCmdConfig.name, runtime)
+
+		return publishFunction(installCmdConfig.name, installCmdConfig.publish, installCmdConfig.alias)
 	},
 }
 
+// Warn if the sources of a function changed since it was packaged
+func warnIfStale(name string) {
+	stale, err := srkManager.PackageStale(name)
+	if err != nil {
+		srkManager.Logger.Warnf("Failed to check if function %s is up to date: %v", name, err)
+	} else if stale {
+		srkManager.Logger.Warnf("The sources of function %s changed since it was packaged, run 'srk function package' to update it", name)
+	}
+}
+
+// Add an install to the function index. The function is installed already,
+// so failures are only reported.
+func recordInstall(name string, runtime string) {
+	if err := srkManager.RecordInstall(name, runtime); err != nil {
+		srkManager.Logger.Warnf("Failed to record install of function %s: %v", name, err)
+	}
+}
+
 func init() {
 	functionCmd.AddCommand(installCmd)
 
 	installCmd.Flags().StringVarP(&installCmdConfig.name, "function-name", "n", "", "The function to install")
 	installCmd.Flags().StringToStringVarP(&installCmdConfig.env, "env", "e", make(map[string]string), "list of environment vars to set for function execution: var1=value1,var2=value2")
 	installCmd.Flags().StringVarP(&installCmdConfig.runtime, "runtime", "r", "", "runtime to use for function execution")
+	installCmd.Flags().StringArrayVar(&installCmdConfig.settings, "set", []string{}, "service specific function setting KEY=VALUE, e.g. memory=1024 (can be repeated)")
+	installCmd.Flags().BoolVar(&installCmdConfig.publish, "publish", false, "publish a new version of the function")
+	installCmd.Flags().StringVarP(&installCmdConfig.alias, "alias", "a", "", "alias to point to the published version, invoke it as NAME:ALIAS")
 }
@@ -0,0 +1,181 @@
+// Handles the "srk function invoke" command. Calls an installed function and
+// prints its response, without the statistics of a benchmark.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/spf13/cobra"
+)
+
+var invokeCmdConfig struct {
+	name     string
+	args     string
+	argsFile string
+	repeat   int
+	async    bool
+	output   string
+	metadata bool
+}
+
+// Information about an invocation printed with --metadata. Times are in
+// microseconds.
+type invocationRecord struct {
+	Seq           int               `json:"seq"`
+	Status        int               `json:"status"`
+	FunctionError bool              `json:"functionError"`
+	Error         string            `json:"error,omitempty"`
+	ErrorKind     string            `json:"errorKind,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	ConnectTime   int64             `json:"connectTime"`
+	FirstByteTime int64             `json:"firstByteTime"`
+	TotalTime     int64             `json:"totalTime"`
+	Response      string            `json:"response"`
+}
+
+var invokeCmd = &cobra.Command{
+	Use:   "invoke",
+	Short: "Invoke a function",
+	Long: `Invokes an installed function and prints its response. The arguments are
+given with --function-args or read from a file (--args-file, '-' reads them
+from stdin). With --repeat, the function is invoked several times in a row and
+every response is printed on its own line. --metadata prints a JSON object with
+the status, timing and service-specific information of every invocation
+instead of the bare response.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fArgs, err := invokeArgs(cmd.Flags().Changed("function-args"))
+		if err != nil {
+			return err
+		}
+		if invokeCmdConfig.repeat < 1 {
+			return errors.New("--repeat must be at least 1")
+		}
+
+		invoke := srkManager.Provider.Faas.Invoke
+		if invokeCmdConfig.async {
+			async, ok := srkManager.Provider.Faas.(srk.AsyncService)
+			if !ok {
+				return errors.New("The configured FaaS service does not support asynchronous invocations")
+			}
+			invoke = async.InvokeAsync
+		}
+
+		var out io.Writer = os.Stdout
+		if invokeCmdConfig.output != "" {
+			f, err := os.Create(invokeCmdConfig.output)
+			if err != nil {
+				return errors.Wrap(err, "Failed to create output file")
+			}
+			defer f.Close()
+			out = f
+		}
+
+		var lastErr error
+		failed := 0
+		for seq := 1; seq <= invokeCmdConfig.repeat; seq++ {
+			resp, err := invoke(invokeCmdConfig.name, fArgs)
+			if err != nil {
+				lastErr = err
+				failed++
+				if invokeCmdConfig.repeat > 1 && !invokeCmdConfig.metadata {
+					srkManager.Logger.Errorf("Invocation %d failed: %v", seq, err)
+				}
+			}
+
+			if resp != nil && len(resp.Body) > 0 && (invokeCmdConfig.output != "" || !invokeCmdConfig.metadata) {
+				if err := writeResponse(out, resp.Body); err != nil {
+					return errors.Wrap(err, "Failed to write response")
+				}
+			}
+			if invokeCmdConfig.metadata {
+				record, err := json.Marshal(newInvocationRecord(seq, resp, err))
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(record))
+			}
+		}
+
+		if invokeCmdConfig.repeat == 1 && lastErr != nil {
+			return errors.Wrap(lastErr, "Invocation failed")
+		}
+		if failed > 0 {
+			return errors.Errorf("%d of %d invocations failed", failed, invokeCmdConfig.repeat)
+		}
+		return nil
+	},
+}
+
+// The arguments of the invocations, "{}" if none are given
+func invokeArgs(argsFlagSet bool) (string, error) {
+	if invokeCmdConfig.argsFile == "" {
+		return invokeCmdConfig.args, nil
+	}
+	if argsFlagSet {
+		return "", errors.New("Use either --function-args or --args-file")
+	}
+
+	var data []byte
+	var err error
+	if invokeCmdConfig.argsFile == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(invokeCmdConfig.argsFile)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to read function arguments")
+	}
+	return string(data), nil
+}
+
+// Write a response on its own line
+func writeResponse(out io.Writer, body []byte) error {
+	if _, err := out.Write(body); err != nil {
+		return err
+	}
+	if body[len(body)-1] != '\n' {
+		_, err := fmt.Fprintln(out)
+		return err
+	}
+	return nil
+}
+
+func newInvocationRecord(seq int, resp *srk.InvokeResult, err error) *invocationRecord {
+	record := &invocationRecord{Seq: seq}
+	if err != nil {
+		record.Error = err.Error()
+		if kind := srk.KindOf(err); kind != srk.ErrUnknown {
+			record.ErrorKind = kind.String()
+		}
+	}
+	if resp != nil {
+		record.Status = resp.Status
+		record.FunctionError = resp.FunctionError
+		record.Metadata = resp.Metadata
+		record.ConnectTime = resp.Timing.Connect.Microseconds()
+		record.FirstByteTime = resp.Timing.FirstByte.Microseconds()
+		record.TotalTime = resp.Timing.Total.Microseconds()
+		record.Response = resp.String()
+	}
+	return record
+}
+
+func init() {
+	functionCmd.AddCommand(invokeCmd)
+
+	invokeCmd.Flags().StringVarP(&invokeCmdConfig.name, "function-name", "n", "", "name of the function")
+	invokeCmd.Flags().StringVarP(&invokeCmdConfig.args, "function-args", "a", "{}", "arguments to the function (JSON)")
+	invokeCmd.Flags().StringVarP(&invokeCmdConfig.argsFile, "args-file", "f", "", "read the arguments from a file ('-' for stdin)")
+	invokeCmd.Flags().IntVarP(&invokeCmdConfig.repeat, "repeat", "r", 1, "number of invocations")
+	invokeCmd.Flags().BoolVar(&invokeCmdConfig.async, "async", false, "queue the invocations without waiting for the function")
+	invokeCmd.Flags().StringVarP(&invokeCmdConfig.output, "output", "o", "", "write the responses to a file instead of stdout")
+	invokeCmd.Flags().BoolVarP(&invokeCmdConfig.metadata, "metadata", "m", false, "print the status, timing and metadata of every invocation as JSON")
+	invokeCmd.MarkFlagRequired("function-name")
+}
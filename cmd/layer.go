@@ -0,0 +1,210 @@
+// Handles the "srk layer" commands. Layers are versioned sets of files (e.g.
+// libraries or a custom runtime) that the runtimes of a FaaS service are
+// built from.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/spf13/cobra"
+)
+
+var layerCmdConfig struct {
+	name    string
+	source  string
+	runtime string
+	version int
+}
+
+// layerCmd represents the layer command
+var layerCmd = &cobra.Command{
+	Use:   "layer",
+	Short: "Manage runtime layers",
+	Long: `Commands for dealing with the layers that make up the runtimes of your
+configured FaaS provider.`,
+}
+
+var layerCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a new version of a layer",
+	Long: `Packages a directory into a new version of a layer. If a runtime is given,
+the runtime is updated to use the new version (it replaces any other version of
+the layer or is added as the last layer). Runtime layers set by srk are kept in
+runtime-layers.yaml next to the configuration file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		layers, err := layerService()
+		if err != nil {
+			return err
+		}
+
+		source, err := filepath.Abs(layerCmdConfig.source)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(source); err != nil || !info.IsDir() {
+			return errors.Errorf("layer source %s is not a directory", source)
+		}
+
+		// remember the old versions before the new one shows up
+		var oldRefs map[string]bool
+		if layerCmdConfig.runtime != "" {
+			oldRefs, err = layerRefs(layers, layerCmdConfig.name, 0)
+			if err != nil {
+				return err
+			}
+		}
+
+		layer, err := layers.CreateLayer(layerCmdConfig.name, source)
+		if err != nil {
+			return errors.Wrap(err, "Layer creation failed")
+		}
+		srkManager.Logger.Infof("Created layer %s version %d: %s", layer.Name, layer.Version, layer.Ref)
+
+		if layerCmdConfig.runtime != "" {
+			var runtimeLayers []string
+			replaced := false
+			for _, ref := range srkManager.RuntimeLayers(layerCmdConfig.runtime) {
+				if oldRefs[ref] {
+					if replaced {
+						continue
+					}
+					ref = layer.Ref
+					replaced = true
+				}
+				runtimeLayers = append(runtimeLayers, ref)
+			}
+			if !replaced {
+				runtimeLayers = append(runtimeLayers, layer.Ref)
+			}
+
+			if err := srkManager.SetRuntimeLayers(layerCmdConfig.runtime, runtimeLayers); err != nil {
+				return err
+			}
+			srkManager.Logger.Infof("Runtime %s now uses layers %v", layerCmdConfig.runtime, runtimeLayers)
+		}
+		return nil
+	},
+}
+
+var layerListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all layers",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		layers, err := layerService()
+		if err != nil {
+			return err
+		}
+
+		list, err := layers.ListLayers()
+		if err != nil {
+			return errors.Wrap(err, "Listing layers failed")
+		}
+
+		// runtimes that use each layer version
+		usedBy := make(map[string][]string)
+		for _, runtime := range srkManager.Runtimes() {
+			for _, ref := range srkManager.RuntimeLayers(runtime) {
+				usedBy[ref] = append(usedBy[ref], runtime)
+			}
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tVERSION\tRUNTIMES\tREF")
+		for _, layer := range list {
+			fmt.Fprintf(w, "%s\t%d\t%v\t%s\n", layer.Name, layer.Version, usedBy[layer.Ref], layer.Ref)
+		}
+		return w.Flush()
+	},
+}
+
+var layerRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove a version of a layer",
+	Long: `Removes a version of a layer from the FaaS provider. The layer version is
+also removed from all runtimes that use it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		layers, err := layerService()
+		if err != nil {
+			return err
+		}
+
+		refs, err := layerRefs(layers, layerCmdConfig.name, layerCmdConfig.version)
+		if err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			return errors.Errorf("Layer %s version %d does not exist", layerCmdConfig.name, layerCmdConfig.version)
+		}
+
+		if err := layers.RemoveLayer(layerCmdConfig.name, layerCmdConfig.version); err != nil {
+			return errors.Wrap(err, "Layer removal failed")
+		}
+		srkManager.Logger.Infof("Removed layer %s version %d", layerCmdConfig.name, layerCmdConfig.version)
+
+		for _, runtime := range srkManager.Runtimes() {
+			var runtimeLayers []string
+			for _, ref := range srkManager.RuntimeLayers(runtime) {
+				if !refs[ref] {
+					runtimeLayers = append(runtimeLayers, ref)
+				}
+			}
+			if len(runtimeLayers) == len(srkManager.RuntimeLayers(runtime)) {
+				continue
+			}
+			if err := srkManager.SetRuntimeLayers(runtime, runtimeLayers); err != nil {
+				return err
+			}
+			srkManager.Logger.Infof("Removed layer from runtime %s", runtime)
+		}
+		return nil
+	},
+}
+
+// The layer interface of the configured FaaS service
+func layerService() (srk.LayerService, error) {
+	layers, ok := srkManager.Provider.Faas.(srk.LayerService)
+	if !ok {
+		return nil, errors.New("The configured FaaS service does not support layers")
+	}
+	return layers, nil
+}
+
+// References to the versions of a layer (all versions if version is 0)
+func layerRefs(layers srk.LayerService, name string, version int) (map[string]bool, error) {
+	list, err := layers.ListLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "Listing layers failed")
+	}
+
+	refs := make(map[string]bool)
+	for _, layer := range list {
+		if layer.Name == name && (version == 0 || layer.Version == version) {
+			refs[layer.Ref] = true
+		}
+	}
+	return refs, nil
+}
+
+func init() {
+	rootCmd.AddCommand(layerCmd)
+	layerCmd.AddCommand(layerCreateCmd)
+	layerCmd.AddCommand(layerListCmd)
+	layerCmd.AddCommand(layerRemoveCmd)
+
+	layerCreateCmd.Flags().StringVarP(&layerCmdConfig.name, "layer-name", "n", "", "name of the layer")
+	layerCreateCmd.Flags().StringVarP(&layerCmdConfig.source, "source", "s", "", "directory with the contents of the layer")
+	layerCreateCmd.Flags().StringVarP(&layerCmdConfig.runtime, "runtime", "r", "", "optional runtime to update to the new layer version")
+	layerCreateCmd.MarkFlagRequired("layer-name")
+	layerCreateCmd.MarkFlagRequired("source")
+
+	layerRemoveCmd.Flags().StringVarP(&layerCmdConfig.name, "layer-name", "n", "", "name of the layer")
+	layerRemoveCmd.Flags().IntVarP(&layerCmdConfig.version, "version", "v", 0, "version of the layer to remove")
+	layerRemoveCmd.MarkFlagRequired("layer-name")
+	layerRemoveCmd.MarkFlagRequired("version")
+}
@@ -0,0 +1,171 @@
+// Handles the "srk function list" and "srk function describe" commands. They
+// show what is installed to the configured FaaS service (or, with --local,
+// what the function index of the build directory records).
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Format of install times
+const installTimeFormat = "2006-01-02T15:04:05Z07:00"
+
+var describeName string
+
+var listLocal bool
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the functions installed to the service",
+	Long: `Lists the functions installed to the configured FaaS service with their
+runtime, the time of the last install and the hash of the installed code. Use
+"describe" to see the environment and configuration of a function. With
+--local, the functions created by SRK are listed instead, with the providers
+they were installed to and whether their sources changed since packaging.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if listLocal {
+			return listIndex()
+		}
+
+		functions, err := srkManager.Provider.Faas.List()
+		if err != nil {
+			return errors.Wrap(err, "Listing functions failed")
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tRUNTIME\tINSTALLED\tCODE HASH")
+		for _, f := range functions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Name, orDash(f.Runtime), formatInstallTime(f.InstallTime), orDash(f.CodeHash))
+		}
+		return w.Flush()
+	},
+}
+
+// Print the function index
+func listIndex() error {
+	records, err := srkManager.Functions()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE\tPACKAGED\tSTATE\tINSTALLED TO")
+	for _, record := range records {
+		state := "-"
+		if record.PackageHash != "" {
+			stale, err := srkManager.PackageStale(record.Name)
+			switch {
+			case err != nil:
+				srkManager.Logger.Warnf("Failed to check if function %s is up to date: %v", record.Name, err)
+				state = "unknown"
+			case stale:
+				state = "stale"
+			default:
+				state = "current"
+			}
+		}
+
+		providers := make([]string, 0, len(record.Installs))
+		for provider := range record.Installs {
+			providers = append(providers, provider)
+		}
+		sort.Strings(providers)
+
+		packaged := "-"
+		if record.PackageHash != "" {
+			packaged = formatInstallTime(record.PackageTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", record.Name, orDash(record.Source), packaged, state, orDash(strings.Join(providers, ",")))
+	}
+	return w.Flush()
+}
+
+var describeCmd = &cobra.Command{
+	Use:   "describe",
+	Short: "Describe a function installed to the service",
+	Long: `Prints what the configured FaaS service knows about an installed function:
+its runtime, install time, code hash, environment and service-specific
+configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info, err := srkManager.Provider.Faas.Describe(describeName)
+		if err != nil {
+			return errors.Wrap(err, "Describing function failed")
+		}
+		if info == nil {
+			return errors.Errorf("Function %s is not installed", describeName)
+		}
+
+		fmt.Printf("Name: %s\n", info.Name)
+		fmt.Printf("Runtime: %s\n", orDash(info.Runtime))
+		fmt.Printf("Installed: %s\n", formatInstallTime(info.InstallTime))
+		fmt.Printf("Code hash: %s\n", orDash(info.CodeHash))
+		printMap("Environment", info.Env)
+		printMap("Configuration", info.Config)
+		return nil
+	},
+}
+
+// Check that a function is installed before changing it. Services that fail
+// to describe the function get the benefit of the doubt.
+func checkInstalled(fName string) error {
+	info, err := srkManager.Provider.Faas.Describe(fName)
+	if err != nil {
+		srkManager.Logger.Warnf("Failed to check if function %s is installed: %v", fName, err)
+		return nil
+	}
+	if info == nil {
+		return errors.Errorf("Function %s is not installed", fName)
+	}
+	return nil
+}
+
+func formatInstallTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(installTimeFormat)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Print a map as indented "key: value" lines, ordered by key
+func printMap(title string, m map[string]string) {
+	if len(m) == 0 {
+		fmt.Printf("%s: -\n", title)
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("%s:\n", title)
+	for _, k := range keys {
+		fmt.Printf("  %s: %s\n", k, m[k])
+	}
+}
+
+func init() {
+	functionCmd.AddCommand(listCmd)
+	functionCmd.AddCommand(describeCmd)
+
+	listCmd.Flags().BoolVar(&listLocal, "local", false, "list the functions created by SRK (from the function index) instead")
+
+	describeCmd.Flags().StringVarP(&describeName, "function-name", "n", "", "name of the function")
+	describeCmd.MarkFlagRequired("function-name")
+}
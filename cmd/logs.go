@@ -0,0 +1,88 @@
+// Handles the "srk function logs" command. Prints what a function logged,
+// e.g. to debug a failing benchmark without logging into the FaaS hosts.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/spf13/cobra"
+)
+
+// Time between two reads of the log with --follow
+const followInterval = time.Second
+
+var logsCmdConfig struct {
+	name   string
+	since  time.Duration
+	follow bool
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Print the log of a function",
+	Long: `Prints the log of a function (everything the function printed and the
+messages of the FaaS service about its invocations). With --follow, new log
+entries are printed as they arrive until the command is interrupted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logs, err := logService()
+		if err != nil {
+			return err
+		}
+
+		var since time.Time
+		if logsCmdConfig.since > 0 {
+			since = time.Now().Add(-logsCmdConfig.since)
+		}
+
+		// entries at the time of the last printed entry that were printed
+		// already, they are read again with the next poll
+		printed := 0
+		for {
+			entries, err := logs.Logs(logsCmdConfig.name, since)
+			if err != nil {
+				return errors.Wrap(err, "Reading the log failed")
+			}
+
+			skip := printed
+			for _, entry := range entries {
+				if entry.Time.Equal(since) && skip > 0 {
+					skip--
+					continue
+				}
+				fmt.Printf("%s %s\n", entry.Time.Format("2006-01-02T15:04:05.000Z07:00"), entry.Message)
+				if entry.Time.Equal(since) {
+					printed++
+				} else if entry.Time.After(since) {
+					since, printed = entry.Time, 1
+				}
+			}
+
+			if !logsCmdConfig.follow {
+				return nil
+			}
+			time.Sleep(followInterval)
+		}
+	},
+}
+
+// The log interface of the configured FaaS service
+func logService() (srk.LogService, error) {
+	logs, ok := srkManager.Provider.Faas.(srk.LogService)
+	if !ok {
+		return nil, errors.New("The configured FaaS service does not support logs")
+	}
+	return logs, nil
+}
+
+func init() {
+	functionCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().StringVarP(&logsCmdConfig.name, "function-name", "n", "", "name of the function")
+	logsCmd.Flags().DurationVar(&logsCmdConfig.since, "since", 0, "only print entries of this period, e.g. 10m (default: the whole log)")
+	logsCmd.Flags().BoolVarP(&logsCmdConfig.follow, "follow", "f", false, "keep printing new log entries")
+	logsCmd.MarkFlagRequired("function-name")
+}
@@ -6,16 +6,32 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var removeName string
+var removeCmdConfig struct {
+	name string
+	all  bool
+}
 
 // removeCmd represents the remove command
 var removeCmd = &cobra.Command{
 	Use:   "remove",
 	Short: "Uninstall (remove) a function from the service provider.",
-	Long:  `Remove will delete a function from the configured provider so that is no longer visible or using resources. If you have installed the function to multiple services, you will need to call "remove" on each service separately. Remove is the inverse of "install", it does not affect packages.`,
+	Long:  `Remove will delete a function from the configured provider so that is no longer visible or using resources. If you have installed the function to multiple services, you will need to call "remove" on each service separately. Remove is the inverse of "install", it does not affect packages. With --all, every function that SRK installed to the configured provider is removed.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := srkManager.Provider.Faas.Remove(removeName); err != nil {
-			return errors.Wrap(err, "Function removal failed")
+		if removeCmdConfig.all {
+			if removeCmdConfig.name != "" {
+				return errors.New("Use either --function-name or --all")
+			}
+			return removeAll()
+		}
+		if removeCmdConfig.name == "" {
+			return errors.New("Required flag \"function-name\" not set (or use --all)")
+		}
+
+		if err := checkInstalled(removeCmdConfig.name); err != nil {
+			return err
+		}
+		if err := removeFunction(removeCmdConfig.name); err != nil {
+			return err
 		}
 
 		srkManager.Logger.Info("Successfully removed function")
@@ -23,9 +39,54 @@ var removeCmd = &cobra.Command{
 	},
 }
 
+// Remove all functions that the function index records as installed to the
+// configured provider
+func removeAll() error {
+	names, err := srkManager.InstalledFunctions()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		srkManager.Logger.Info("No functions installed")
+		return nil
+	}
+
+	failed := 0
+	for _, name := range names {
+		// removed without srk, only the index is updated
+		if info, err := srkManager.Provider.Faas.Describe(name); err == nil && info == nil {
+			srkManager.Logger.Infof("Function %s was removed already", name)
+			if err := srkManager.RecordRemove(name); err != nil {
+				srkManager.Logger.Warnf("Failed to update the function index: %v", err)
+			}
+			continue
+		}
+		if err := removeFunction(name); err != nil {
+			srkManager.Logger.Error(err)
+			failed++
+			continue
+		}
+		srkManager.Logger.Info("Removed function " + name)
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d functions could not be removed", failed, len(names))
+	}
+	return nil
+}
+
+func removeFunction(name string) error {
+	if err := srkManager.Provider.Faas.Remove(name); err != nil {
+		return errors.Wrapf(err, "Removal of function %s failed", name)
+	}
+	if err := srkManager.RecordRemove(name); err != nil {
+		srkManager.Logger.Warnf("Failed to update the function index: %v", err)
+	}
+	return nil
+}
+
 func init() {
 	functionCmd.AddCommand(removeCmd)
 
-	removeCmd.Flags().StringVarP(&removeName, "function-name", "n", "", "The function to remove")
-	removeCmd.MarkFlagRequired("function-name")
+	removeCmd.Flags().StringVarP(&removeCmdConfig.name, "function-name", "n", "", "The function to remove")
+	removeCmd.Flags().BoolVar(&removeCmdConfig.all, "all", false, "remove all functions installed to the configured provider")
 }
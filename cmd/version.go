@@ -0,0 +1,184 @@
+// Handles the "srk function publish" and "srk function alias" commands.
+// Published versions of a function are immutable, aliases point to a version.
+// Both can be invoked as NAME:VERSION or NAME:ALIAS, e.g. to compare two
+// versions of a function in one experiment.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/spf13/cobra"
+)
+
+var versionCmdConfig struct {
+	name    string
+	alias   string
+	version string
+}
+
+var publishCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Publish a new version of a function",
+	Long: `Publishes the installed code and configuration of a function as a new
+version. With --alias the alias is created or pointed to the new version.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return publishFunction(versionCmdConfig.name, true, versionCmdConfig.alias)
+	},
+}
+
+// aliasCmd represents the alias command
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Manage function aliases",
+	Long:  `Commands for dealing with the aliases of the versions of a function.`,
+}
+
+var aliasSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Create an alias or point it to another version",
+	Long: `Creates an alias of a function or points an existing alias to a version
+(the latest published version by default).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		versions, err := versionService()
+		if err != nil {
+			return err
+		}
+		if err := versions.SetAlias(versionCmdConfig.name, versionCmdConfig.alias, versionCmdConfig.version); err != nil {
+			return errors.Wrap(err, "Setting alias failed")
+		}
+		return nil
+	},
+}
+
+var aliasListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the versions and aliases of a function",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		versions, err := versionService()
+		if err != nil {
+			return err
+		}
+
+		list, err := versions.ListVersions(versionCmdConfig.name)
+		if err != nil {
+			return errors.Wrap(err, "Listing versions failed")
+		}
+		aliases, err := versions.ListAliases(versionCmdConfig.name)
+		if err != nil {
+			return errors.Wrap(err, "Listing aliases failed")
+		}
+
+		// aliases of each version
+		aliasesOf := make(map[string][]string)
+		for _, alias := range aliases {
+			aliasesOf[alias.Version] = append(aliasesOf[alias.Version], alias.Name)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tALIASES")
+		for _, version := range list {
+			fmt.Fprintf(w, "%s\t%s\n", version, strings.Join(aliasesOf[version], ","))
+		}
+		// aliases of unpublished code
+		for version, names := range aliasesOf {
+			if !contains(list, version) {
+				fmt.Fprintf(w, "%s\t%s\n", version, strings.Join(names, ","))
+			}
+		}
+		return w.Flush()
+	},
+}
+
+var aliasRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove an alias",
+	Long:  `Removes an alias of a function. The version it points to is kept.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		versions, err := versionService()
+		if err != nil {
+			return err
+		}
+		if err := versions.RemoveAlias(versionCmdConfig.name, versionCmdConfig.alias); err != nil {
+			return errors.Wrap(err, "Alias removal failed")
+		}
+		srkManager.Logger.Infof("Removed alias %s:%s", versionCmdConfig.name, versionCmdConfig.alias)
+		return nil
+	},
+}
+
+// The version interface of the configured FaaS service
+func versionService() (srk.VersionService, error) {
+	versions, ok := srkManager.Provider.Faas.(srk.VersionService)
+	if !ok {
+		return nil, errors.New("The configured FaaS service does not support versions")
+	}
+	return versions, nil
+}
+
+// Publish a new version of an installed function if requested, and point an
+// alias to it (or to the latest published version if nothing is published)
+func publishFunction(fName string, publish bool, alias string) error {
+	if !publish && alias == "" {
+		return nil
+	}
+	versions, err := versionService()
+	if err != nil {
+		return err
+	}
+
+	var version string
+	if publish {
+		if version, err = versions.PublishVersion(fName); err != nil {
+			return errors.Wrap(err, "Publishing failed")
+		}
+		srkManager.Logger.Infof("Published %s version %s", fName, version)
+	}
+	if alias != "" {
+		if err := versions.SetAlias(fName, alias, version); err != nil {
+			return errors.Wrap(err, "Setting alias failed")
+		}
+		srkManager.Logger.Infof("Invoke this version as %s:%s", fName, alias)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	functionCmd.AddCommand(publishCmd)
+	functionCmd.AddCommand(aliasCmd)
+	aliasCmd.AddCommand(aliasSetCmd)
+	aliasCmd.AddCommand(aliasListCmd)
+	aliasCmd.AddCommand(aliasRemoveCmd)
+
+	publishCmd.Flags().StringVarP(&versionCmdConfig.name, "function-name", "n", "", "name of the function")
+	publishCmd.Flags().StringVarP(&versionCmdConfig.alias, "alias", "a", "", "optional alias to point to the new version")
+	publishCmd.MarkFlagRequired("function-name")
+
+	aliasSetCmd.Flags().StringVarP(&versionCmdConfig.name, "function-name", "n", "", "name of the function")
+	aliasSetCmd.Flags().StringVarP(&versionCmdConfig.alias, "alias", "a", "", "name of the alias")
+	aliasSetCmd.Flags().StringVarP(&versionCmdConfig.version, "version", "v", "", "version to point to (default: latest published version)")
+	aliasSetCmd.MarkFlagRequired("function-name")
+	aliasSetCmd.MarkFlagRequired("alias")
+
+	aliasListCmd.Flags().StringVarP(&versionCmdConfig.name, "function-name", "n", "", "name of the function")
+	aliasListCmd.MarkFlagRequired("function-name")
+
+	aliasRemoveCmd.Flags().StringVarP(&versionCmdConfig.name, "function-name", "n", "", "name of the function")
+	aliasRemoveCmd.Flags().StringVarP(&versionCmdConfig.alias, "alias", "a", "", "name of the alias")
+	aliasRemoveCmd.MarkFlagRequired("function-name")
+	aliasRemoveCmd.MarkFlagRequired("alias")
+}
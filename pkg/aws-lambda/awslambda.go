@@ -4,68 +4,167 @@ package awslambda
 
 import (
 	"archive/zip"
-	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/pkg/errors"
 	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 )
 
+// Region used to sign requests to a custom endpoint if no region is configured
+const defaultEmulatorRegion = "us-east-1"
+
+// Defaults for waiting until functions are updated
+const (
+	defaultUpdateTimeout  = 5 * time.Minute
+	defaultUpdateInterval = time.Second
+)
+
 type awsLambdaRuntime struct {
 	base   string
 	layers []string
+	// function settings of the runtime
+	settings map[string]interface{}
 }
 
 type awsLambdaConfig struct {
 	// AWS arn role
-	role string
-	// see configs/srk.yaml for an example
-	vpcConfig      string
-	region         string
+	role   string
+	region string
+	// Lambda API endpoint, e.g. of a local emulator (default: the regional
+	// AWS endpoint)
+	endpoint string
+	// CloudWatch Logs endpoint (default: endpoint if set, else the regional
+	// AWS endpoint)
+	logsEndpoint string
+	// request the tail of the log with every invocation
+	tailLogs bool
+	// credentials overriding the default credential chain
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	profile         string
+	// how long and how often to check whether an update is done
+	updateTimeout  time.Duration
+	updateInterval time.Duration
+	// retries of invocations (instead of the retries of the AWS SDK)
+	retry          *srk.RetryPolicy
 	runtimes       map[string]awsLambdaRuntime
 	defaultRuntime string
-	session        *lambda.Lambda
-	log            srk.Logger
+	// function settings of the service, of functions and from the command line
+	settings  map[string]interface{}
+	functions map[string]map[string]interface{}
+	overrides map[string]map[string]interface{}
+	session   *lambda.Lambda
+	logs      *cloudwatchlogs.CloudWatchLogs
+	log       srk.Logger
 }
 
 func NewConfig(logger srk.Logger, config *viper.Viper) (srk.FunctionService, error) {
 
 	awsCfg := &awsLambdaConfig{
-		role:           config.GetString("role"),
-		vpcConfig:      config.GetString("vpc-config"),
-		region:         config.GetString("region"),
-		runtimes:       make(map[string]awsLambdaRuntime),
-		defaultRuntime: config.GetString("default-runtime"),
-		session:        nil,
-		log:            logger,
+		role:            config.GetString("role"),
+		region:          config.GetString("region"),
+		endpoint:        config.GetString("endpoint"),
+		logsEndpoint:    config.GetString("logs-endpoint"),
+		tailLogs:        config.GetBool("tail-logs"),
+		accessKeyID:     config.GetString("access-key-id"),
+		secretAccessKey: config.GetString("secret-access-key"),
+		sessionToken:    config.GetString("session-token"),
+		profile:         config.GetString("profile"),
+		updateTimeout:   defaultUpdateTimeout,
+		updateInterval:  defaultUpdateInterval,
+		runtimes:        make(map[string]awsLambdaRuntime),
+		defaultRuntime:  config.GetString("default-runtime"),
+		settings:        configSettings(config),
+		functions:       make(map[string]map[string]interface{}),
+		overrides:       make(map[string]map[string]interface{}),
+		session:         nil,
+		log:             logger,
+	}
+
+	if awsCfg.logsEndpoint == "" {
+		awsCfg.logsEndpoint = awsCfg.endpoint
+	}
+	if config.IsSet("update-timeout") {
+		awsCfg.updateTimeout = time.Duration(config.GetInt("update-timeout")) * time.Second
+	}
+
+	var err error
+	if awsCfg.retry, err = srk.NewRetryPolicy(config); err != nil {
+		return nil, err
+	}
+
+	if (awsCfg.accessKeyID == "") != (awsCfg.secretAccessKey == "") {
+		return nil, errors.New("Options 'access-key-id' and 'secret-access-key' must be set together")
+	}
+
+	// see configs/srk.yaml for an example
+	if vpcConfig := config.GetString("vpc-config"); vpcConfig != "" {
+		splitVpcConfig := strings.Split(vpcConfig, ",")
+		if len(splitVpcConfig) != 2 {
+			return nil, errors.New("Option 'vpc-config' must have the form 'SUBNET,SECURITY-GROUP'")
+		}
+		if _, ok := awsCfg.settings[SettingSubnets]; !ok {
+			awsCfg.settings[SettingSubnets] = splitVpcConfig[0]
+		}
+		if _, ok := awsCfg.settings[SettingSecurityGroups]; !ok {
+			awsCfg.settings[SettingSecurityGroups] = splitVpcConfig[1]
+		}
+	}
+	if err := checkSettings(awsCfg.settings); err != nil {
+		return nil, err
 	}
 
 	for name, config := range config.GetStringMap("runtimes") {
 
-		runtimeConfig := config.(map[string]interface{})
-		baseConfig := runtimeConfig["base"].(string)
+		runtimeConfig, err := cast.ToStringMapE(config)
+		if err != nil {
+			return nil, errors.Errorf("Invalid configuration of runtime %s", name)
+		}
+		baseConfig, _ := runtimeConfig["base"].(string)
 		if baseConfig == "" {
 			baseConfig = "provided"
 		}
-		if layerConfig, definedLayers := runtimeConfig["layers"].([]interface{}); !definedLayers {
-			awsCfg.runtimes[name] = awsLambdaRuntime{
-				base:   baseConfig,
-				layers: make([]string, len(layerConfig)),
-			}
+		runtime := awsLambdaRuntime{
+			base:     baseConfig,
+			layers:   cast.ToStringSlice(runtimeConfig["layers"]),
+			settings: mapSettings(runtimeConfig),
+		}
+		if err := checkSettings(runtime.settings); err != nil {
+			return nil, errors.Wrapf(err, "Invalid configuration of runtime %s", name)
+		}
+		awsCfg.runtimes[name] = runtime
+	}
 
-			for i := 0; i < len(layerConfig); i++ {
-				awsCfg.runtimes[name].layers[i] = layerConfig[i].(string)
-			}
+	for name, config := range config.GetStringMap("functions") {
+
+		functionConfig, err := cast.ToStringMapE(config)
+		if err != nil {
+			return nil, errors.Errorf("Invalid configuration of function %s", name)
+		}
+		awsCfg.functions[name] = functionConfig
+		if err := checkSettings(functionConfig); err != nil {
+			return nil, errors.Wrapf(err, "Invalid configuration of function %s", name)
 		}
 	}
 
@@ -75,31 +174,64 @@ func NewConfig(logger srk.Logger, config *viper.Viper) (srk.FunctionService, err
 func (self *awsLambdaConfig) ReportStats() (map[string]float64, error) {
 
 	stats := make(map[string]float64)
+	stats["srkRetries"] = float64(self.retry.Retries())
 	return stats, nil
 }
 
 func (self *awsLambdaConfig) ResetStats() error {
-	// Nothing to reset yet
+
+	self.retry.ResetRetries()
 	return nil
 }
 
 func (self *awsLambdaConfig) awsSession() *lambda.Lambda {
 
 	if self.session == nil {
-		sess := session.Must(session.NewSession())
-		self.session = lambda.New(sess, &aws.Config{Region: aws.String(self.region)})
+		sess, awsConfig := self.clientConfig(self.endpoint)
+		self.session = lambda.New(sess, awsConfig)
 	}
 
 	return self.session
 }
 
+// Session and configuration of the clients of AWS services. endpoint
+// overrides the regional AWS endpoint of the service if not empty.
+func (self *awsLambdaConfig) clientConfig(endpoint string) (*session.Session, *aws.Config) {
+
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		Profile:           self.profile,
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	awsConfig := &aws.Config{}
+	if self.region != "" {
+		awsConfig.Region = aws.String(self.region)
+	}
+	if endpoint != "" {
+		awsConfig.Endpoint = aws.String(endpoint)
+		// emulators don't care about the region but requests must be
+		// signed for one
+		if self.region == "" && aws.StringValue(sess.Config.Region) == "" {
+			awsConfig.Region = aws.String(defaultEmulatorRegion)
+		}
+	}
+	if self.accessKeyID != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(self.accessKeyID, self.secretAccessKey, self.sessionToken)
+	}
+	return sess, awsConfig
+}
+
+// Package the function as a zip file, unless the zip file is up to date
 func (self *awsLambdaConfig) Package(rawDir string) (zipDir string, rerr error) {
 
 	zipPath := filepath.Clean(rawDir) + ".zip"
-	rerr = srk.ZipDir(rawDir, rawDir, zipPath)
+	built, rerr := srk.BuildArchive(rawDir, zipPath, srk.ZipDir)
 	if rerr != nil {
 		return "", rerr
 	}
+	if !built {
+		self.log.Info("Package is up to date: " + zipPath)
+	}
 	return zipPath, nil
 }
 
@@ -109,6 +241,20 @@ func (self *awsLambdaConfig) Install(rawDir string, env map[string]string, runti
 	return self.awsInstall(zipPath, env, runtime)
 }
 
+// Check if a function already runs zipDat. Without architectures, an update
+// keeps the architecture of the function.
+func codeUnchanged(config *lambda.FunctionConfiguration, zipDat []byte, architectures []*string) bool {
+
+	hash := sha256.Sum256(zipDat)
+	if aws.StringValue(config.CodeSha256) != base64.StdEncoding.EncodeToString(hash[:]) {
+		return false
+	}
+	if architectures == nil {
+		return true
+	}
+	return strings.Join(aws.StringValueSlice(architectures), ",") == strings.Join(aws.StringValueSlice(config.Architectures), ",")
+}
+
 func (self *awsLambdaConfig) Remove(fName string) error {
 
 	_, err := self.awsSession().DeleteFunction(&lambda.DeleteFunctionInput{FunctionName: aws.String(fName)})
@@ -118,31 +264,156 @@ func (self *awsLambdaConfig) Remove(fName string) error {
 	return nil
 }
 
+// List all functions of the account in the region, not only the ones
+// installed by SRK
+func (self *awsLambdaConfig) List() ([]srk.FunctionInfo, error) {
+
+	var infos []srk.FunctionInfo
+	err := self.awsSession().ListFunctionsPages(&lambda.ListFunctionsInput{},
+		func(page *lambda.ListFunctionsOutput, lastPage bool) bool {
+			for _, config := range page.Functions {
+				infos = append(infos, functionInfo(config))
+			}
+			return true
+		})
+	if err != nil {
+		return nil, decodeAwsError(err)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+func (self *awsLambdaConfig) Describe(fName string) (*srk.FunctionInfo, error) {
+
+	result, err := self.getFunction(fName)
+	if err != nil || result == nil {
+		return nil, err
+	}
+	info := functionInfo(result.Configuration)
+	if result.Concurrency != nil && result.Concurrency.ReservedConcurrentExecutions != nil {
+		info.Config[SettingConcurrency] = strconv.FormatInt(aws.Int64Value(result.Concurrency.ReservedConcurrentExecutions), 10)
+	}
+	return &info, nil
+}
+
+// Describe a function by its configuration. The runtime is the runtime of
+// AWS Lambda (the base of the SRK runtime).
+func functionInfo(config *lambda.FunctionConfiguration) srk.FunctionInfo {
+
+	info := srk.FunctionInfo{
+		Name:     aws.StringValue(config.FunctionName),
+		Runtime:  aws.StringValue(config.Runtime),
+		CodeHash: aws.StringValue(config.CodeSha256),
+		Config: map[string]string{
+			"arn":          aws.StringValue(config.FunctionArn),
+			"role":         aws.StringValue(config.Role),
+			"state":        aws.StringValue(config.State),
+			SettingHandler: aws.StringValue(config.Handler),
+			SettingMemory:  strconv.FormatInt(aws.Int64Value(config.MemorySize), 10),
+			SettingTimeout: strconv.FormatInt(aws.Int64Value(config.Timeout), 10),
+		},
+	}
+	if config.Environment != nil {
+		info.Env = aws.StringValueMap(config.Environment.Variables)
+	}
+	// e.g. 2020-05-01T10:00:00.000+0000
+	if t, err := time.Parse("2006-01-02T15:04:05.000-0700", aws.StringValue(config.LastModified)); err == nil {
+		info.InstallTime = t
+	}
+
+	if len(config.Architectures) > 0 {
+		info.Config[SettingArchitecture] = strings.Join(aws.StringValueSlice(config.Architectures), ",")
+	}
+	if config.EphemeralStorage != nil {
+		info.Config[SettingEphemeralStorage] = strconv.FormatInt(aws.Int64Value(config.EphemeralStorage.Size), 10)
+	}
+	if config.TracingConfig != nil {
+		info.Config[SettingTracing] = aws.StringValue(config.TracingConfig.Mode)
+	}
+	if config.VpcConfig != nil && len(config.VpcConfig.SubnetIds) > 0 {
+		info.Config[SettingSubnets] = strings.Join(aws.StringValueSlice(config.VpcConfig.SubnetIds), ",")
+		info.Config[SettingSecurityGroups] = strings.Join(aws.StringValueSlice(config.VpcConfig.SecurityGroupIds), ",")
+	}
+	var layers []string
+	for _, layer := range config.Layers {
+		layers = append(layers, aws.StringValue(layer.Arn))
+	}
+	if len(layers) > 0 {
+		info.Config["layers"] = strings.Join(layers, ",")
+	}
+	return info
+}
+
 func (self *awsLambdaConfig) Destroy() {
 	//Currently no state cleanup needed for Aws
 }
 
-func (self *awsLambdaConfig) Invoke(fName string, args string) (resp *bytes.Buffer, rerr error) {
+func (self *awsLambdaConfig) Invoke(fName string, args string) (resp *srk.InvokeResult, rerr error) {
+
+	return self.invoke(fName, args, lambda.InvocationTypeRequestResponse)
+}
+
+// Queue an invocation (an "Event" invocation). Lambda retries failed
+// asynchronous invocations on its own.
+func (self *awsLambdaConfig) InvokeAsync(fName string, args string) (*srk.InvokeResult, error) {
+
+	return self.invoke(fName, args, lambda.InvocationTypeEvent)
+}
+
+func (self *awsLambdaConfig) invoke(fName string, args string, invocationType string) (resp *srk.InvokeResult, rerr error) {
+
+	name, qualifier := splitQualifier(fName)
+	invokeInput := &lambda.InvokeInput{
+		FunctionName:   aws.String(name),
+		Payload:        []byte(args),
+		InvocationType: aws.String(invocationType),
+	}
+	if qualifier != "" {
+		invokeInput.Qualifier = aws.String(qualifier)
+	}
+	if self.tailLogs && invocationType == lambda.InvocationTypeRequestResponse {
+		// the last 4 KB of the log
+		invokeInput.LogType = aws.String(lambda.LogTypeTail)
+	}
 
-	awsResp, err := self.awsSession().Invoke(&lambda.InvokeInput{
-		FunctionName: aws.String(fName),
-		Payload:      []byte(args),
-		// This is a synchronous invocation, our API might need to change for async
-		InvocationType: aws.String("RequestResponse")})
+	var awsResp *lambda.InvokeOutput
+	var timer *srk.InvokeTimer
+	var requestID string
+	err := self.retry.Do(func() (err error) {
+		timer = srk.StartInvokeTimer()
+		// retries are up to the retry policy
+		awsResp, err = self.awsSession().InvokeWithContext(timer.Context(aws.BackgroundContext()), invokeInput, func(r *request.Request) {
+			r.Retryer = client.NoOpRetryer{}
+			r.Handlers.Complete.PushBack(func(r *request.Request) { requestID = r.RequestID })
+		})
+		return err
+	})
 	if err != nil {
-		return nil, errors.Wrap(decodeAwsError(err), "failed to invoke function")
+		return nil, invokeError(fName, err)
 	}
-	resp = bytes.NewBuffer(awsResp.Payload)
 
+	resp = &srk.InvokeResult{
+		Body:          awsResp.Payload,
+		Status:        int(aws.Int64Value(awsResp.StatusCode)),
+		FunctionError: awsResp.FunctionError != nil,
+		Metadata:      make(map[string]string),
+		Timing:        timer.Timing(),
+	}
+	if awsResp.ExecutedVersion != nil {
+		resp.Metadata["executedVersion"] = aws.StringValue(awsResp.ExecutedVersion)
+	}
+	if requestID != "" {
+		resp.Metadata["requestId"] = requestID
+	}
+	if awsResp.LogResult != nil {
+		if logResult, err := base64.StdEncoding.DecodeString(aws.StringValue(awsResp.LogResult)); err == nil {
+			resp.Metadata["logResult"] = string(logResult)
+		}
+	}
 	if awsResp.FunctionError != nil {
-		return resp, errors.Wrap(errors.New(string(awsResp.Payload)), "function returned error")
-	}
-	self.log.Info("Function invocation success:\n")
-	self.log.Infof("Executed Version: %v\n", awsResp.ExecutedVersion)
-	self.log.Infof("Function Error: %v\n", awsResp.FunctionError)
-	self.log.Infof("Log Result: %v\n", awsResp.LogResult)
-	self.log.Infof("Payload: %s\n", string(awsResp.Payload))
-	self.log.Infof("Status Code: %v\n", awsResp.StatusCode)
+		resp.Metadata["functionError"] = aws.StringValue(awsResp.FunctionError)
+		return resp, srk.FunctionInvokeError(fName, awsResp.Payload)
+	}
 	return resp, nil
 }
 
@@ -169,6 +440,7 @@ func (self *awsLambdaConfig) awsInstall(zipPath string, env map[string]string, r
 	}
 
 	awsLayers := []*string{}
+	runtimeName := runtime
 	if runtimeConfig, exists := self.runtimes[runtime]; exists {
 		if runtimeConfig.layers != nil {
 			awsLayers = aws.StringSlice(runtimeConfig.layers)
@@ -178,54 +450,79 @@ func (self *awsLambdaConfig) awsInstall(zipPath string, env map[string]string, r
 		}
 	}
 
+	settings, err := self.functionSettings(funcName, runtimeName)
+	if err != nil {
+		return err
+	}
+
 	var result *lambda.FunctionConfiguration
-	exists, err := lambdaExists(self.awsSession(), funcName)
+	existing, err := self.getFunction(funcName)
 	if err != nil {
 		return errors.Wrap(err, "Failure checking function status:")
 	}
 
-	if exists {
+	if existing != nil {
+		// a previous update may still be running
+		if done, _ := updateDone(existing.Configuration); !done {
+			if err := self.waitForUpdate(funcName); err != nil {
+				return err
+			}
+		}
+
 		request := &lambda.UpdateFunctionConfigurationInput{
-			FunctionName: aws.String(funcName),
-			Runtime:      aws.String(runtime),
-			Environment:  awsEnv,
-			Layers:       awsLayers,
+			FunctionName:     aws.String(funcName),
+			Handler:          aws.String(settings.handler),
+			MemorySize:       aws.Int64(settings.memory),
+			Role:             aws.String(self.role),
+			Runtime:          aws.String(runtime),
+			Timeout:          aws.Int64(settings.timeout),
+			EphemeralStorage: settings.ephemeralStorageConfig(),
+			Environment:      awsEnv,
+			Layers:           awsLayers,
+			TracingConfig:    settings.tracingConfig(),
+			VpcConfig:        settings.vpcConfig(),
 		}
 
 		_, err := self.awsSession().UpdateFunctionConfiguration(request)
 		if err != nil {
-			return errors.Wrap(err, "Failure updating function configuration:")
+			return errors.Wrap(decodeAwsError(err), "Failure updating function configuration:")
 		}
-
-		req := &lambda.UpdateFunctionCodeInput{
-			FunctionName: aws.String(funcName),
-			ZipFile:      zipDat,
+		// the code can't be updated while the configuration is updated
+		if err := self.waitForUpdate(funcName); err != nil {
+			return err
 		}
 
-		self.log.Info("Updating Function: " + funcName)
-		result, err = self.awsSession().UpdateFunctionCode(req)
-	} else {
-		awsVpcConfig := lambda.VpcConfig{}
-		if self.vpcConfig != "" {
-			splitVpcConfig := strings.Split(self.vpcConfig, ",")
-			awsVpcConfig.SetSecurityGroupIds([]*string{&splitVpcConfig[1]})
-			awsVpcConfig.SetSubnetIds([]*string{&splitVpcConfig[0]})
-		}
+		// the code is only uploaded if it changed (or the architecture
+		// changes with it)
+		if codeUnchanged(existing.Configuration, zipDat, settings.architectures()) {
+			self.log.Info("Code of function is up to date: " + funcName)
+			result = existing.Configuration
+		} else {
+			req := &lambda.UpdateFunctionCodeInput{
+				FunctionName:  aws.String(funcName),
+				Architectures: settings.architectures(),
+				ZipFile:       zipDat,
+			}
 
+			self.log.Info("Updating Function: " + funcName)
+			result, err = self.awsSession().UpdateFunctionCode(req)
+		}
+	} else {
 		req := &lambda.CreateFunctionInput{
-			Code:         &lambda.FunctionCode{ZipFile: zipDat},
-			Description:  aws.String("SRK Generated function " + funcName),
-			FunctionName: aws.String(funcName),
-			Handler:      aws.String("lambda_function.lambda_handler"),
-			MemorySize:   aws.Int64(3008),
-			// TODO do we want to publish?
-			// Publish:      aws.Bool(true),
-			Role:        aws.String(self.role),
-			Runtime:     aws.String(runtime),
-			Timeout:     aws.Int64(15),
-			Environment: awsEnv,
-			Layers:      awsLayers,
-			VpcConfig:   &awsVpcConfig,
+			Architectures:    settings.architectures(),
+			Code:             &lambda.FunctionCode{ZipFile: zipDat},
+			Description:      aws.String("SRK Generated function " + funcName),
+			EphemeralStorage: settings.ephemeralStorageConfig(),
+			FunctionName:     aws.String(funcName),
+			Handler:          aws.String(settings.handler),
+			MemorySize:       aws.Int64(settings.memory),
+			Role:             aws.String(self.role),
+			Runtime:          aws.String(runtime),
+			Timeout:          aws.Int64(settings.timeout),
+			Environment:      awsEnv,
+			Layers:           awsLayers,
+			TracingConfig:    settings.tracingConfig(),
+			VpcConfig:        settings.vpcConfig(),
 		}
 
 		self.log.Info("Creating Function: " + funcName)
@@ -234,26 +531,81 @@ func (self *awsLambdaConfig) awsInstall(zipPath string, env map[string]string, r
 	if err != nil {
 		return decodeAwsError(err)
 	}
+	// new functions are pending until they are active, code updates are in
+	// progress until they are deployed
+	if err := self.waitForUpdate(funcName); err != nil {
+		return err
+	}
+
+	if err := self.applyConcurrency(funcName, settings); err != nil {
+		return err
+	}
 
 	self.log.Info("Success:", result)
 	return nil
 }
 
-func lambdaExists(session *lambda.Lambda, fName string) (bool, error) {
-	req := &lambda.ListFunctionsInput{}
+// The function fName, nil if it does not exist
+func (self *awsLambdaConfig) getFunction(fName string) (*lambda.GetFunctionOutput, error) {
 
-	result, err := session.ListFunctions(req)
+	result, err := self.awsSession().GetFunction(&lambda.GetFunctionInput{FunctionName: aws.String(fName)})
+	if isNotFound(err) {
+		return nil, nil
+	}
 	if err != nil {
-		return false, decodeAwsError(err)
+		return nil, decodeAwsError(err)
 	}
+	return result, nil
+}
 
-	for _, f := range result.Functions {
-		if *f.FunctionName == fName {
-			return true, nil
+// Wait until a function is no longer being created or updated. Functions
+// only accept the next update once the previous one is done.
+func (self *awsLambdaConfig) waitForUpdate(fName string) error {
+
+	deadline := time.Now().Add(self.updateTimeout)
+	for {
+		config, err := self.awsSession().GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+			FunctionName: aws.String(fName),
+		})
+		if err != nil {
+			return decodeAwsError(err)
+		}
+		done, err := updateDone(config)
+		if err != nil {
+			return errors.Wrapf(err, "Function %s", fName)
+		}
+		if done {
+			return nil
 		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("Timeout waiting for function %s to be updated (state %s, last update %s)",
+				fName, aws.StringValue(config.State), aws.StringValue(config.LastUpdateStatus))
+		}
+		time.Sleep(self.updateInterval)
+	}
+}
+
+// Whether the creation and the last update of a function are done. Fails if
+// they failed.
+func updateDone(config *lambda.FunctionConfiguration) (bool, error) {
+	if config == nil {
+		return true, nil
 	}
 
-	return false, nil
+	switch aws.StringValue(config.State) {
+	case lambda.StatePending:
+		return false, nil
+	case lambda.StateFailed:
+		return true, errors.Errorf("failed to become active: %s", aws.StringValue(config.StateReason))
+	}
+
+	switch aws.StringValue(config.LastUpdateStatus) {
+	case lambda.LastUpdateStatusInProgress:
+		return false, nil
+	case lambda.LastUpdateStatusFailed:
+		return true, errors.Errorf("update failed: %s", aws.StringValue(config.LastUpdateStatusReason))
+	}
+	return true, nil
 }
 
 func zipRaw(rawPath, dstPath string) error {
@@ -311,6 +663,37 @@ func zipRaw(rawPath, dstPath string) error {
 	return nil
 }
 
+// Whether err reports a function, version or alias that does not exist
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == lambda.ErrCodeResourceNotFoundException
+}
+
+// Classify an error of an invocation. Errors that are not an invocation
+// error (e.g. invalid credentials) are returned as they are.
+func invokeError(fName string, err error) error {
+
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return srk.HttpInvokeError(fName, err)
+	}
+	switch aerr.Code() {
+	case lambda.ErrCodeResourceNotFoundException:
+		return srk.NewInvokeError(srk.ErrNotFound, fName, err)
+	case lambda.ErrCodeTooManyRequestsException, lambda.ErrCodeEC2ThrottledException:
+		return srk.NewInvokeError(srk.ErrThrottled, fName, err)
+	case request.CanceledErrorCode, request.ErrCodeResponseTimeout:
+		return srk.NewInvokeError(srk.ErrTimeout, fName, err)
+	case request.ErrCodeRequestError, request.ErrCodeRead:
+		// the request or the response failed on the way
+		return srk.HttpInvokeError(fName, err)
+	}
+	if rerr, ok := err.(awserr.RequestFailure); ok && rerr.StatusCode() >= 500 {
+		return srk.NewInvokeError(srk.ErrTransport, fName, err)
+	}
+	return errors.Wrap(decodeAwsError(err), "failed to invoke function")
+}
+
 func decodeAwsError(err error) error {
 
 	var errStr string
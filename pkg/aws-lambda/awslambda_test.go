@@ -0,0 +1,425 @@
+package awslambda
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Package a python function named fName in dir
+func packageFunction(t *testing.T, service *awsLambdaConfig, dir string, fName string) string {
+	rawDir := filepath.Join(dir, fName)
+	require.Nil(t, os.MkdirAll(rawDir, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(rawDir, "lambda_function.py"),
+		[]byte("def lambda_handler(event, context):\n    return event\n"), 0644))
+
+	zipPath, err := service.Package(rawDir)
+	require.Nil(t, err)
+	assert.Equal(t, rawDir+".zip", zipPath)
+	return rawDir
+}
+
+func newFakeService(t *testing.T, fake *fakeLambda, extraConfig string) *awsLambdaConfig {
+	service, err := newTestConfig(t, fake.config()+extraConfig)
+	require.Nil(t, err)
+	return service
+}
+
+func TestInstallInvokeRemove(t *testing.T) {
+	fake := newFakeLambda()
+	defer fake.Close()
+	service := newFakeService(t, fake, `
+memory : 512
+subnets : [ 'subnet-1', 'subnet-2' ]
+security-groups : [ 'sg-1' ]
+runtimes :
+  with-layer :
+    base : 'python3.8'
+    layers : [ 'arn:aws:lambda:us-west-2:123456789012:layer:numpy:1' ]
+    architecture : 'arm64'
+`)
+	defer service.Destroy()
+
+	dir, err := ioutil.TempDir("", "srk-aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	rawDir := packageFunction(t, service, dir, "echo")
+
+	// create
+	require.Nil(t, service.Install(rawDir, map[string]string{"MODE": "test"}, ""))
+	fn := fake.function("echo")
+	require.NotNil(t, fn)
+	assert.NotEmpty(t, fn.code)
+	assert.Equal(t, "python3.8", aws.StringValue(fn.config.Runtime))
+	assert.Equal(t, "lambda_function.lambda_handler", aws.StringValue(fn.config.Handler))
+	assert.Equal(t, int64(512), aws.Int64Value(fn.config.MemorySize))
+	assert.Equal(t, int64(15), aws.Int64Value(fn.config.Timeout))
+	assert.Equal(t, "arn:aws:iam::123456789012:role/srk-test", aws.StringValue(fn.config.Role))
+	assert.Equal(t, map[string]string{"MODE": "test"}, aws.StringValueMap(fn.config.Environment.Variables))
+	assert.Equal(t, []string{"subnet-1", "subnet-2"}, aws.StringValueSlice(fn.config.VpcConfig.SubnetIds))
+	assert.Equal(t, []string{"sg-1"}, aws.StringValueSlice(fn.config.VpcConfig.SecurityGroupIds))
+	assert.Nil(t, fn.concurrency)
+
+	// update with another runtime and settings from the command line
+	require.Nil(t, service.SetFunctionSettings("echo", map[string]string{"timeout": "60", "reserved-concurrency": "5"}))
+	require.Nil(t, service.Install(rawDir, nil, "with-layer"))
+	fn = fake.function("echo")
+	assert.Equal(t, "python3.8", aws.StringValue(fn.config.Runtime))
+	assert.Equal(t, int64(60), aws.Int64Value(fn.config.Timeout))
+	assert.Equal(t, []string{"arm64"}, aws.StringValueSlice(fn.config.Architectures))
+	require.Len(t, fn.config.Layers, 1)
+	assert.Equal(t, "arn:aws:lambda:us-west-2:123456789012:layer:numpy:1", aws.StringValue(fn.config.Layers[0].Arn))
+	assert.Nil(t, fn.config.Environment)
+	assert.Equal(t, int64(5), aws.Int64Value(fn.concurrency))
+
+	// describe
+	info, err := service.Describe("echo")
+	require.Nil(t, err)
+	require.NotNil(t, info)
+	assert.Equal(t, "echo", info.Name)
+	assert.Equal(t, "python3.8", info.Runtime)
+	assert.Equal(t, aws.StringValue(fn.config.CodeSha256), info.CodeHash)
+	assert.NotEmpty(t, info.CodeHash)
+	assert.WithinDuration(t, time.Now(), info.InstallTime, time.Minute)
+	assert.Equal(t, "60", info.Config[SettingTimeout])
+	assert.Equal(t, "5", info.Config[SettingConcurrency])
+	assert.Equal(t, "arm64", info.Config[SettingArchitecture])
+	assert.Equal(t, "arn:aws:lambda:us-west-2:123456789012:layer:numpy:1", info.Config["layers"])
+	info, err = service.Describe("missing")
+	assert.Nil(t, err)
+	assert.Nil(t, info)
+
+	// settings that are not configured are left as they are (e.g. when they
+	// were changed outside of srk), the reserved concurrency can be removed
+	fn.config.TracingConfig = &lambda.TracingConfigResponse{Mode: aws.String(lambda.TracingModeActive)}
+	require.Nil(t, service.SetFunctionSettings("echo", map[string]string{"reserved-concurrency": "none"}))
+	require.Nil(t, service.Install(rawDir, nil, "with-layer"))
+	fn = fake.function("echo")
+	assert.Equal(t, lambda.TracingModeActive, aws.StringValue(fn.config.TracingConfig.Mode))
+	assert.Nil(t, fn.concurrency)
+
+	// invoke
+	resp, err := service.Invoke("echo", `{"hello": "world"}`)
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"hello": "world"}`, resp.String())
+	assert.Equal(t, 200, resp.Status)
+	assert.False(t, resp.FunctionError)
+	assert.Equal(t, "$LATEST", resp.Metadata["executedVersion"])
+	assert.True(t, resp.Timing.Total > 0)
+	assert.True(t, resp.Timing.FirstByte <= resp.Timing.Total)
+
+	resp, err = service.Invoke("echo", `{"fail": true}`)
+	assert.NotNil(t, err)
+	require.NotNil(t, resp)
+	assert.Contains(t, resp.String(), "failed on request")
+	assert.True(t, resp.FunctionError)
+	assert.Equal(t, "Unhandled", resp.Metadata["functionError"])
+	assert.Equal(t, srk.ErrFunction, srk.KindOf(err))
+
+	_, err = service.Invoke("missing", `{}`)
+	assert.NotNil(t, err)
+	assert.Equal(t, srk.ErrNotFound, srk.KindOf(err))
+
+	// queued without waiting for the function
+	resp, err = service.InvokeAsync("echo", `{"fail": true}`)
+	require.Nil(t, err)
+	assert.Equal(t, 202, resp.Status)
+	assert.Empty(t, resp.Body)
+	assert.False(t, resp.FunctionError)
+
+	// remove
+	require.Nil(t, service.Remove("echo"))
+	assert.Nil(t, fake.function("echo"))
+	assert.NotNil(t, service.Remove("echo"))
+}
+
+func TestVersionsAndAliases(t *testing.T) {
+	fake := newFakeLambda()
+	defer fake.Close()
+	service := newFakeService(t, fake, ``)
+	defer service.Destroy()
+
+	dir, err := ioutil.TempDir("", "srk-aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	rawDir := packageFunction(t, service, dir, "echo")
+	require.Nil(t, service.Install(rawDir, nil, ""))
+
+	versions, err := service.ListVersions("echo")
+	require.Nil(t, err)
+	assert.Empty(t, versions)
+	assert.NotNil(t, service.SetAlias("echo", "prod", ""), "no published version")
+
+	v1, err := service.PublishVersion("echo")
+	require.Nil(t, err)
+	assert.Equal(t, "1", v1)
+	require.Nil(t, service.SetAlias("echo", "baseline", ""))
+
+	v2, err := service.PublishVersion("echo")
+	require.Nil(t, err)
+	require.Nil(t, service.SetAlias("echo", "candidate", v2))
+
+	versions, err = service.ListVersions("echo")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"1", "2"}, versions)
+
+	aliases, err := service.ListAliases("echo")
+	require.Nil(t, err)
+	require.Len(t, aliases, 2)
+	assert.Equal(t, "baseline", aliases[0].Name)
+	assert.Equal(t, "1", aliases[0].Version)
+	assert.Equal(t, "candidate", aliases[1].Name)
+	assert.Equal(t, "2", aliases[1].Version)
+
+	// qualified invocation
+	resp, err := service.Invoke("echo:baseline", `{}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", resp.Metadata["executedVersion"])
+	_, err = service.Invoke("echo:2", `{}`)
+	assert.Nil(t, err)
+	_, err = service.Invoke("echo:missing", `{}`)
+	assert.NotNil(t, err)
+
+	// point an existing alias elsewhere
+	require.Nil(t, service.SetAlias("echo", "baseline", "2"))
+	aliases, err = service.ListAliases("echo")
+	require.Nil(t, err)
+	assert.Equal(t, "2", aliases[0].Version)
+
+	require.Nil(t, service.RemoveAlias("echo", "candidate"))
+	aliases, err = service.ListAliases("echo")
+	require.Nil(t, err)
+	assert.Len(t, aliases, 1)
+	assert.NotNil(t, service.RemoveAlias("echo", "candidate"))
+}
+
+func TestLayers(t *testing.T) {
+	fake := newFakeLambda()
+	defer fake.Close()
+	service := newFakeService(t, fake, ``)
+	defer service.Destroy()
+
+	dir, err := ioutil.TempDir("", "srk-aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "lib.py"), []byte("x = 1\n"), 0644))
+
+	layer, err := service.CreateLayer("lib", dir)
+	require.Nil(t, err)
+	assert.Equal(t, 1, layer.Version)
+	layer, err = service.CreateLayer("lib", dir)
+	require.Nil(t, err)
+	assert.Equal(t, 2, layer.Version)
+	assert.Equal(t, "arn:aws:lambda:us-west-2:123456789012:layer:lib:2", layer.Ref)
+
+	layers, err := service.ListLayers()
+	require.Nil(t, err)
+	require.Len(t, layers, 2)
+
+	require.Nil(t, service.RemoveLayer("lib", 1))
+	layers, err = service.ListLayers()
+	require.Nil(t, err)
+	require.Len(t, layers, 1)
+	assert.Equal(t, 2, layers[0].Version)
+}
+
+func TestEndpointCredentials(t *testing.T) {
+	fake := newFakeLambda()
+	defer fake.Close()
+
+	// the fake rejects other credentials
+	service, err := newTestConfig(t, `
+endpoint : '`+fake.URL+`'
+access-key-id : 'AKIDOTHER'
+secret-access-key : 'secret'
+`)
+	require.Nil(t, err)
+	_, err = service.Invoke("echo", `{}`)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "UnrecognizedClientException")
+	assert.NotEmpty(t, fake.requestLog())
+
+	_, err = newTestConfig(t, `
+endpoint : '`+fake.URL+`'
+access-key-id : 'AKIDTEST'
+`)
+	assert.NotNil(t, err)
+}
+
+func TestInstallManyFunctions(t *testing.T) {
+	fake := newFakeLambda()
+	defer fake.Close()
+	fake.pageSize = 1
+	service := newFakeService(t, fake, ``)
+	defer service.Destroy()
+
+	dir, err := ioutil.TempDir("", "srk-aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// more functions than fit on a page of ListFunctions
+	for _, fName := range []string{"a", "b", "c"} {
+		require.Nil(t, service.Install(packageFunction(t, service, dir, fName), nil, ""))
+	}
+	// unchanged code is not uploaded again
+	require.Nil(t, service.Install(filepath.Join(dir, "c"), map[string]string{"UPDATED": "1"}, ""))
+	assert.Equal(t, map[string]string{"UPDATED": "1"}, aws.StringValueMap(fake.function("c").config.Environment.Variables))
+	assert.NotContains(t, fake.requestLog(), "PUT /2015-03-31/functions/c/code")
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "c", "lambda_function.py"),
+		[]byte("def lambda_handler(event, context):\n    return 'c'\n"), 0644))
+	_, err = service.Package(filepath.Join(dir, "c"))
+	require.Nil(t, err)
+	require.Nil(t, service.Install(filepath.Join(dir, "c"), map[string]string{"UPDATED": "1"}, ""))
+	assert.Contains(t, fake.requestLog(), "PUT /2015-03-31/functions/c/code")
+
+	infos, err := service.List()
+	require.Nil(t, err)
+	require.Len(t, infos, 3)
+	for i, fName := range []string{"a", "b", "c"} {
+		assert.Equal(t, fName, infos[i].Name)
+	}
+	assert.Equal(t, map[string]string{"UPDATED": "1"}, infos[2].Env)
+}
+
+func TestInstallWaitsForUpdates(t *testing.T) {
+	fake := newFakeLambda()
+	defer fake.Close()
+	fake.updatePolls = 3
+	service := newFakeService(t, fake, ``)
+	defer service.Destroy()
+	service.updateInterval = time.Millisecond
+
+	dir, err := ioutil.TempDir("", "srk-aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	rawDir := packageFunction(t, service, dir, "echo")
+
+	// the fake rejects updates while the function is pending or updating
+	require.Nil(t, service.Install(rawDir, nil, ""))
+	fn := fake.function("echo")
+	assert.Equal(t, "Active", aws.StringValue(fn.config.State))
+	require.Nil(t, service.Install(rawDir, nil, ""))
+	assert.Equal(t, "Successful", aws.StringValue(fake.function("echo").config.LastUpdateStatus))
+
+	fake.mutex.Lock()
+	fake.updateFailure = "no space left"
+	fake.mutex.Unlock()
+	err = service.Install(rawDir, nil, "")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no space left")
+
+	service.updateTimeout = 0
+	fake.mutex.Lock()
+	fake.updateFailure = ""
+	fake.updatePolls = 1000
+	fake.mutex.Unlock()
+	err = service.Install(rawDir, nil, "")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Timeout")
+}
+
+func TestInstallGetFunctionError(t *testing.T) {
+	fake := newFakeLambda()
+	defer fake.Close()
+	fake.getError = "AccessDeniedException"
+	service := newFakeService(t, fake, ``)
+	defer service.Destroy()
+
+	dir, err := ioutil.TempDir("", "srk-aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// only "not found" means that the function must be created
+	err = service.Install(packageFunction(t, service, dir, "echo"), nil, "")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "AccessDeniedException")
+	assert.NotContains(t, fake.requestLog(), "POST /2015-03-31/functions")
+}
+
+func TestInvokeRetries(t *testing.T) {
+	fake := newFakeLambda()
+	defer fake.Close()
+	service := newFakeService(t, fake, `
+retry :
+  max-attempts : 3
+  base-delay : 0.001
+`)
+	defer service.Destroy()
+
+	dir, err := ioutil.TempDir("", "srk-aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, service.Install(packageFunction(t, service, dir, "echo"), nil, ""))
+
+	// throttled invocations are retried by the policy, not by the SDK
+	fake.mutex.Lock()
+	fake.throttle = 2
+	fake.mutex.Unlock()
+	resp, err := service.Invoke("echo", `{"n": 1}`)
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"n": 1}`, resp.String())
+	stats, err := service.ReportStats()
+	require.Nil(t, err)
+	assert.Equal(t, 2.0, stats["srkRetries"])
+
+	fake.mutex.Lock()
+	fake.throttle = 3
+	fake.mutex.Unlock()
+	_, err = service.Invoke("echo", `{}`)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "TooManyRequestsException")
+	assert.Equal(t, srk.ErrThrottled, srk.KindOf(err))
+	stats, _ = service.ReportStats()
+	assert.Equal(t, 4.0, stats["srkRetries"])
+
+	// function errors are not retried
+	require.Nil(t, service.ResetStats())
+	_, err = service.Invoke("echo", `{"fail": true}`)
+	assert.NotNil(t, err)
+	stats, _ = service.ReportStats()
+	assert.Equal(t, 0.0, stats["srkRetries"])
+}
+
+func TestLogs(t *testing.T) {
+	fake := newFakeLambda()
+	defer fake.Close()
+	fake.pageSize = 2
+	service := newFakeService(t, fake, `
+tail-logs : true
+`)
+	defer service.Destroy()
+
+	dir, err := ioutil.TempDir("", "srk-aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, service.Install(packageFunction(t, service, dir, "echo"), nil, ""))
+
+	// no log group before the first invocation
+	entries, err := service.Logs("echo", time.Time{})
+	require.Nil(t, err)
+	assert.Empty(t, entries)
+
+	for i := 0; i < 3; i++ {
+		resp, err := service.Invoke("echo", `{}`)
+		require.Nil(t, err)
+		assert.Equal(t, "invoked with {}\n", resp.Metadata["logResult"])
+	}
+	entries, err = service.Logs("echo", time.Time{})
+	require.Nil(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "invoked with {}", entries[0].Message)
+	assert.WithinDuration(t, time.Now(), entries[2].Time, time.Minute)
+
+	entries, err = service.Logs("echo", time.Now().Add(time.Minute))
+	require.Nil(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,539 @@
+package awslambda
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// A stand-in for the Lambda API with the operations used by awsLambdaConfig.
+// Functions echo their payload, a payload of {"fail": true} raises an error.
+// The fake also serves the CloudWatch Logs events of the invocations.
+type fakeLambda struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	functions map[string]*fakeFunction
+	layers    map[string][]*lambda.LayerVersionsListItem
+	// log events by log group
+	logs map[string][]*cloudwatchlogs.FilteredLogEvent
+	// functions per page of ListFunctions and events per page of
+	// FilterLogEvents
+	pageSize int
+	// number of status checks until a create or update is done
+	updatePolls int
+	// reason why updates fail, empty if they succeed
+	updateFailure string
+	// error code returned by GetFunction, empty to serve it
+	getError string
+	// number of invocations that are throttled before the next one is served
+	throttle int
+	// "METHOD PATH" of every request
+	requests []string
+}
+
+type fakeFunction struct {
+	config      lambda.FunctionConfiguration
+	code        []byte
+	versions    []lambda.FunctionConfiguration
+	aliases     map[string]string
+	concurrency *int64
+	// status checks until the running create or update is done
+	pending int
+}
+
+type fakeError struct {
+	status int
+	code   string
+}
+
+func (e *fakeError) Error() string {
+	return e.code
+}
+
+func notFound() error {
+	return &fakeError{http.StatusNotFound, lambda.ErrCodeResourceNotFoundException}
+}
+
+func newFakeLambda() *fakeLambda {
+	f := &fakeLambda{
+		functions: make(map[string]*fakeFunction),
+		layers:    make(map[string][]*lambda.LayerVersionsListItem),
+		logs:      make(map[string][]*cloudwatchlogs.FilteredLogEvent),
+		pageSize:  50,
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+// Configuration of the awsLambda service for the fake
+func (f *fakeLambda) config() string {
+	return fmt.Sprintf(`
+endpoint : '%s'
+region : 'us-west-2'
+access-key-id : 'AKIDTEST'
+secret-access-key : 'secret'
+role : 'arn:aws:iam::123456789012:role/srk-test'
+default-runtime : 'python3.8'
+`, f.URL)
+}
+
+func (f *fakeLambda) function(name string) *fakeFunction {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.functions[name]
+}
+
+func (f *fakeLambda) requestLog() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string{}, f.requests...)
+}
+
+func (f *fakeLambda) serve(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDTEST/") {
+		f.fail(w, &fakeError{http.StatusForbidden, "UnrecognizedClientException"})
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		f.fail(w, err)
+		return
+	}
+
+	// /VERSION/functions/NAME/... or /VERSION/layers/NAME/...
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var result interface{}
+	switch {
+	case r.Header.Get("X-Amz-Target") == "Logs_20140328.FilterLogEvents":
+		result, err = f.filterLogEvents(body)
+	case len(parts) >= 2 && parts[1] == "functions":
+		result, err = f.serveFunctions(w, r, parts[2:], body)
+	case len(parts) >= 2 && parts[1] == "layers":
+		result, err = f.serveLayers(r, parts[2:], body)
+	default:
+		err = &fakeError{http.StatusNotFound, "UnknownOperationException"}
+	}
+	if err != nil {
+		f.fail(w, err)
+		return
+	}
+	if raw, ok := result.([]byte); ok {
+		w.Write(raw)
+		return
+	}
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeLambda) fail(w http.ResponseWriter, err error) {
+	ferr, ok := err.(*fakeError)
+	if !ok {
+		ferr = &fakeError{http.StatusBadRequest, lambda.ErrCodeInvalidParameterValueException}
+	}
+	w.Header().Set("X-Amzn-Errortype", ferr.code)
+	w.WriteHeader(ferr.status)
+	// CloudWatch Logs reports the code in the body
+	json.NewEncoder(w).Encode(map[string]string{"__type": ferr.code, "message": err.Error()})
+}
+
+func (f *fakeLambda) serveFunctions(w http.ResponseWriter, r *http.Request, path []string, body []byte) (interface{}, error) {
+	if len(path) == 0 || path[0] == "" {
+		switch r.Method {
+		case http.MethodPost:
+			return f.create(body)
+		case http.MethodGet:
+			return f.list(r)
+		}
+		return nil, &fakeError{http.StatusMethodNotAllowed, "UnknownOperationException"}
+	}
+
+	if r.Method == http.MethodGet && len(path) == 1 && f.getError != "" {
+		return nil, &fakeError{http.StatusForbidden, f.getError}
+	}
+	fn, ok := f.functions[path[0]]
+	if !ok {
+		return nil, notFound()
+	}
+	op := r.Method
+	if len(path) > 1 {
+		op += " " + path[1]
+	}
+	switch op {
+	case "PUT configuration", "PUT code":
+		if fn.pending > 0 {
+			return nil, &fakeError{http.StatusConflict, lambda.ErrCodeResourceConflictException}
+		}
+	case "GET", "GET configuration":
+		f.poll(fn)
+	}
+
+	switch op {
+	case "GET":
+		output := &lambda.GetFunctionOutput{
+			Configuration: &fn.config,
+			Code:          &lambda.FunctionCodeLocation{RepositoryType: aws.String("S3")},
+		}
+		if fn.concurrency != nil {
+			output.Concurrency = &lambda.PutFunctionConcurrencyOutput{ReservedConcurrentExecutions: fn.concurrency}
+		}
+		return output, nil
+	case "DELETE":
+		delete(f.functions, path[0])
+		return nil, nil
+	case "GET configuration":
+		return &fn.config, nil
+	case "PUT configuration":
+		return f.updateConfiguration(fn, body)
+	case "PUT code":
+		return f.updateCode(fn, body)
+	case "POST invocations":
+		return f.invoke(w, r, fn, body)
+	case "PUT concurrency":
+		var input lambda.PutFunctionConcurrencyInput
+		if err := json.Unmarshal(body, &input); err != nil {
+			return nil, err
+		}
+		fn.concurrency = input.ReservedConcurrentExecutions
+		return &lambda.PutFunctionConcurrencyOutput{ReservedConcurrentExecutions: fn.concurrency}, nil
+	case "DELETE concurrency":
+		fn.concurrency = nil
+		return nil, nil
+	case "POST versions":
+		return f.publish(fn), nil
+	case "GET versions":
+		versions := append([]lambda.FunctionConfiguration{fn.config}, fn.versions...)
+		output := &lambda.ListVersionsByFunctionOutput{}
+		for i := range versions {
+			output.Versions = append(output.Versions, &versions[i])
+		}
+		return output, nil
+	case "POST aliases":
+		var input lambda.CreateAliasInput
+		if err := json.Unmarshal(body, &input); err != nil {
+			return nil, err
+		}
+		if _, exists := fn.aliases[aws.StringValue(input.Name)]; exists {
+			return nil, &fakeError{http.StatusConflict, lambda.ErrCodeResourceConflictException}
+		}
+		return f.setAlias(fn, aws.StringValue(input.Name), aws.StringValue(input.FunctionVersion))
+	case "PUT aliases":
+		var input lambda.UpdateAliasInput
+		if err := json.Unmarshal(body, &input); err != nil {
+			return nil, err
+		}
+		if _, exists := fn.aliases[path[2]]; !exists {
+			return nil, notFound()
+		}
+		return f.setAlias(fn, path[2], aws.StringValue(input.FunctionVersion))
+	case "GET aliases":
+		output := &lambda.ListAliasesOutput{}
+		for name, version := range fn.aliases {
+			output.Aliases = append(output.Aliases, &lambda.AliasConfiguration{Name: aws.String(name), FunctionVersion: aws.String(version)})
+		}
+		return output, nil
+	case "DELETE aliases":
+		if _, exists := fn.aliases[path[2]]; !exists {
+			return nil, notFound()
+		}
+		delete(fn.aliases, path[2])
+		return nil, nil
+	}
+	return nil, &fakeError{http.StatusNotFound, "UnknownOperationException"}
+}
+
+func (f *fakeLambda) create(body []byte) (interface{}, error) {
+	var input lambda.CreateFunctionInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.FunctionName)
+	if _, exists := f.functions[name]; exists {
+		return nil, &fakeError{http.StatusConflict, lambda.ErrCodeResourceConflictException}
+	}
+
+	fn := &fakeFunction{
+		config: lambda.FunctionConfiguration{
+			FunctionName:     input.FunctionName,
+			FunctionArn:      aws.String("arn:aws:lambda:us-west-2:123456789012:function:" + name),
+			Version:          aws.String("$LATEST"),
+			Role:             input.Role,
+			Runtime:          input.Runtime,
+			Handler:          input.Handler,
+			MemorySize:       input.MemorySize,
+			Timeout:          input.Timeout,
+			Architectures:    input.Architectures,
+			EphemeralStorage: input.EphemeralStorage,
+			State:            aws.String(lambda.StateActive),
+			LastUpdateStatus: aws.String(lambda.LastUpdateStatusSuccessful),
+		},
+		aliases: make(map[string]string),
+	}
+	setCode(fn, input.Code.ZipFile)
+	applyConfiguration(&fn.config, input.Environment, input.Layers, input.TracingConfig, input.VpcConfig)
+	f.functions[name] = fn
+	if f.updatePolls > 0 {
+		fn.config.State = aws.String(lambda.StatePending)
+		fn.config.LastUpdateStatus = nil
+		fn.pending = f.updatePolls
+	}
+
+	if aws.BoolValue(input.Publish) {
+		return f.publish(fn), nil
+	}
+	return &fn.config, nil
+}
+
+func setCode(fn *fakeFunction, code []byte) {
+	fn.code = code
+	hash := sha256.Sum256(code)
+	fn.config.CodeSha256 = aws.String(base64.StdEncoding.EncodeToString(hash[:]))
+	fn.config.LastModified = aws.String(time.Now().UTC().Format("2006-01-02T15:04:05.000-0700"))
+}
+
+func applyConfiguration(config *lambda.FunctionConfiguration, env *lambda.Environment, layers []*string, tracing *lambda.TracingConfig, vpc *lambda.VpcConfig) {
+	config.Environment = nil
+	if env != nil {
+		config.Environment = &lambda.EnvironmentResponse{Variables: env.Variables}
+	}
+	config.Layers = nil
+	for _, arn := range layers {
+		config.Layers = append(config.Layers, &lambda.Layer{Arn: arn})
+	}
+	if tracing != nil {
+		config.TracingConfig = &lambda.TracingConfigResponse{Mode: tracing.Mode}
+	}
+	if vpc != nil {
+		config.VpcConfig = &lambda.VpcConfigResponse{SubnetIds: vpc.SubnetIds, SecurityGroupIds: vpc.SecurityGroupIds}
+	}
+}
+
+func (f *fakeLambda) list(r *http.Request) (interface{}, error) {
+	var names []string
+	for name := range f.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	start := 0
+	if marker := r.URL.Query().Get("Marker"); marker != "" {
+		var err error
+		if start, err = strconv.Atoi(marker); err != nil {
+			return nil, err
+		}
+	}
+	output := &lambda.ListFunctionsOutput{}
+	for i := start; i < len(names) && i < start+f.pageSize; i++ {
+		output.Functions = append(output.Functions, &f.functions[names[i]].config)
+	}
+	if start+f.pageSize < len(names) {
+		output.NextMarker = aws.String(strconv.Itoa(start + f.pageSize))
+	}
+	return output, nil
+}
+
+func (f *fakeLambda) updateConfiguration(fn *fakeFunction, body []byte) (interface{}, error) {
+	var input lambda.UpdateFunctionConfigurationInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	c := &fn.config
+	c.Role, c.Runtime, c.Handler = input.Role, input.Runtime, input.Handler
+	c.MemorySize, c.Timeout, c.EphemeralStorage = input.MemorySize, input.Timeout, input.EphemeralStorage
+	applyConfiguration(c, input.Environment, input.Layers, input.TracingConfig, input.VpcConfig)
+	f.startUpdate(fn)
+	return c, nil
+}
+
+func (f *fakeLambda) updateCode(fn *fakeFunction, body []byte) (interface{}, error) {
+	var input lambda.UpdateFunctionCodeInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	setCode(fn, input.ZipFile)
+	if input.Architectures != nil {
+		fn.config.Architectures = input.Architectures
+	}
+	f.startUpdate(fn)
+	if aws.BoolValue(input.Publish) {
+		return f.publish(fn), nil
+	}
+	return &fn.config, nil
+}
+
+func (f *fakeLambda) startUpdate(fn *fakeFunction) {
+	fn.config.LastUpdateStatus = aws.String(lambda.LastUpdateStatusInProgress)
+	fn.pending = f.updatePolls
+	f.poll(fn)
+}
+
+// Advance a running create or update
+func (f *fakeLambda) poll(fn *fakeFunction) {
+	if fn.pending > 0 {
+		fn.pending--
+	}
+	if fn.pending > 0 {
+		return
+	}
+	if aws.StringValue(fn.config.State) == lambda.StatePending {
+		fn.config.State = aws.String(lambda.StateActive)
+		fn.config.LastUpdateStatus = aws.String(lambda.LastUpdateStatusSuccessful)
+	}
+	if aws.StringValue(fn.config.LastUpdateStatus) == lambda.LastUpdateStatusInProgress {
+		if f.updateFailure != "" {
+			fn.config.LastUpdateStatus = aws.String(lambda.LastUpdateStatusFailed)
+			fn.config.LastUpdateStatusReason = aws.String(f.updateFailure)
+		} else {
+			fn.config.LastUpdateStatus = aws.String(lambda.LastUpdateStatusSuccessful)
+		}
+	}
+}
+
+func (f *fakeLambda) publish(fn *fakeFunction) *lambda.FunctionConfiguration {
+	version := fn.config
+	version.Version = aws.String(strconv.Itoa(len(fn.versions) + 1))
+	fn.versions = append(fn.versions, version)
+	return &version
+}
+
+func (f *fakeLambda) setAlias(fn *fakeFunction, name string, version string) (interface{}, error) {
+	if version != "$LATEST" {
+		if n, err := strconv.Atoi(version); err != nil || n < 1 || n > len(fn.versions) {
+			return nil, notFound()
+		}
+	}
+	fn.aliases[name] = version
+	return &lambda.AliasConfiguration{Name: aws.String(name), FunctionVersion: aws.String(version)}, nil
+}
+
+func (f *fakeLambda) invoke(w http.ResponseWriter, r *http.Request, fn *fakeFunction, payload []byte) (interface{}, error) {
+	version := "$LATEST"
+	if qualifier := r.URL.Query().Get("Qualifier"); qualifier != "" && qualifier != version {
+		if aliased, ok := fn.aliases[qualifier]; ok {
+			version = aliased
+		} else if n, err := strconv.Atoi(qualifier); err == nil && n >= 1 && n <= len(fn.versions) {
+			version = qualifier
+		} else {
+			return nil, notFound()
+		}
+	}
+	if f.throttle > 0 {
+		f.throttle--
+		return nil, &fakeError{http.StatusTooManyRequests, lambda.ErrCodeTooManyRequestsException}
+	}
+	w.Header().Set("X-Amz-Executed-Version", version)
+
+	var event map[string]interface{}
+	json.Unmarshal(payload, &event)
+	logGroup := "/aws/lambda/" + aws.StringValue(fn.config.FunctionName)
+	f.logs[logGroup] = append(f.logs[logGroup], &cloudwatchlogs.FilteredLogEvent{
+		Timestamp: aws.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
+		Message:   aws.String("invoked with " + string(payload) + "\n"),
+	})
+	if r.Header.Get("X-Amz-Invocation-Type") == lambda.InvocationTypeEvent {
+		w.WriteHeader(http.StatusAccepted)
+		return []byte{}, nil
+	}
+	if r.Header.Get("X-Amz-Log-Type") == lambda.LogTypeTail {
+		w.Header().Set("X-Amz-Log-Result", base64.StdEncoding.EncodeToString([]byte("invoked with "+string(payload)+"\n")))
+	}
+	if event["fail"] == true {
+		w.Header().Set("X-Amz-Function-Error", "Unhandled")
+		return []byte(`{"errorMessage": "failed on request", "errorType": "Exception"}`), nil
+	}
+	return payload, nil
+}
+
+func (f *fakeLambda) filterLogEvents(body []byte) (interface{}, error) {
+	var input cloudwatchlogs.FilterLogEventsInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	events, ok := f.logs[aws.StringValue(input.LogGroupName)]
+	if !ok {
+		return nil, &fakeError{http.StatusBadRequest, cloudwatchlogs.ErrCodeResourceNotFoundException}
+	}
+
+	start := 0
+	if input.NextToken != nil {
+		var err error
+		if start, err = strconv.Atoi(aws.StringValue(input.NextToken)); err != nil {
+			return nil, err
+		}
+	}
+	output := &cloudwatchlogs.FilterLogEventsOutput{}
+	i := start
+	for ; i < len(events) && len(output.Events) < f.pageSize; i++ {
+		if aws.Int64Value(events[i].Timestamp) >= aws.Int64Value(input.StartTime) {
+			output.Events = append(output.Events, events[i])
+		}
+	}
+	if i < len(events) {
+		output.NextToken = aws.String(strconv.Itoa(i))
+	}
+	// unlike the Lambda API, the member names are not capitalized
+	return jsonutil.BuildJSON(output)
+}
+
+func (f *fakeLambda) serveLayers(r *http.Request, path []string, body []byte) (interface{}, error) {
+	if len(path) == 0 {
+		output := &lambda.ListLayersOutput{}
+		for name, versions := range f.layers {
+			if len(versions) > 0 {
+				output.Layers = append(output.Layers, &lambda.LayersListItem{
+					LayerName:             aws.String(name),
+					LatestMatchingVersion: versions[len(versions)-1],
+				})
+			}
+		}
+		return output, nil
+	}
+
+	name := path[0]
+	switch {
+	case r.Method == http.MethodPost:
+		var version int64 = 1
+		if versions := f.layers[name]; len(versions) > 0 {
+			version = aws.Int64Value(versions[len(versions)-1].Version) + 1
+		}
+		item := &lambda.LayerVersionsListItem{
+			Version:         aws.Int64(version),
+			LayerVersionArn: aws.String(fmt.Sprintf("arn:aws:lambda:us-west-2:123456789012:layer:%s:%d", name, version)),
+		}
+		f.layers[name] = append(f.layers[name], item)
+		return &lambda.PublishLayerVersionOutput{Version: item.Version, LayerVersionArn: item.LayerVersionArn}, nil
+	case r.Method == http.MethodGet:
+		return &lambda.ListLayerVersionsOutput{LayerVersions: f.layers[name]}, nil
+	case r.Method == http.MethodDelete && len(path) == 3:
+		var kept []*lambda.LayerVersionsListItem
+		for _, item := range f.layers[name] {
+			if strconv.FormatInt(aws.Int64Value(item.Version), 10) != path[2] {
+				kept = append(kept, item)
+			}
+		}
+		f.layers[name] = kept
+		return nil, nil
+	}
+	return nil, &fakeError{http.StatusNotFound, "UnknownOperationException"}
+}
@@ -0,0 +1,105 @@
+// AWS Lambda layer management. Implements the LayerService interface.
+
+package awslambda
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+)
+
+// Publish a new version of a layer from the contents of dir
+func (self *awsLambdaConfig) CreateLayer(name string, dir string) (*srk.Layer, error) {
+
+	tmpDir, err := ioutil.TempDir("", "srk-layer")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create temporary directory")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	zipPath := filepath.Join(tmpDir, name+".zip")
+	if err := srk.ZipDir(dir, dir, zipPath); err != nil {
+		return nil, errors.Wrap(err, "Failed to package layer")
+	}
+	zipDat, err := ioutil.ReadFile(zipPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read the zip file we just created")
+	}
+
+	self.log.Info("Publishing Layer: " + name)
+	result, err := self.awsSession().PublishLayerVersion(&lambda.PublishLayerVersionInput{
+		LayerName:   aws.String(name),
+		Description: aws.String("SRK Generated layer " + name),
+		Content:     &lambda.LayerVersionContentInput{ZipFile: zipDat},
+	})
+	if err != nil {
+		return nil, decodeAwsError(err)
+	}
+
+	return &srk.Layer{
+		Name:    name,
+		Version: int(aws.Int64Value(result.Version)),
+		Ref:     aws.StringValue(result.LayerVersionArn),
+	}, nil
+}
+
+// List all versions of all layers of the account in the configured region
+func (self *awsLambdaConfig) ListLayers() ([]srk.Layer, error) {
+
+	var names []string
+	err := self.awsSession().ListLayersPages(&lambda.ListLayersInput{},
+		func(page *lambda.ListLayersOutput, lastPage bool) bool {
+			for _, layer := range page.Layers {
+				names = append(names, aws.StringValue(layer.LayerName))
+			}
+			return true
+		})
+	if err != nil {
+		return nil, decodeAwsError(err)
+	}
+
+	var layers []srk.Layer
+	for _, name := range names {
+		err := self.awsSession().ListLayerVersionsPages(&lambda.ListLayerVersionsInput{LayerName: aws.String(name)},
+			func(page *lambda.ListLayerVersionsOutput, lastPage bool) bool {
+				for _, version := range page.LayerVersions {
+					layers = append(layers, srk.Layer{
+						Name:    name,
+						Version: int(aws.Int64Value(version.Version)),
+						Ref:     aws.StringValue(version.LayerVersionArn),
+					})
+				}
+				return true
+			})
+		if err != nil {
+			return nil, decodeAwsError(err)
+		}
+	}
+
+	sort.Slice(layers, func(i, j int) bool {
+		if layers[i].Name != layers[j].Name {
+			return layers[i].Name < layers[j].Name
+		}
+		return layers[i].Version < layers[j].Version
+	})
+	return layers, nil
+}
+
+// Delete a layer version. Functions that use it keep a copy of the layer.
+func (self *awsLambdaConfig) RemoveLayer(name string, version int) error {
+
+	_, err := self.awsSession().DeleteLayerVersion(&lambda.DeleteLayerVersionInput{
+		LayerName:     aws.String(name),
+		VersionNumber: aws.Int64(int64(version)),
+	})
+	if err != nil {
+		return decodeAwsError(err)
+	}
+	return nil
+}
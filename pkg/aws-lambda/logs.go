@@ -0,0 +1,63 @@
+// AWS Lambda function logs. Implements the LogService interface.
+
+package awslambda
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/serverlessresearch/srk/pkg/srk"
+)
+
+// Read the log of a function from CloudWatch Logs. Invocations only return
+// the tail of the log (see the tail-logs option), Lambda sends all of it to
+// the log group /aws/lambda/NAME. All versions of a function share the log
+// group.
+func (self *awsLambdaConfig) Logs(fName string, since time.Time) ([]srk.LogEntry, error) {
+
+	name, _ := splitQualifier(fName)
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: aws.String(logGroup(name)),
+		Interleaved:  aws.Bool(true),
+	}
+	if !since.IsZero() {
+		input.StartTime = aws.Int64(since.UnixNano() / int64(time.Millisecond))
+	}
+
+	var entries []srk.LogEntry
+	err := self.logsSession().FilterLogEventsPages(input, func(page *cloudwatchlogs.FilterLogEventsOutput, lastPage bool) bool {
+		for _, event := range page.Events {
+			entries = append(entries, srk.LogEntry{
+				Time:    time.Unix(0, aws.Int64Value(event.Timestamp)*int64(time.Millisecond)),
+				Message: strings.TrimRight(aws.StringValue(event.Message), "\n"),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		// the log group is created with the first log of the function
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == cloudwatchlogs.ErrCodeResourceNotFoundException {
+			return nil, nil
+		}
+		return nil, decodeAwsError(err)
+	}
+	return entries, nil
+}
+
+func (self *awsLambdaConfig) logsSession() *cloudwatchlogs.CloudWatchLogs {
+
+	if self.logs == nil {
+		sess, awsConfig := self.clientConfig(self.logsEndpoint)
+		self.logs = cloudwatchlogs.New(sess, awsConfig)
+	}
+
+	return self.logs
+}
+
+// The CloudWatch log group of a function
+func logGroup(fName string) string {
+	return "/aws/lambda/" + fName
+}
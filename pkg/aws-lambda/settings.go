@@ -0,0 +1,274 @@
+package awslambda
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// Function settings, configured at the top level of the service, per runtime
+// and per function (in 'functions.NAME'), or set on the command line
+const (
+	SettingHandler          = "handler"
+	SettingMemory           = "memory"
+	SettingTimeout          = "timeout"
+	SettingEphemeralStorage = "ephemeral-storage"
+	SettingArchitecture     = "architecture"
+	SettingSubnets          = "subnets"
+	SettingSecurityGroups   = "security-groups"
+	SettingTracing          = "tracing"
+	SettingConcurrency      = "reserved-concurrency"
+)
+
+// Values of the reserved concurrency setting that don't reserve executions
+const (
+	// leave the reserved concurrency of a function as it is
+	concurrencyUnchanged = -1
+	// remove the reserved concurrency of a function ("none" in the settings)
+	concurrencyNone = -2
+)
+
+var settingKeys = []string{
+	SettingHandler,
+	SettingMemory,
+	SettingTimeout,
+	SettingEphemeralStorage,
+	SettingArchitecture,
+	SettingSubnets,
+	SettingSecurityGroups,
+	SettingTracing,
+	SettingConcurrency,
+}
+
+// The configuration of a function
+type functionSettings struct {
+	handler string
+	// MB
+	memory int64
+	// seconds
+	timeout int64
+	// MB of /tmp, 0 for the AWS default
+	ephemeralStorage int64
+	// empty for the AWS default
+	architecture string
+	// the function is not connected to a VPC without subnets
+	subnets        []string
+	securityGroups []string
+	// the VPC configuration of the function is only changed if subnets or
+	// security groups are set
+	vpc bool
+	// empty if the tracing mode is left unchanged
+	tracing string
+	// concurrencyUnchanged, concurrencyNone or the reserved executions
+	concurrency int64
+}
+
+func defaultSettings() functionSettings {
+	return functionSettings{
+		handler:     "lambda_function.lambda_handler",
+		memory:      3008,
+		timeout:     15,
+		concurrency: concurrencyUnchanged,
+	}
+}
+
+// Override settings with values from the configuration or the command line.
+// Lists may be given as comma separated strings.
+func (s *functionSettings) set(values map[string]interface{}) error {
+	for key, value := range values {
+		var err error
+		switch key {
+		case SettingHandler:
+			s.handler, err = cast.ToStringE(value)
+		case SettingMemory:
+			s.memory, err = toPositive(value)
+		case SettingTimeout:
+			s.timeout, err = toPositive(value)
+		case SettingEphemeralStorage:
+			s.ephemeralStorage, err = toPositive(value)
+		case SettingArchitecture:
+			s.architecture, err = toEnum(value, lambda.Architecture_Values())
+		case SettingSubnets:
+			s.subnets, err = toList(value)
+			s.vpc = true
+		case SettingSecurityGroups:
+			s.securityGroups, err = toList(value)
+			s.vpc = true
+		case SettingTracing:
+			s.tracing, err = toEnum(value, lambda.TracingMode_Values())
+		case SettingConcurrency:
+			if none, ok := value.(string); ok && strings.EqualFold(none, "none") {
+				s.concurrency = concurrencyNone
+				break
+			}
+			s.concurrency, err = cast.ToInt64E(value)
+			if err == nil && s.concurrency < 0 {
+				err = errors.New("must not be negative, use 'none' to remove the reserved concurrency")
+			}
+		default:
+			return errors.Errorf("Unknown setting '%s', valid settings are %s", key, strings.Join(settingKeys, ", "))
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Invalid value '%v' of setting '%s'", value, key)
+		}
+	}
+	return nil
+}
+
+func toPositive(value interface{}) (int64, error) {
+	i, err := cast.ToInt64E(value)
+	if err == nil && i <= 0 {
+		err = errors.New("must be positive")
+	}
+	return i, err
+}
+
+func toEnum(value interface{}, valid []string) (string, error) {
+	s, err := cast.ToStringE(value)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range valid {
+		if strings.EqualFold(s, v) {
+			return v, nil
+		}
+	}
+	return "", errors.Errorf("must be one of %s", strings.Join(valid, ", "))
+}
+
+func toList(value interface{}) ([]string, error) {
+	if s, ok := value.(string); ok {
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	}
+	return cast.ToStringSliceE(value)
+}
+
+// Check settings of the configuration
+func checkSettings(values map[string]interface{}) error {
+	s := defaultSettings()
+	return s.set(values)
+}
+
+// The settings in a configuration section
+func configSettings(config *viper.Viper) map[string]interface{} {
+	values := make(map[string]interface{})
+	if config == nil {
+		return values
+	}
+	for _, key := range settingKeys {
+		if config.IsSet(key) {
+			values[key] = config.Get(key)
+		}
+	}
+	return values
+}
+
+// The settings in a runtime or function map of the configuration
+func mapSettings(config map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, key := range settingKeys {
+		if value, ok := config[key]; ok && value != nil {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// Check and set settings of function fName. They override the configuration
+// in the following installs of the function.
+func (self *awsLambdaConfig) SetFunctionSettings(fName string, settings map[string]string) error {
+	values := make(map[string]interface{})
+	for k, v := range settings {
+		values[k] = v
+	}
+	if err := checkSettings(values); err != nil {
+		return err
+	}
+	self.overrides[fName] = values
+	return nil
+}
+
+// The settings of function fName with runtime, from lowest to highest
+// priority: defaults, service configuration, runtime configuration, function
+// configuration, command line
+func (self *awsLambdaConfig) functionSettings(fName string, runtime string) (functionSettings, error) {
+	s := defaultSettings()
+	levels := []map[string]interface{}{
+		self.settings,
+		self.runtimes[runtime].settings,
+		// viper converts keys to lower case
+		self.functions[strings.ToLower(fName)],
+		self.overrides[fName],
+	}
+	for _, values := range levels {
+		if err := s.set(values); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+func (s *functionSettings) vpcConfig() *lambda.VpcConfig {
+	if !s.vpc {
+		return nil
+	}
+	return &lambda.VpcConfig{
+		SubnetIds:        aws.StringSlice(s.subnets),
+		SecurityGroupIds: aws.StringSlice(s.securityGroups),
+	}
+}
+
+func (s *functionSettings) tracingConfig() *lambda.TracingConfig {
+	if s.tracing == "" {
+		return nil
+	}
+	return &lambda.TracingConfig{Mode: aws.String(s.tracing)}
+}
+
+func (s *functionSettings) ephemeralStorageConfig() *lambda.EphemeralStorage {
+	if s.ephemeralStorage == 0 {
+		return nil
+	}
+	return &lambda.EphemeralStorage{Size: aws.Int64(s.ephemeralStorage)}
+}
+
+func (s *functionSettings) architectures() []*string {
+	if s.architecture == "" {
+		return nil
+	}
+	return aws.StringSlice([]string{s.architecture})
+}
+
+// Set or remove the reserved concurrency of a function if it is configured
+func (self *awsLambdaConfig) applyConcurrency(fName string, s functionSettings) error {
+	switch s.concurrency {
+	case concurrencyUnchanged:
+		return nil
+	case concurrencyNone:
+		_, err := self.awsSession().DeleteFunctionConcurrency(&lambda.DeleteFunctionConcurrencyInput{
+			FunctionName: aws.String(fName),
+		})
+		if err != nil {
+			return errors.Wrap(decodeAwsError(err), "Failure removing reserved concurrency:")
+		}
+		return nil
+	}
+	_, err := self.awsSession().PutFunctionConcurrency(&lambda.PutFunctionConcurrencyInput{
+		FunctionName:                 aws.String(fName),
+		ReservedConcurrentExecutions: aws.Int64(s.concurrency),
+	})
+	if err != nil {
+		return errors.Wrap(decodeAwsError(err), "Failure setting reserved concurrency:")
+	}
+	return nil
+}
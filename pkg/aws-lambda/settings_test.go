@@ -0,0 +1,156 @@
+package awslambda
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfig(t *testing.T, yaml string) (*awsLambdaConfig, error) {
+	config := viper.New()
+	config.SetConfigType("yaml")
+	require.Nil(t, config.ReadConfig(bytes.NewBufferString(yaml)))
+
+	service, err := NewConfig(logrus.New(), config)
+	if err != nil {
+		return nil, err
+	}
+	return service.(*awsLambdaConfig), nil
+}
+
+func TestFunctionSettings(t *testing.T) {
+	service, err := newTestConfig(t, `
+memory : 1024
+subnets : [ 'subnet-1', 'subnet-2' ]
+security-groups : 'sg-1'
+runtimes :
+  python-arm :
+    base : 'python3.8'
+    architecture : 'ARM64'
+    timeout : 30
+functions :
+  Resize :
+    memory : 2048
+    ephemeral-storage : 4096
+    reserved-concurrency : 0
+`)
+	require.Nil(t, err)
+
+	// defaults and service configuration
+	s, err := service.functionSettings("echo", "python3.8")
+	require.Nil(t, err)
+	assert.Equal(t, "lambda_function.lambda_handler", s.handler)
+	assert.Equal(t, int64(1024), s.memory)
+	assert.Equal(t, int64(15), s.timeout)
+	assert.Equal(t, int64(0), s.ephemeralStorage)
+	assert.Equal(t, "", s.architecture)
+	assert.Nil(t, s.architectures())
+	assert.Nil(t, s.ephemeralStorageConfig())
+	assert.Equal(t, []string{"subnet-1", "subnet-2"}, s.subnets)
+	assert.Equal(t, []string{"sg-1"}, s.securityGroups)
+	assert.Equal(t, "", s.tracing)
+	assert.Nil(t, s.tracingConfig())
+	assert.Equal(t, int64(concurrencyUnchanged), s.concurrency)
+
+	// runtime and function configuration
+	s, err = service.functionSettings("Resize", "python-arm")
+	require.Nil(t, err)
+	assert.Equal(t, "arm64", s.architecture)
+	assert.Equal(t, int64(30), s.timeout)
+	assert.Equal(t, int64(2048), s.memory)
+	assert.Equal(t, int64(4096), *s.ephemeralStorageConfig().Size)
+	assert.Equal(t, int64(0), s.concurrency)
+
+	// command line
+	require.Nil(t, service.SetFunctionSettings("Resize", map[string]string{
+		"memory":               "512",
+		"security-groups":      "sg-2, sg-3",
+		"tracing":              "active",
+		"handler":              "main.handler",
+		"reserved-concurrency": "None",
+	}))
+	s, err = service.functionSettings("Resize", "python-arm")
+	require.Nil(t, err)
+	assert.Equal(t, int64(512), s.memory)
+	assert.Equal(t, []string{"sg-2", "sg-3"}, s.securityGroups)
+	assert.Equal(t, "Active", s.tracing)
+	assert.Equal(t, "Active", *s.tracingConfig().Mode)
+	assert.Equal(t, "main.handler", s.handler)
+	assert.Equal(t, int64(concurrencyNone), s.concurrency)
+	assert.Equal(t, int64(30), s.timeout)
+
+	// only the function itself is affected
+	s, err = service.functionSettings("echo", "python-arm")
+	require.Nil(t, err)
+	assert.Equal(t, int64(1024), s.memory)
+}
+
+func TestInvalidSettings(t *testing.T) {
+	service, err := newTestConfig(t, ``)
+	require.Nil(t, err)
+
+	for _, settings := range []map[string]string{
+		{"memory": "lots"},
+		{"timeout": "0"},
+		{"architecture": "sparc"},
+		{"tracing": "sometimes"},
+		{"reserved-concurrency": "-1"},
+		{"reserved-concurrency": "-2"},
+		{"reserved-concurrency": "unlimited"},
+		{"colour": "blue"},
+	} {
+		assert.NotNil(t, service.SetFunctionSettings("echo", settings), "%v", settings)
+	}
+
+	_, err = newTestConfig(t, `
+functions :
+  echo :
+    memory : -5
+`)
+	assert.NotNil(t, err)
+
+	_, err = newTestConfig(t, `
+vpc-config : 'subnet-1'
+`)
+	assert.NotNil(t, err)
+}
+
+func TestVpcConfig(t *testing.T) {
+	service, err := newTestConfig(t, `
+vpc-config : 'subnet-1,sg-1'
+`)
+	require.Nil(t, err)
+
+	s, err := service.functionSettings("echo", "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"subnet-1"}, s.subnets)
+	assert.Equal(t, []string{"sg-1"}, s.securityGroups)
+
+	// subnets override the legacy option
+	service, err = newTestConfig(t, `
+vpc-config : 'subnet-1,sg-1'
+subnets : [ 'subnet-2', 'subnet-3' ]
+`)
+	require.Nil(t, err)
+	s, err = service.functionSettings("echo", "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"subnet-2", "subnet-3"}, s.subnets)
+	assert.Equal(t, []string{"sg-1"}, s.securityGroups)
+
+	// the VPC configuration is only sent if it is configured, empty subnets
+	// disconnect the function from its VPC
+	service, err = newTestConfig(t, ``)
+	require.Nil(t, err)
+	s, err = service.functionSettings("echo", "")
+	require.Nil(t, err)
+	assert.Nil(t, s.vpcConfig())
+	require.Nil(t, service.SetFunctionSettings("echo", map[string]string{"subnets": "", "security-groups": ""}))
+	s, err = service.functionSettings("echo", "")
+	require.Nil(t, err)
+	require.NotNil(t, s.vpcConfig())
+	assert.Empty(t, s.vpcConfig().SubnetIds)
+}
@@ -0,0 +1,133 @@
+// AWS Lambda versions and aliases. Implements the VersionService interface.
+
+package awslambda
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+)
+
+// Publish the code and configuration of $LATEST as a new version
+func (self *awsLambdaConfig) PublishVersion(fName string) (string, error) {
+
+	result, err := self.awsSession().PublishVersion(&lambda.PublishVersionInput{
+		FunctionName: aws.String(fName),
+	})
+	if err != nil {
+		return "", decodeAwsError(err)
+	}
+	return aws.StringValue(result.Version), nil
+}
+
+// List the published versions of a function, oldest first
+func (self *awsLambdaConfig) ListVersions(fName string) ([]string, error) {
+
+	var versions []int
+	err := self.awsSession().ListVersionsByFunctionPages(&lambda.ListVersionsByFunctionInput{FunctionName: aws.String(fName)},
+		func(page *lambda.ListVersionsByFunctionOutput, lastPage bool) bool {
+			for _, f := range page.Versions {
+				// published versions are numbers
+				if version, err := strconv.Atoi(aws.StringValue(f.Version)); err == nil {
+					versions = append(versions, version)
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return nil, decodeAwsError(err)
+	}
+
+	sort.Ints(versions)
+	list := make([]string, len(versions))
+	for i, version := range versions {
+		list[i] = strconv.Itoa(version)
+	}
+	return list, nil
+}
+
+// Create an alias or point it to another version
+func (self *awsLambdaConfig) SetAlias(fName string, alias string, version string) error {
+
+	if version == "" {
+		versions, err := self.ListVersions(fName)
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			return errors.Errorf("Function %s has no published version", fName)
+		}
+		version = versions[len(versions)-1]
+	}
+
+	_, err := self.awsSession().UpdateAlias(&lambda.UpdateAliasInput{
+		FunctionName:    aws.String(fName),
+		Name:            aws.String(alias),
+		FunctionVersion: aws.String(version),
+	})
+	if isNotFound(err) {
+		_, err = self.awsSession().CreateAlias(&lambda.CreateAliasInput{
+			FunctionName:    aws.String(fName),
+			Name:            aws.String(alias),
+			FunctionVersion: aws.String(version),
+			Description:     aws.String("SRK Generated alias " + alias),
+		})
+	}
+	if err != nil {
+		return decodeAwsError(err)
+	}
+	self.log.Infof("Alias %s:%s points to version %s", fName, alias, version)
+	return nil
+}
+
+// List the aliases of a function
+func (self *awsLambdaConfig) ListAliases(fName string) ([]srk.FunctionAlias, error) {
+
+	var aliases []srk.FunctionAlias
+	err := self.awsSession().ListAliasesPages(&lambda.ListAliasesInput{FunctionName: aws.String(fName)},
+		func(page *lambda.ListAliasesOutput, lastPage bool) bool {
+			for _, alias := range page.Aliases {
+				aliases = append(aliases, srk.FunctionAlias{
+					Name:    aws.StringValue(alias.Name),
+					Version: aws.StringValue(alias.FunctionVersion),
+				})
+			}
+			return true
+		})
+	if err != nil {
+		return nil, decodeAwsError(err)
+	}
+
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return aliases, nil
+}
+
+// Remove an alias, the version it points to is kept
+func (self *awsLambdaConfig) RemoveAlias(fName string, alias string) error {
+
+	_, err := self.awsSession().DeleteAlias(&lambda.DeleteAliasInput{
+		FunctionName: aws.String(fName),
+		Name:         aws.String(alias),
+	})
+	if err != nil {
+		return decodeAwsError(err)
+	}
+	return nil
+}
+
+// Split "NAME:QUALIFIER" into the function name and the version or alias.
+// The qualifier is empty for plain names and ARNs.
+func splitQualifier(fName string) (string, string) {
+	if strings.HasPrefix(fName, "arn:") {
+		return fName, ""
+	}
+	if i := strings.Index(fName, ":"); i >= 0 {
+		return fName[:i], fName[i+1:]
+	}
+	return fName, ""
+}
@@ -0,0 +1,21 @@
+package awslambda
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitQualifier(t *testing.T) {
+	for _, c := range []struct{ fName, name, qualifier string }{
+		{"echo", "echo", ""},
+		{"echo:prod", "echo", "prod"},
+		{"echo:3", "echo", "3"},
+		{"echo:", "echo", ""},
+		{"arn:aws:lambda:us-west-2:123456789012:function:echo", "arn:aws:lambda:us-west-2:123456789012:function:echo", ""},
+	} {
+		name, qualifier := splitQualifier(c.fName)
+		assert.Equal(t, c.name, name, c.fName)
+		assert.Equal(t, c.qualifier, qualifier, c.fName)
+	}
+}
@@ -3,22 +3,76 @@
 package cfbench
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
+	"net"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/sirupsen/logrus"
+)
+
+// Supported values for ConcurrencySweepArgs.Shape
+const (
+	// begin + step*delta for each step (the default)
+	ShapeLinear = "linear"
+	// begin * 2^step for each step
+	ShapeExponential = "exponential"
+	// linear ramp up for num_steps, then back down to begin
+	ShapeRamp = "ramp"
+	// alternate between begin (for step_duration) and peak (for burst_duration)
+	ShapeSquare = "square"
+	// sinusoid between begin and peak with the given period, sampled every step_duration
+	ShapeSine = "sine"
+	// explicit list of (time, concurrency) points loaded from points_file
+	ShapeFile = "file"
 )
 
+// Upper bound of the concurrency of a sweep, far above what any provider
+// allows
+const maxSweepConcurrency = 1 << 20
+
+// Upper bound of the length of a sweep in seconds
+const maxSweepSeconds = 365 * 24 * 3600
+
 // Implements the Benchmark interface
 type ConcurrencySweepBench struct {
-	params string
+	log logrus.FieldLogger
 }
 
 type ConcurrencySweepArgs struct {
-	Begin        int `json:"begin_concurrency"`
-	Delta        int `json:"delta_concurrency"`
-	Steps        int `json:"num_steps"`
-	StepDuration int `json:"step_duration"`
+	// One of the Shape* constants, defaults to ShapeLinear
+	Shape        string `json:"shape"`
+	Begin        int    `json:"begin_concurrency"`
+	Delta        int    `json:"delta_concurrency"`
+	Steps        int    `json:"num_steps"`
+	StepDuration int    `json:"step_duration"`
+	// Upper concurrency for the square and sine shapes
+	Peak int `json:"peak_concurrency"`
+	// Time (in seconds) spent at peak concurrency for the square shape.
+	// Defaults to step_duration.
+	BurstDuration int `json:"burst_duration"`
+	// Period (in seconds) of the sine shape
+	Period int `json:"period"`
+	// Path to the points file for the file shape. Each line has the form
+	// "seconds,concurrency". Blank lines and lines starting with '#' are
+	// ignored.
+	PointsFile string `json:"points_file"`
+	// Optional mix of functions to invoke. If empty, the benchmark's function
+	// name and arguments are used.
+	Mix WorkloadMix `json:"mix"`
+	// Datasets available to argument templates, mapping names to files with
+	// one item per line
+	Datasets map[string]string `json:"datasets"`
 }
 
 type TransitionPoint struct {
@@ -26,18 +80,130 @@ type TransitionPoint struct {
 	when        time.Duration
 }
 
-func NewConcurrencySweepBench(mode string, params string) *ConcurrencySweepBench {
-	return &ConcurrencySweepBench{
-		params: params,
+// An srk.BenchFactory for the concurrency sweep benchmark
+func NewConcurrencySweep(logger srk.Logger) (srk.Benchmark, error) {
+	return &ConcurrencySweepBench{log: logger}, nil
+}
+
+func (self *ConcurrencySweepBench) RunBench(prov *srk.Provider, args *srk.BenchArgs) error {
+	var params ConcurrencySweepArgs
+	if args.BParams != "" {
+		if err := json.Unmarshal([]byte(args.BParams), &params); err != nil {
+			return errors.Wrap(err, "Failed to parse benchmark parameters")
+		}
+	}
+	if args.TrackingUrl == "" {
+		return errors.New("the concurrency sweep requires a tracking URL")
+	}
+	if args.Output == "" {
+		return errors.New("the concurrency sweep requires an output file")
 	}
+
+	transitions, err := GenSweepTransitions(params)
+	if err != nil {
+		return errors.Wrap(err, "Invalid concurrency sweep definition")
+	}
+
+	datasets, err := LoadDatasets(params.Datasets)
+	if err != nil {
+		return err
+	}
+
+	mix, err := NewWorkloadMix(params.Mix, args.FName, args.FArgs, datasets)
+	if err != nil {
+		return err
+	}
+
+	self.log.Infof("Running concurrency sweep of %d transitions, tracking at %s", len(*transitions), args.TrackingUrl)
+	return ConcurrencySweep(prov.Faas, mix, transitions, args.TrackingUrl, args.Output)
 }
 
-func GenSweepTransitions(args ConcurrencySweepArgs) *[]TransitionPoint {
+// Generate the list of concurrency transitions described by args. Every
+// sweep ends with a transition to zero concurrency.
+func GenSweepTransitions(args ConcurrencySweepArgs) (*[]TransitionPoint, error) {
+	var transitions *[]TransitionPoint
+	if args.Shape == ShapeFile {
+		var err error
+		if transitions, err = loadTransitions(args.PointsFile); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := args.checkSteps(); err != nil {
+			return nil, err
+		}
+		switch args.Shape {
+		case "", ShapeLinear:
+			transitions = genStepTransitions(args, func(step int) int {
+				return args.Begin + step*args.Delta
+			})
+		case ShapeExponential:
+			// begin << (num_steps - 1) must not exceed the maximum
+			if args.Begin <= 0 {
+				return nil, errors.New("the exponential shape requires a positive begin_concurrency")
+			}
+			if args.Steps > 0 && (args.Steps > 21 || args.Begin > maxSweepConcurrency>>uint(args.Steps-1)) {
+				return nil, errors.Errorf("the exponential shape exceeds a concurrency of %d", maxSweepConcurrency)
+			}
+			transitions = genStepTransitions(args, func(step int) int {
+				return args.Begin << uint(step)
+			})
+		case ShapeRamp:
+			transitions = genRampTransitions(args)
+		case ShapeSquare:
+			if args.BurstDuration < 0 {
+				return nil, errors.New("burst_duration must not be negative")
+			}
+			transitions = genSquareTransitions(args)
+		case ShapeSine:
+			if args.Period <= 0 {
+				return nil, errors.New("the sine shape requires a positive period")
+			}
+			transitions = genStepTransitions(args, func(step int) int {
+				phase := 2 * math.Pi * float64(step*args.StepDuration) / float64(args.Period)
+				return args.Begin + int(math.Round(float64(args.Peak-args.Begin)*(1-math.Cos(phase))/2))
+			})
+		default:
+			return nil, errors.Errorf("unrecognized sweep shape '%s'", args.Shape)
+		}
+	}
+
+	for _, t := range *transitions {
+		if t.concurrency < 0 || t.concurrency > maxSweepConcurrency {
+			return nil, errors.Errorf("concurrency %d at %v is outside of [0, %d]", t.concurrency, t.when, maxSweepConcurrency)
+		}
+	}
+	return transitions, nil
+}
+
+// Check the arguments shared by the generated shapes. Steps and durations are
+// bounded so that the levels and times of the transitions can't overflow.
+func (args ConcurrencySweepArgs) checkSteps() error {
+	switch {
+	case args.Steps < 0:
+		return errors.New("num_steps must not be negative")
+	case args.StepDuration <= 0:
+		return errors.New("step_duration must be positive")
+	case args.Begin < 0 || args.Begin > maxSweepConcurrency:
+		return errors.Errorf("begin_concurrency must be in [0, %d]", maxSweepConcurrency)
+	case args.Peak < 0 || args.Peak > maxSweepConcurrency:
+		return errors.Errorf("peak_concurrency must be in [0, %d]", maxSweepConcurrency)
+	case args.Delta < -maxSweepConcurrency || args.Delta > maxSweepConcurrency:
+		return errors.Errorf("delta_concurrency must be in [%d, %d]", -maxSweepConcurrency, maxSweepConcurrency)
+	case args.Steps > maxSweepSeconds || args.StepDuration > maxSweepSeconds || args.BurstDuration > maxSweepSeconds ||
+		2*args.Steps*(args.StepDuration+args.BurstDuration) > maxSweepSeconds:
+		return errors.New("the sweep must not last longer than a year")
+	}
+	return nil
+}
+
+// One transition every StepDuration seconds with the concurrency given by
+// level(step), followed by a final transition to 0.
+func genStepTransitions(args ConcurrencySweepArgs, level func(step int) int) *[]TransitionPoint {
 	transitions := make([]TransitionPoint, 0, args.Steps+1)
 	for step := 0; step < args.Steps; step++ {
 		transitions = append(transitions,
 			TransitionPoint{
-				args.Begin + step*args.Delta,
+				level(step),
 				time.Duration(step*args.StepDuration) * time.Second,
 			})
 	}
@@ -45,7 +211,112 @@ func GenSweepTransitions(args ConcurrencySweepArgs) *[]TransitionPoint {
 	return &transitions
 }
 
-func ConcurrencySweep(functionName string, functionArgs map[string]interface{}, sweepDefinition *[]TransitionPoint, trackingUrl string, logfile string) {
+func genRampTransitions(args ConcurrencySweepArgs) *[]TransitionPoint {
+	upDown := args
+	if args.Steps > 0 {
+		upDown.Steps = 2*args.Steps - 1
+	}
+	return genStepTransitions(upDown, func(step int) int {
+		if step >= args.Steps {
+			step = upDown.Steps - 1 - step
+		}
+		return args.Begin + step*args.Delta
+	})
+}
+
+func genSquareTransitions(args ConcurrencySweepArgs) *[]TransitionPoint {
+	burst := args.BurstDuration
+	if burst == 0 {
+		burst = args.StepDuration
+	}
+	cycle := time.Duration(args.StepDuration+burst) * time.Second
+
+	transitions := make([]TransitionPoint, 0, 2*args.Steps+1)
+	for step := 0; step < args.Steps; step++ {
+		start := time.Duration(step) * cycle
+		transitions = append(transitions,
+			TransitionPoint{args.Begin, start},
+			TransitionPoint{args.Peak, start + time.Duration(args.StepDuration)*time.Second})
+	}
+	transitions = append(transitions, TransitionPoint{0, time.Duration(args.Steps) * cycle})
+	return &transitions
+}
+
+// Read transitions from a file of "seconds,concurrency" lines. The points are
+// sorted by time and the last point must have zero concurrency so that the
+// experiment terminates.
+func loadTransitions(path string) (*[]TransitionPoint, error) {
+	if path == "" {
+		return nil, errors.New("the file shape requires points_file")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open points file %s", path)
+	}
+	defer f.Close()
+
+	transitions := []TransitionPoint{}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 2 {
+			return nil, errors.Errorf("%s:%d: expected 'seconds,concurrency'", path, lineNo)
+		}
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+		if err != nil || !(seconds >= 0 && seconds <= maxSweepSeconds) {
+			return nil, errors.Errorf("%s:%d: invalid time '%s'", path, lineNo, fields[0])
+		}
+		concurrency, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil || concurrency < 0 {
+			return nil, errors.Errorf("%s:%d: invalid concurrency '%s'", path, lineNo, fields[1])
+		}
+		transitions = append(transitions, TransitionPoint{concurrency, time.Duration(seconds * float64(time.Second))})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read points file")
+	}
+
+	if len(transitions) == 0 {
+		return nil, errors.Errorf("%s: no points defined", path)
+	}
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].when < transitions[j].when
+	})
+	if transitions[len(transitions)-1].concurrency != 0 {
+		return nil, errors.Errorf("%s: the last point must have zero concurrency", path)
+	}
+	return &transitions, nil
+}
+
+func ConcurrencySweep(faas srk.FunctionService, mix WorkloadMix, sweepDefinition *[]TransitionPoint, trackingUrl string, logfile string) error {
+	if err := checkReservedArgs(mix); err != nil {
+		return err
+	}
+
+	// The functions report to the tracking URL, so the server listens on its
+	// port
+	tracking, err := url.Parse(trackingUrl)
+	if err != nil || tracking.Port() == "" {
+		return errors.Errorf("tracking URL %s must include a port", trackingUrl)
+	}
+	listener, err := net.Listen("tcp", ":"+tracking.Port())
+	if err != nil {
+		return errors.Wrap(err, "Failed to start the experiment server")
+	}
+
+	f, err := os.OpenFile(logfile, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		listener.Close()
+		return errors.Wrapf(err, "Failed to open %s", logfile)
+	}
+	defer f.Close()
+
 	experimentId := genExperimentId()
 	log.Printf("starting experiment %s", experimentId)
 	progress := newProgress(experimentId)
@@ -56,10 +327,6 @@ func ConcurrencySweep(functionName string, functionArgs map[string]interface{},
 	logWriter := make(chan string)
 	logWriterWorking := make(chan struct{})
 	go func() {
-		f, err := os.OpenFile(logfile, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
-		if err != nil {
-			panic(err)
-		}
 		for s := range logWriter {
 			_, err = fmt.Fprintf(f, "%s\n", s)
 			if err != nil {
@@ -71,11 +338,19 @@ func ConcurrencySweep(functionName string, functionArgs map[string]interface{},
 	}()
 
 	// Start the server and invoke function execution
-	go ExperimentServer(&progress, logWriter, serverWorking)
-	go invokeMulti(experimentId, trackingUrl, functionName, functionArgs, sweepDefinition, &progress)
+	go ExperimentServer(listener, progress, logWriter, serverWorking)
+	results := newFunctionResults()
+	go invokeMulti(experimentId, trackingUrl, faas, mix, sweepDefinition, progress, results)
 
 	<-serverWorking
 
+	summary := results.summary()
+	for fName, counts := range progress.functionCounts() {
+		log.Printf("function %s: invoked %d, completed %d, data %d, failed %d, client-side %v",
+			fName, counts.invoked, counts.completed, counts.data, counts.failed, summary[fName])
+	}
+
 	close(logWriter)
 	<-logWriterWorking
+	return nil
 }
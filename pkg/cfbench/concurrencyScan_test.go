@@ -0,0 +1,101 @@
+package cfbench
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func levels(transitions *[]TransitionPoint) []int {
+	res := make([]int, len(*transitions))
+	for i, t := range *transitions {
+		res[i] = t.concurrency
+	}
+	return res
+}
+
+func TestGenSweepTransitions(t *testing.T) {
+	linear, err := GenSweepTransitions(ConcurrencySweepArgs{Begin: 1, Delta: 2, Steps: 3, StepDuration: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 3, 5, 0}, levels(linear))
+	assert.Equal(t, 30*time.Second, (*linear)[3].when)
+
+	exp, err := GenSweepTransitions(ConcurrencySweepArgs{Shape: ShapeExponential, Begin: 1, Steps: 4, StepDuration: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2, 4, 8, 0}, levels(exp))
+
+	ramp, err := GenSweepTransitions(ConcurrencySweepArgs{Shape: ShapeRamp, Begin: 1, Delta: 1, Steps: 3, StepDuration: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2, 3, 2, 1, 0}, levels(ramp))
+	assert.Equal(t, 5*time.Second, (*ramp)[5].when)
+
+	square, err := GenSweepTransitions(ConcurrencySweepArgs{Shape: ShapeSquare, Begin: 1, Peak: 10, Steps: 2, StepDuration: 5, BurstDuration: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 10, 1, 10, 0}, levels(square))
+	assert.Equal(t, 6*time.Second, (*square)[2].when)
+	assert.Equal(t, 12*time.Second, (*square)[4].when)
+
+	sine, err := GenSweepTransitions(ConcurrencySweepArgs{Shape: ShapeSine, Begin: 2, Peak: 10, Period: 4, Steps: 5, StepDuration: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2, 6, 10, 6, 2, 0}, levels(sine))
+
+	_, err = GenSweepTransitions(ConcurrencySweepArgs{Shape: ShapeSine, Steps: 1})
+	assert.NotNil(t, err)
+
+	_, err = GenSweepTransitions(ConcurrencySweepArgs{Shape: "zigzag", StepDuration: 1})
+	assert.NotNil(t, err)
+}
+
+func TestGenSweepTransitionsInvalid(t *testing.T) {
+	for _, args := range []ConcurrencySweepArgs{
+		{Begin: 1, Steps: -1, StepDuration: 1},
+		{Begin: 1, Steps: 2, StepDuration: -1},
+		{Begin: 1, Steps: 2},
+		{Begin: -1, Steps: 2, StepDuration: 1},
+		// drops below zero
+		{Begin: 1, Delta: -1, Steps: 3, StepDuration: 1},
+		{Shape: ShapeExponential, Begin: 0, Steps: 3, StepDuration: 1},
+		// would overflow
+		{Shape: ShapeExponential, Begin: 1, Steps: 70, StepDuration: 1},
+		{Shape: ShapeExponential, Begin: 1 << 10, Steps: 12, StepDuration: 1},
+		{Shape: ShapeSquare, Begin: 1, Peak: 2, Steps: 1, StepDuration: 1, BurstDuration: -1},
+		{Shape: ShapeRamp, Begin: 1, Delta: 1, Steps: 2, StepDuration: maxSweepSeconds},
+	} {
+		_, err := GenSweepTransitions(args)
+		assert.NotNil(t, err, "%+v", args)
+	}
+
+	_, err := GenSweepTransitions(ConcurrencySweepArgs{Shape: ShapeExponential, Begin: 1 << 10, Steps: 11, StepDuration: 1})
+	assert.Nil(t, err)
+}
+
+func TestLoadTransitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-sweep")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	points := filepath.Join(dir, "points.csv")
+	assert.Nil(t, ioutil.WriteFile(points, []byte("# time,concurrency\n0,5\n\n10, 0\n2.5,20\n"), 0644))
+
+	transitions, err := GenSweepTransitions(ConcurrencySweepArgs{Shape: ShapeFile, PointsFile: points})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{5, 20, 0}, levels(transitions))
+	assert.Equal(t, 2500*time.Millisecond, (*transitions)[1].when)
+
+	unterminated := filepath.Join(dir, "unterminated.csv")
+	assert.Nil(t, ioutil.WriteFile(unterminated, []byte("0,5\n"), 0644))
+	_, err = GenSweepTransitions(ConcurrencySweepArgs{Shape: ShapeFile, PointsFile: unterminated})
+	assert.NotNil(t, err)
+
+	_, err = GenSweepTransitions(ConcurrencySweepArgs{Shape: ShapeFile})
+	assert.NotNil(t, err)
+
+	negative := filepath.Join(dir, "negative.csv")
+	assert.Nil(t, ioutil.WriteFile(negative, []byte("0,-5\n1,0\n"), 0644))
+	_, err = GenSweepTransitions(ConcurrencySweepArgs{Shape: ShapeFile, PointsFile: negative})
+	assert.NotNil(t, err)
+}
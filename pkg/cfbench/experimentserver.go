@@ -6,35 +6,31 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 )
 
-func ExperimentServer(progress *progress, logWriter chan string, alldone chan struct{}) {
-	var srv = http.Server{Addr: ":3000"}
-	var shutdownRequested = make(chan struct{})
+// Serve the progress reports of the functions on listener until all
+// invocations are done and reported, then close alldone
+func ExperimentServer(listener net.Listener, progress *progress, logWriter chan string, alldone chan struct{}) {
+	mux := http.NewServeMux()
+	var srv = http.Server{Handler: mux}
 	go func() {
-		<-shutdownRequested
+		<-progress.finished
 		if err := srv.Shutdown(context.Background()); err != nil {
 			log.Printf("HTTP server shutdown error: %v", err)
 		}
 		close(alldone)
 	}()
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, err := fmt.Fprintf(w, "Serverless Experiment Controller")
 		if err != nil {
 			log.Fatal(err)
 		}
 	})
 
-	checkAllDone := func() {
-		if progress.allDone() {
-			log.Printf("finished processing responses for experiment %s", progress.experimentId)
-			close(shutdownRequested)
-		}
-	}
-
-	http.HandleFunc("/event", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/event", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
 			body, err := ioutil.ReadAll(r.Body)
@@ -53,7 +49,6 @@ func ExperimentServer(progress *progress, logWriter chan string, alldone chan st
 				progress.setRunning(data["uuid"].(string))
 			case "end":
 				progress.setDone(data["uuid"].(string))
-				checkAllDone()
 			}
 			//log.Print(data)
 			_, err = fmt.Fprintf(w, "Thanks for the event.")
@@ -65,7 +60,7 @@ func ExperimentServer(progress *progress, logWriter chan string, alldone chan st
 		}
 	})
 
-	http.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
 			body, err := ioutil.ReadAll(r.Body)
@@ -81,7 +76,6 @@ func ExperimentServer(progress *progress, logWriter chan string, alldone chan st
 			}
 			progress.setData(data["uuid"].(string))
 			//log.Print(data)
-			checkAllDone()
 			_, err = fmt.Fprintf(w, "Thanks for the data.")
 			if err != nil {
 				log.Fatal(err)
@@ -92,7 +86,7 @@ func ExperimentServer(progress *progress, logWriter chan string, alldone chan st
 	})
 
 	log.Print("starting server")
-	if err := srv.ListenAndServe(); err != nil {
+	if err := srv.Serve(listener); err != nil {
 		switch err {
 		case http.ErrServerClosed:
 			log.Printf("server shutting down")
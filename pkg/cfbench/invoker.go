@@ -6,13 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	mrand "math/rand"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
 )
 
 func genExperimentId() string {
@@ -44,17 +44,28 @@ func (s *stringSet) size() int {
 	return len(*s)
 }
 
+// Invocation counts for a single function of the workload mix
+type functionProgress struct {
+	invoked, completed, data, failed int
+}
+
 type progress struct {
 	updateNotice                                  chan bool
 	experimentId                                  string
 	seqId                                         int
 	pendingSet, runningSet, completedSet, dataSet stringSet
 	invocationDone                                bool
-	m                                             sync.Mutex
+	// Function name of each invocation, keyed by uuid
+	functions   map[string]string
+	perFunction map[string]*functionProgress
+	// Closed once all invocations are done and reported
+	finished     chan struct{}
+	finishedOnce sync.Once
+	m            sync.Mutex
 }
 
-func newProgress(experimentId string) progress {
-	p := progress{}
+func newProgress(experimentId string) *progress {
+	p := &progress{}
 	p.updateNotice = make(chan bool)
 	p.experimentId = experimentId
 	p.seqId = 1
@@ -62,9 +73,23 @@ func newProgress(experimentId string) progress {
 	p.runningSet = make(stringSet)
 	p.completedSet = make(stringSet)
 	p.dataSet = make(stringSet)
+	p.functions = make(map[string]string)
+	p.perFunction = make(map[string]*functionProgress)
+	p.finished = make(chan struct{})
 	return p
 }
 
+// Must be called with p.m held
+func (p *progress) functionOf(uuid string) *functionProgress {
+	fName := p.functions[uuid]
+	fp, exists := p.perFunction[fName]
+	if !exists {
+		fp = &functionProgress{}
+		p.perFunction[fName] = fp
+	}
+	return fp
+}
+
 func (p *progress) nextInvocationSeq() int {
 	p.m.Lock()
 	id := p.seqId
@@ -73,21 +98,38 @@ func (p *progress) nextInvocationSeq() int {
 	return id
 }
 
-func (p *progress) setInvoked(uuid string) {
+func (p *progress) setInvoked(uuid string, fName string) {
 	p.m.Lock()
 	if !strings.HasPrefix(uuid, p.experimentId) {
 		panic("invalid invocation")
 	}
 	if !p.pendingSet.contains(uuid) {
 		p.pendingSet.add(uuid)
+		p.functions[uuid] = fName
+		p.functionOf(uuid).invoked++
 	}
 	p.m.Unlock()
 }
 
+// Must only be called once no more invocations are started or running
 func (p *progress) setInovcationDone() {
 	p.m.Lock()
 	p.invocationDone = true
 	p.m.Unlock()
+	p.checkDone()
+}
+
+// An invocation failed, the function may never report its progress
+func (p *progress) setFailed(uuid string) {
+	p.m.Lock()
+	if p.pendingSet.contains(uuid) || p.runningSet.contains(uuid) {
+		p.pendingSet.remove(uuid)
+		p.runningSet.remove(uuid)
+		p.functionOf(uuid).failed++
+	}
+	p.m.Unlock()
+	p.checkDone()
+	p.updateNotice <- true
 }
 
 func (p *progress) setRunning(uuid string) {
@@ -105,11 +147,13 @@ func (p *progress) setDone(uuid string) {
 	if strings.HasPrefix(uuid, p.experimentId) && p.runningSet.contains(uuid) {
 		p.runningSet.remove(uuid)
 		p.completedSet.add(uuid)
+		p.functionOf(uuid).completed++
 	}
 	pending, running, completed, data := p.pendingSet.size(), p.runningSet.size(), p.completedSet.size(), p.dataSet.size()
 	invocationDone := p.invocationDone
 	p.m.Unlock()
 	log.Printf("progress now [%d %d %d %d %t]", pending, running, completed, data, invocationDone)
+	p.checkDone()
 	p.updateNotice <- true
 }
 
@@ -117,19 +161,42 @@ func (p *progress) setData(uuid string) {
 	p.m.Lock()
 	if strings.HasPrefix(uuid, p.experimentId) && !p.dataSet.contains(uuid) {
 		p.dataSet.add(uuid)
+		p.functionOf(uuid).data++
 	}
 	p.m.Unlock()
+	p.checkDone()
 }
 
 func (p *progress) allDone() bool {
 	p.m.Lock()
-	done := p.invocationDone && p.pendingSet.size() == 0 && p.runningSet.size() == 0 && p.completedSet.size() != 0 &&
+	done := p.invocationDone && p.pendingSet.size() == 0 && p.runningSet.size() == 0 &&
 		p.completedSet.size() == p.dataSet.size()
 	p.m.Unlock()
 	//log.Printf("Done check found %t", done)
 	return done
 }
 
+// Close p.finished if all invocations are done and reported
+func (p *progress) checkDone() {
+	if p.allDone() {
+		p.finishedOnce.Do(func() {
+			log.Printf("finished processing responses for experiment %s", p.experimentId)
+			close(p.finished)
+		})
+	}
+}
+
+// Returns a copy of the per-function invocation counts
+func (p *progress) functionCounts() map[string]functionProgress {
+	p.m.Lock()
+	counts := make(map[string]functionProgress, len(p.perFunction))
+	for fName, fp := range p.perFunction {
+		counts[fName] = *fp
+	}
+	p.m.Unlock()
+	return counts
+}
+
 func (p *progress) getConcurrency() int {
 	p.m.Lock()
 	concurrency := p.pendingSet.size() + p.runningSet.size()
@@ -137,36 +204,104 @@ func (p *progress) getConcurrency() int {
 	return concurrency
 }
 
-func invokeMulti(experimentId string, trackingUrl string, functionName string, functionArgs map[string]interface{}, sweepDefinition *[]TransitionPoint, progress *progress) {
-	sess := session.Must(session.NewSession())
-	client := lambda.New(sess, &aws.Config{Region: aws.String("us-west-2")})
+// Arguments that the sweep adds to every invocation for progress tracking
+var reservedArgs = []string{"uuid", "experimentId", "tracking_url"}
 
-	invoke := func(n int) {
-		for i := 0; i < n; i++ {
-			invocationId := progress.nextInvocationSeq()
-			uuid := fmt.Sprintf("%s:%d", experimentId, invocationId)
-			args := map[string]interface{}{
-				"uuid":         uuid,
-				"experimentId": experimentId,
-				"tracking_url": trackingUrl,
-			}
-			for k, v := range functionArgs {
-				if _, exists := args[k]; !exists {
-					args[k] = v
-				} else {
-					panic("argument conflict")
-				}
+// Make sure that no entry of the mix sets one of the tracking arguments
+func checkReservedArgs(mix WorkloadMix) error {
+	for i := range mix {
+		args, err := mix[i].template.RenderMap(TemplateVars{Seq: 0, UUID: "", Function: mix[i].FName})
+		if err != nil {
+			return errors.Wrapf(err, "invalid arguments for %s", mix[i].FName)
+		}
+		for _, key := range reservedArgs {
+			if _, exists := args[key]; exists {
+				return errors.Errorf("argument '%s' of %s conflicts with the tracking arguments", key, mix[i].FName)
 			}
-			payload, err := json.Marshal(args)
+		}
+	}
+	return nil
+}
+
+// Invoke the functions of mix through faas following the sweep definition.
+// Rated entries are invoked at their own rate until the sweep ends. Client-side
+// latencies and errors are recorded in results.
+func invokeMulti(experimentId string, trackingUrl string, faas srk.FunctionService, mix WorkloadMix, sweepDefinition *[]TransitionPoint, progress *progress, results *functionResults) {
+	r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
+
+	// Rated entries and invocations in flight, invocations are only done
+	// once all of them returned
+	var inFlight sync.WaitGroup
+
+	invokeOne := func(entry *WorkloadEntry) {
+		invocationId := progress.nextInvocationSeq()
+		uuid := fmt.Sprintf("%s:%d", experimentId, invocationId)
+		args, err := entry.template.RenderMap(TemplateVars{Seq: invocationId, UUID: uuid, Function: entry.FName})
+		if err != nil {
+			log.Printf("skipping invocation of %s: %v", entry.FName, err)
+			results.record(entry.FName, 0, err)
+			return
+		}
+		if args == nil {
+			// entries without arguments
+			args = make(map[string]interface{})
+		}
+		// The tracking arguments always take precedence (see checkReservedArgs)
+		args["uuid"] = uuid
+		args["experimentId"] = experimentId
+		args["tracking_url"] = trackingUrl
+		payload, err := json.Marshal(args)
+		if err != nil {
+			log.Printf("skipping invocation of %s: %v", entry.FName, err)
+			results.record(entry.FName, 0, err)
+			return
+		}
 
-			_, err = client.Invoke(&lambda.InvokeInput{FunctionName: aws.String(functionName), Payload: payload, InvocationType: aws.String("Event")})
+		// Counted before the invocation starts so that the concurrency is
+		// not exceeded while it runs
+		progress.setInvoked(uuid, entry.FName)
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			start := time.Now()
+			_, err := faas.Invoke(entry.FName, string(payload))
+			results.record(entry.FName, time.Since(start), err)
 			if err != nil {
-				log.Fatal("Error invoking function", err)
+				log.Printf("invocation of %s failed: %v", entry.FName, err)
+				progress.setFailed(uuid)
 			}
-			progress.setInvoked(uuid)
+		}()
+	}
+
+	invoke := func(n int) {
+		for i := 0; i < n; i++ {
+			entry := mix.pick(r)
+			if entry == nil {
+				return
+			}
+			invokeOne(entry)
 		}
 	}
 
+	// Open-loop entries are invoked at their own rate until the sweep ends
+	stopRated := make(chan struct{})
+	for _, entry := range mix.rated() {
+		inFlight.Add(1)
+		go func(entry *WorkloadEntry) {
+			defer inFlight.Done()
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / entry.Rate))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopRated:
+					return
+				case <-ticker.C:
+					invokeOne(entry)
+				}
+			}
+		}(entry)
+	}
+
 	go func() {
 		nextIndex := 0
 		var targetConcurrency int
@@ -191,7 +326,13 @@ func invokeMulti(experimentId string, trackingUrl string, functionName string, f
 					invoke(targetConcurrency - launched)
 				}
 				if nextIndex >= len(*sweepDefinition) {
-					progress.setInovcationDone()
+					close(stopRated)
+					// Keep handling updates while the rated entries stop
+					// and the last invocations return
+					go func() {
+						inFlight.Wait()
+						progress.setInovcationDone()
+					}()
 				}
 			}
 		}
@@ -0,0 +1,75 @@
+package cfbench
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A function service whose functions report their progress like functions
+// using the cfbench library do
+type trackingService struct {
+	*countingService
+	progress *progress
+}
+
+func (s *trackingService) Invoke(fName string, args string) (*srk.InvokeResult, error) {
+	resp, err := s.countingService.Invoke(fName, args)
+	if err == nil {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(args), &parsed); err != nil {
+			return nil, err
+		}
+		uuid := parsed["uuid"].(string)
+		s.progress.setRunning(uuid)
+		s.progress.setData(uuid)
+		s.progress.setDone(uuid)
+	}
+	return resp, err
+}
+
+// Run with -race: rated entries must not touch the progress once the
+// invocations are done
+func TestInvokeMulti(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	p := newProgress("experiment")
+	service := &trackingService{countingService: &countingService{counts: make(map[string]int)}, progress: p}
+	mix, err := NewWorkloadMix(WorkloadMix{
+		{FName: "echo", Weight: 1},
+		{FName: "rated", Rate: 1000},
+		{FName: "broken", Rate: 200},
+	}, "", "", nil)
+	require.Nil(t, err)
+	sweep := []TransitionPoint{{2, 0}, {0, 100 * time.Millisecond}}
+	results := newFunctionResults()
+
+	invokeMulti("experiment", "http://localhost:3000/", service, mix, &sweep, p, results)
+	select {
+	case <-p.finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the invocations did not finish")
+	}
+
+	counts := p.functionCounts()
+	summary := results.summary()
+	service.m.Lock()
+	defer service.m.Unlock()
+	assert.Len(t, service.counts, 3)
+	for fName, n := range service.counts {
+		assert.Equal(t, n, counts[fName].invoked, fName)
+		assert.Equal(t, float64(n), summary[fName]["invocations"], fName)
+	}
+	assert.Equal(t, counts["echo"].invoked, counts["echo"].completed)
+	assert.Equal(t, counts["rated"].invoked, counts["rated"].data)
+	assert.Equal(t, counts["broken"].invoked, counts["broken"].failed)
+	assert.Equal(t, float64(counts["broken"].invoked), summary["broken"]["errors"])
+}
@@ -0,0 +1,149 @@
+// The workload mix benchmark (implements the srk.Benchmark interface). Several
+// functions are invoked concurrently through the provider's function service
+// so that their interference can be measured. Results are reported per
+// function.
+package cfbench
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/sirupsen/logrus"
+)
+
+type MixArgs struct {
+	Mix WorkloadMix `json:"mix"`
+	// Number of closed-loop clients invoking weighted entries
+	Concurrency int `json:"concurrency"`
+	// Length of the run in seconds
+	Duration int `json:"duration"`
+	// Datasets available to argument templates, mapping names to files with
+	// one item per line
+	Datasets map[string]string `json:"datasets"`
+}
+
+type mixBench struct {
+	log logrus.FieldLogger
+}
+
+// An srk.BenchFactory for the workload mix benchmark
+func NewMix(logger srk.Logger) (srk.Benchmark, error) {
+	return &mixBench{log: logger}, nil
+}
+
+func (self *mixBench) RunBench(prov *srk.Provider, args *srk.BenchArgs) error {
+	var params MixArgs
+	if args.BParams != "" {
+		if err := json.Unmarshal([]byte(args.BParams), &params); err != nil {
+			return errors.Wrap(err, "Failed to parse benchmark parameters")
+		}
+	}
+	if params.Concurrency <= 0 {
+		params.Concurrency = 1
+	}
+	if params.Duration <= 0 {
+		return errors.New("benchmark parameter 'duration' must be positive")
+	}
+
+	datasets, err := LoadDatasets(params.Datasets)
+	if err != nil {
+		return err
+	}
+
+	mix, err := NewWorkloadMix(params.Mix, args.FName, args.FArgs, datasets)
+	if err != nil {
+		return err
+	}
+
+	results := newFunctionResults()
+	var seq int64
+	invoke := func(entry *WorkloadEntry) {
+		payload, err := entry.renderArgs(int(atomic.AddInt64(&seq, 1)), genUUID())
+		if err != nil {
+			self.log.Warnf("Skipping invocation of %s: %v", entry.FName, err)
+			results.record(entry.FName, 0, err)
+			return
+		}
+
+		start := time.Now()
+		_, err = prov.Faas.Invoke(entry.FName, payload)
+		if err != nil {
+			self.log.Debugf("Invocation of %s failed: %v", entry.FName, err)
+		}
+		results.record(entry.FName, time.Since(start), err)
+	}
+
+	self.log.Infof("Running workload mix of %d functions for %ds", len(mix), params.Duration)
+	deadline := time.Now().Add(time.Duration(params.Duration) * time.Second)
+	var wg sync.WaitGroup
+
+	// Closed-loop clients
+	for c := 0; c < params.Concurrency; c++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for time.Now().Before(deadline) {
+				entry := mix.pick(r)
+				if entry == nil {
+					return
+				}
+				invoke(entry)
+			}
+		}(time.Now().UnixNano() + int64(c))
+	}
+
+	// Open-loop entries
+	for _, entry := range mix.rated() {
+		wg.Add(1)
+		go func(entry *WorkloadEntry) {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / entry.Rate))
+			defer ticker.Stop()
+			for now := range ticker.C {
+				if !now.Before(deadline) {
+					return
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					invoke(entry)
+				}()
+			}
+		}(entry)
+	}
+
+	wg.Wait()
+
+	summary := results.summary()
+	for fName, stats := range summary {
+		self.log.WithFields(logrus.Fields(toFields(stats))).Infof("Function %s", fName)
+	}
+
+	if args.Output != "" {
+		out, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "Failed to encode results")
+		}
+		if err := ioutil.WriteFile(args.Output, out, 0644); err != nil {
+			return errors.Wrapf(err, "Failed to write result to %s", args.Output)
+		}
+		self.log.Infof("Saved result to %s", args.Output)
+	}
+
+	return nil
+}
+
+func toFields(stats map[string]float64) map[string]interface{} {
+	fields := make(map[string]interface{}, len(stats))
+	for k, v := range stats {
+		fields[k] = v
+	}
+	return fields
+}
@@ -3,6 +3,7 @@
 package cfbench
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"time"
 
@@ -11,6 +12,12 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+type oneShotArgs struct {
+	// Datasets available to the argument template, mapping names to files
+	// with one item per line
+	Datasets map[string]string `json:"datasets"`
+}
+
 type oneShotBench struct {
 	log logrus.FieldLogger
 }
@@ -21,20 +28,45 @@ func NewOneShot(logger srk.Logger) (srk.Benchmark, error) {
 }
 
 func (self *oneShotBench) RunBench(prov *srk.Provider, args *srk.BenchArgs) error {
-	self.log.Infof("Invoking: %s(%s)", args.FName, args.FArgs)
+	var params oneShotArgs
+	if args.BParams != "" {
+		if err := json.Unmarshal([]byte(args.BParams), &params); err != nil {
+			return errors.Wrap(err, "Failed to parse benchmark parameters")
+		}
+	}
+
+	datasets, err := LoadDatasets(params.Datasets)
+	if err != nil {
+		return err
+	}
+
+	fArgs := args.FArgs
+	if fArgs != "" {
+		tmpl, err := NewArgsTemplate(fArgs, datasets)
+		if err != nil {
+			return err
+		}
+
+		fArgs, err = tmpl.Render(TemplateVars{Seq: 1, UUID: genUUID(), Function: args.FName})
+		if err != nil {
+			return err
+		}
+	}
+
+	self.log.Infof("Invoking: %s(%s)", args.FName, fArgs)
 	start := time.Now()
-	resp, err := prov.Faas.Invoke(args.FName, args.FArgs)
+	resp, err := prov.Faas.Invoke(args.FName, fArgs)
 	if err != nil {
-		return errors.Wrapf(err, "Failed to invoke %s(%s)", args.FName, args.FArgs)
+		return errors.Wrapf(err, "Failed to invoke %s(%s)", args.FName, fArgs)
 	}
 
 	stats, err := prov.Faas.ReportStats()
 	if err != nil {
-		return errors.Wrapf(err, "Failed to gather statistics about %s(%s)", args.FName, args.FArgs)
+		return errors.Wrapf(err, "Failed to gather statistics about %s(%s)", args.FName, fArgs)
 	}
 
 	if err = prov.Faas.ResetStats(); err != nil {
-		return errors.Wrapf(err, "Failed to reset statistics for %s(%s)", args.FName, args.FArgs)
+		return errors.Wrapf(err, "Failed to reset statistics for %s(%s)", args.FName, fArgs)
 	}
 
 	if len(stats) > 0 {
@@ -44,10 +76,19 @@ func (self *oneShotBench) RunBench(prov *srk.Provider, args *srk.BenchArgs) erro
 		}
 	}
 
-	self.log.WithFields(logrus.Fields{"time": time.Since(start)}).Infof("Function complete: %s", resp.String())
+	fields := logrus.Fields{
+		"time":      time.Since(start),
+		"status":    resp.Status,
+		"connect":   resp.Timing.Connect,
+		"firstByte": resp.Timing.FirstByte,
+	}
+	for k, v := range resp.Metadata {
+		fields[k] = v
+	}
+	self.log.WithFields(fields).Infof("Function complete: %s", resp.String())
 
 	if args.Output != "" {
-		if err := ioutil.WriteFile(args.Output, resp.Bytes(), 0644); err != nil {
+		if err := ioutil.WriteFile(args.Output, resp.Body, 0644); err != nil {
 			return errors.Wrapf(err, "Failed to write result to %s", args.Output)
 		}
 		self.log.Infof("Saved result to %s", args.Output)
@@ -0,0 +1,209 @@
+// Function argument templates. Arguments are rendered with text/template for
+// every invocation so that each invocation can receive different inputs.
+//
+// Available variables:
+//
+//	.Seq       sequence number of the invocation (starting at 1)
+//	.UUID      unique identifier of the invocation
+//	.Function  name of the invoked function
+//
+// Available functions:
+//
+//	uniform MIN MAX        random float in [MIN, MAX)
+//	randint MIN MAX        random integer in [MIN, MAX]
+//	normal MEAN STDDEV     normally distributed random float
+//	exponential MEAN       exponentially distributed random float
+//	choice A B ...         one of the arguments at random
+//	sample DATASET         random item from a dataset
+//	item DATASET N         item N (modulo the dataset size) from a dataset
+//	json VALUE             VALUE encoded as JSON (e.g. a quoted and escaped string)
+//
+// Strings should be inserted with json, quotes or backslashes in them would
+// otherwise break the JSON of the arguments.
+//
+// For example: {"id": {{json .UUID}}, "size": {{randint 1 100}}, "image": {{json (item "images" .Seq)}}}
+package cfbench
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Per-invocation variables available to argument templates
+type TemplateVars struct {
+	Seq      int
+	UUID     string
+	Function string
+}
+
+// A compiled argument template. Safe for concurrent use.
+type ArgsTemplate struct {
+	tmpl *template.Template
+	// math/rand.Rand is not safe for concurrent use
+	m sync.Mutex
+	r *mrand.Rand
+}
+
+// Compile an argument template. datasets maps dataset names (as used by the
+// sample and item functions) to their items and may be nil.
+func NewArgsTemplate(text string, datasets map[string][]string) (*ArgsTemplate, error) {
+	t := &ArgsTemplate{r: mrand.New(mrand.NewSource(time.Now().UnixNano()))}
+
+	getDataset := func(name string) ([]string, error) {
+		items, exists := datasets[name]
+		if !exists || len(items) == 0 {
+			return nil, fmt.Errorf("unknown or empty dataset '%s'", name)
+		}
+		return items, nil
+	}
+
+	funcs := template.FuncMap{
+		"uniform": func(min, max float64) float64 {
+			return min + t.float64()*(max-min)
+		},
+		"randint": func(min, max int) (int, error) {
+			if max < min {
+				return 0, fmt.Errorf("randint: max %d is less than min %d", max, min)
+			}
+			return min + t.intn(max-min+1), nil
+		},
+		"normal": func(mean, stddev float64) float64 {
+			t.m.Lock()
+			defer t.m.Unlock()
+			return mean + t.r.NormFloat64()*stddev
+		},
+		"exponential": func(mean float64) float64 {
+			t.m.Lock()
+			defer t.m.Unlock()
+			return t.r.ExpFloat64() * mean
+		},
+		"choice": func(items ...interface{}) (interface{}, error) {
+			if len(items) == 0 {
+				return nil, errors.New("choice requires at least one argument")
+			}
+			return items[t.intn(len(items))], nil
+		},
+		"sample": func(name string) (string, error) {
+			items, err := getDataset(name)
+			if err != nil {
+				return "", err
+			}
+			return items[t.intn(len(items))], nil
+		},
+		"item": func(name string, n int) (string, error) {
+			items, err := getDataset(name)
+			if err != nil {
+				return "", err
+			}
+			return items[((n%len(items))+len(items))%len(items)], nil
+		},
+		"json": func(v interface{}) (string, error) {
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return string(encoded), nil
+		},
+	}
+
+	tmpl, err := template.New("args").Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid argument template")
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+func (t *ArgsTemplate) float64() float64 {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.r.Float64()
+}
+
+func (t *ArgsTemplate) intn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.r.Intn(n)
+}
+
+// Render the arguments for a single invocation. The result must be valid
+// JSON.
+func (t *ArgsTemplate) Render(vars TemplateVars) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, vars); err != nil {
+		return "", errors.Wrap(err, "failed to render argument template")
+	}
+	if !json.Valid(buf.Bytes()) {
+		return "", fmt.Errorf("argument template rendered invalid JSON: %s", buf.String())
+	}
+	return buf.String(), nil
+}
+
+// Render the arguments for a single invocation and decode them as a JSON
+// object.
+func (t *ArgsTemplate) RenderMap(vars TemplateVars) (map[string]interface{}, error) {
+	rendered, err := t.Render(vars)
+	if err != nil {
+		return nil, err
+	}
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(rendered), &args); err != nil {
+		return nil, errors.Wrap(err, "function arguments must be a JSON object")
+	}
+	return args, nil
+}
+
+// Load datasets from files, one item per non-empty line. paths maps dataset
+// names to file paths.
+func LoadDatasets(paths map[string]string) (map[string][]string, error) {
+	datasets := make(map[string][]string, len(paths))
+	for name, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open dataset '%s'", name)
+		}
+
+		items := []string{}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				items = append(items, line)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read dataset '%s'", name)
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("dataset '%s' (%s) is empty", name, path)
+		}
+		datasets[name] = items
+	}
+	return datasets, nil
+}
+
+// Generate a random (version 4) UUID
+func genUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,93 @@
+package cfbench
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArgsTemplate(t *testing.T) {
+	datasets := map[string][]string{"images": {"a.jpg", "b.jpg", "c.jpg"}}
+	tmpl, err := NewArgsTemplate(`{"seq": {{.Seq}}, "id": "{{.UUID}}", "fn": "{{.Function}}", "image": "{{item "images" .Seq}}"}`, datasets)
+	assert.Nil(t, err)
+
+	args, err := tmpl.RenderMap(TemplateVars{Seq: 4, UUID: "abc", Function: "echo"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"seq": 4.0, "id": "abc", "fn": "echo", "image": "b.jpg"}, args)
+
+	// strings with quotes and backslashes keep the JSON valid
+	quoted, err := NewArgsTemplate(`{"c": {{json (choice "say \"hi\"" "C:\\dir")}}, "i": {{json (item "paths" .Seq)}}}`,
+		map[string][]string{"paths": {`a"b\c`}})
+	assert.Nil(t, err)
+	args, err = quoted.RenderMap(TemplateVars{Seq: 1})
+	assert.Nil(t, err)
+	assert.Contains(t, []string{`say "hi"`, `C:\dir`}, args["c"])
+	assert.Equal(t, `a"b\c`, args["i"])
+
+	random, err := NewArgsTemplate(`{"u": {{uniform 1 2}}, "i": {{randint 3 3}}, "n": {{normal 0 1}}, "e": {{exponential 1}}, "c": "{{choice "x" "y"}}", "s": "{{sample "images"}}"}`, datasets)
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		args, err := random.RenderMap(TemplateVars{Seq: i})
+		assert.Nil(t, err)
+		assert.True(t, args["u"].(float64) >= 1 && args["u"].(float64) < 2)
+		assert.Equal(t, 3.0, args["i"])
+		assert.True(t, args["e"].(float64) >= 0)
+		assert.Contains(t, []string{"x", "y"}, args["c"])
+		assert.Contains(t, datasets["images"], args["s"])
+	}
+}
+
+func TestArgsTemplateErrors(t *testing.T) {
+	_, err := NewArgsTemplate(`{{`, nil)
+	assert.NotNil(t, err)
+
+	unknown, err := NewArgsTemplate(`{"s": "{{sample "missing"}}"}`, nil)
+	assert.Nil(t, err)
+	_, err = unknown.Render(TemplateVars{})
+	assert.NotNil(t, err)
+
+	invalid, err := NewArgsTemplate(`{"id": {{.UUID}}}`, nil)
+	assert.Nil(t, err)
+	_, err = invalid.Render(TemplateVars{UUID: "not-quoted"})
+	assert.NotNil(t, err)
+
+	reversed, err := NewArgsTemplate(`{"i": {{randint 5 1}}}`, nil)
+	assert.Nil(t, err)
+	_, err = reversed.Render(TemplateVars{})
+	assert.NotNil(t, err)
+
+	notObject, err := NewArgsTemplate(`[1, 2]`, nil)
+	assert.Nil(t, err)
+	_, err = notObject.RenderMap(TemplateVars{})
+	assert.NotNil(t, err)
+}
+
+func TestLoadDatasets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-dataset")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "images.txt")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("a.jpg\n\n  b.jpg \n"), 0644))
+	datasets, err := LoadDatasets(map[string]string{"images": path})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"images": {"a.jpg", "b.jpg"}}, datasets)
+
+	empty := filepath.Join(dir, "empty.txt")
+	assert.Nil(t, ioutil.WriteFile(empty, []byte("\n"), 0644))
+	_, err = LoadDatasets(map[string]string{"empty": empty})
+	assert.NotNil(t, err)
+
+	_, err = LoadDatasets(map[string]string{"missing": filepath.Join(dir, "missing.txt")})
+	assert.NotNil(t, err)
+}
+
+func TestGenUUID(t *testing.T) {
+	id := genUUID()
+	assert.Len(t, id, 36)
+	assert.Equal(t, byte('4'), id[14])
+	assert.NotEqual(t, id, genUUID())
+}
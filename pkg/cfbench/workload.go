@@ -0,0 +1,209 @@
+// Workload mixes describe several functions that are invoked together in a
+// single benchmark run.
+package cfbench
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+)
+
+// Bounds of the open-loop rate of an entry (invocations per second). The
+// interval between invocations must be representable as a time.Duration and
+// be at least a microsecond.
+const (
+	minRate = 1e-6
+	maxRate = 1e6
+)
+
+// A single function in a workload mix
+type WorkloadEntry struct {
+	FName string `json:"function_name"`
+	// JSON object used as the function arguments
+	FArgs map[string]interface{} `json:"function_args"`
+	// Argument template rendered for every invocation (see ArgsTemplate).
+	// Takes precedence over function_args.
+	ArgsTemplate string `json:"args_template"`
+	// Relative share of the closed-loop (concurrency-driven) invocations
+	Weight float64 `json:"weight"`
+	// Open-loop invocations per second, issued independently of the weight
+	Rate float64 `json:"rate"`
+
+	template *ArgsTemplate
+}
+
+type WorkloadMix []WorkloadEntry
+
+// NewWorkloadMix returns mix if it is non-empty, otherwise a single-function
+// mix built from fName and the argument template fArgs. Entries with neither
+// a weight nor a rate get a weight of 1. The argument template of every entry
+// is compiled against datasets (which may be nil).
+func NewWorkloadMix(mix WorkloadMix, fName string, fArgs string, datasets map[string][]string) (WorkloadMix, error) {
+	if len(mix) == 0 {
+		if fName == "" {
+			return nil, errors.New("either a function name or a workload mix is required")
+		}
+		if fArgs == "" {
+			fArgs = "{}"
+		}
+		mix = WorkloadMix{{FName: fName, ArgsTemplate: fArgs}}
+	}
+
+	res := make(WorkloadMix, len(mix))
+	for i, entry := range mix {
+		if entry.FName == "" {
+			return nil, errors.Errorf("workload mix entry %d has no function_name", i)
+		}
+		if entry.Weight < 0 || entry.Rate < 0 {
+			return nil, errors.Errorf("workload mix entry %d (%s) has a negative weight or rate", i, entry.FName)
+		}
+		if entry.Rate != 0 && (entry.Rate < minRate || entry.Rate > maxRate) {
+			return nil, errors.Errorf("workload mix entry %d (%s) has a rate outside of [%g, %g]", i, entry.FName, minRate, maxRate)
+		}
+		if entry.Weight == 0 && entry.Rate == 0 {
+			entry.Weight = 1
+		}
+
+		text := entry.ArgsTemplate
+		if text == "" {
+			raw, err := json.Marshal(entry.FArgs)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to encode arguments for %s", entry.FName)
+			}
+			text = string(raw)
+		}
+		var err error
+		if entry.template, err = NewArgsTemplate(text, datasets); err != nil {
+			return nil, errors.Wrapf(err, "workload mix entry %d (%s)", i, entry.FName)
+		}
+		res[i] = entry
+	}
+	return res, nil
+}
+
+// Render the arguments of a single invocation of this entry
+func (entry *WorkloadEntry) renderArgs(seq int, uuid string) (string, error) {
+	return entry.template.Render(TemplateVars{Seq: seq, UUID: uuid, Function: entry.FName})
+}
+
+// Choose a closed-loop entry at random according to its weight. Returns nil
+// if no entry has a weight (the mix is purely open-loop).
+func (mix WorkloadMix) pick(r *rand.Rand) *WorkloadEntry {
+	total := 0.0
+	for _, entry := range mix {
+		total += entry.Weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	target := r.Float64() * total
+	for i := range mix {
+		if target < mix[i].Weight {
+			return &mix[i]
+		}
+		target -= mix[i].Weight
+	}
+	// Only reachable through floating point rounding
+	for i := len(mix) - 1; i >= 0; i-- {
+		if mix[i].Weight > 0 {
+			return &mix[i]
+		}
+	}
+	return nil
+}
+
+// Entries that are invoked at a fixed rate
+func (mix WorkloadMix) rated() []*WorkloadEntry {
+	var res []*WorkloadEntry
+	for i := range mix {
+		if mix[i].Rate > 0 {
+			res = append(res, &mix[i])
+		}
+	}
+	return res
+}
+
+// Client-side results for the functions of a workload mix. Safe for
+// concurrent use.
+type functionResults struct {
+	m         sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]map[srk.ErrorKind]int
+}
+
+func newFunctionResults() *functionResults {
+	return &functionResults{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]map[srk.ErrorKind]int),
+	}
+}
+
+func (r *functionResults) record(fName string, latency time.Duration, err error) {
+	r.m.Lock()
+	if err != nil {
+		if r.errors[fName] == nil {
+			r.errors[fName] = make(map[srk.ErrorKind]int)
+		}
+		r.errors[fName][srk.KindOf(err)]++
+	} else {
+		r.latencies[fName] = append(r.latencies[fName], latency)
+	}
+	r.m.Unlock()
+}
+
+// Per-function summary of the recorded invocations. Latencies are reported
+// in milliseconds, errors in total and per class (e.g. "functionErrors").
+func (r *functionResults) summary() map[string]map[string]float64 {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	res := make(map[string]map[string]float64)
+	for fName, kinds := range r.errors {
+		stats := map[string]float64{"invocations": 0, "errors": 0}
+		for kind, nErr := range kinds {
+			stats["invocations"] += float64(nErr)
+			stats["errors"] += float64(nErr)
+			stats[kind.String()+"Errors"] = float64(nErr)
+		}
+		res[fName] = stats
+	}
+	for fName, lat := range r.latencies {
+		sorted := make([]time.Duration, len(lat))
+		copy(sorted, lat)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		var total time.Duration
+		for _, l := range sorted {
+			total += l
+		}
+		toMs := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+
+		stats, exists := res[fName]
+		if !exists {
+			stats = map[string]float64{"invocations": 0, "errors": 0}
+			res[fName] = stats
+		}
+		stats["invocations"] += float64(len(sorted))
+		stats["meanMs"] = toMs(total) / float64(len(sorted))
+		stats["p50Ms"] = toMs(percentile(sorted, 0.50))
+		stats["p99Ms"] = toMs(percentile(sorted, 0.99))
+	}
+	return res
+}
+
+// p-th percentile (0 <= p <= 1) of an ascending, non-empty slice
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	} else if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
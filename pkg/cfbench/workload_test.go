@@ -0,0 +1,132 @@
+package cfbench
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// Minimal srk.FunctionService that counts invocations per function
+type countingService struct {
+	m      sync.Mutex
+	counts map[string]int
+}
+
+func (s *countingService) Package(rawDir string) (string, error) { return rawDir, nil }
+func (s *countingService) Install(rawDir string, env map[string]string, runtime string) error {
+	return nil
+}
+func (s *countingService) Remove(fName string) error                        { return nil }
+func (s *countingService) List() ([]srk.FunctionInfo, error)                { return nil, nil }
+func (s *countingService) Describe(fName string) (*srk.FunctionInfo, error) { return nil, nil }
+func (s *countingService) Destroy()                                         {}
+func (s *countingService) ReportStats() (map[string]float64, error) {
+	return nil, nil
+}
+func (s *countingService) ResetStats() error { return nil }
+
+func (s *countingService) Invoke(fName string, args string) (*srk.InvokeResult, error) {
+	s.m.Lock()
+	s.counts[fName]++
+	s.m.Unlock()
+	if fName == "broken" {
+		return nil, srk.NewInvokeError(srk.ErrFunction, fName, errors.New("function failed"))
+	}
+	return &srk.InvokeResult{Body: []byte(args)}, nil
+}
+
+func TestNewWorkloadMix(t *testing.T) {
+	mix, err := NewWorkloadMix(nil, "echo", `{"hello": "world"}`, nil)
+	assert.Nil(t, err)
+	assert.Len(t, mix, 1)
+	assert.Equal(t, "echo", mix[0].FName)
+	assert.Equal(t, 1.0, mix[0].Weight)
+	args, err := mix[0].renderArgs(1, "id")
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"hello": "world"}`, args)
+
+	mix, err = NewWorkloadMix(WorkloadMix{{FName: "a", FArgs: map[string]interface{}{"n": 1}}, {FName: "b", Rate: 2}}, "ignored", "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, mix[0].Weight)
+	assert.Equal(t, 0.0, mix[1].Weight)
+	assert.Len(t, mix.rated(), 1)
+	args, err = mix[0].renderArgs(1, "id")
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"n": 1}`, args)
+
+	_, err = NewWorkloadMix(nil, "", "", nil)
+	assert.NotNil(t, err)
+	_, err = NewWorkloadMix(WorkloadMix{{FName: "a", Weight: -1}}, "", "", nil)
+	assert.NotNil(t, err)
+	// rates whose interval rounds to 0 or overflows
+	_, err = NewWorkloadMix(WorkloadMix{{FName: "a", Rate: 2e9}}, "", "", nil)
+	assert.NotNil(t, err)
+	_, err = NewWorkloadMix(WorkloadMix{{FName: "a", Rate: 1e-12}}, "", "", nil)
+	assert.NotNil(t, err)
+	_, err = NewWorkloadMix(nil, "echo", "{{.Unclosed", nil)
+	assert.NotNil(t, err)
+}
+
+func TestCheckReservedArgs(t *testing.T) {
+	mix, err := NewWorkloadMix(WorkloadMix{{FName: "a", ArgsTemplate: `{"seq": {{.Seq}}}`}}, "", "", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, checkReservedArgs(mix))
+
+	mix, err = NewWorkloadMix(nil, "a", `{"uuid": "mine"}`, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, checkReservedArgs(mix))
+}
+
+func TestWorkloadMixPick(t *testing.T) {
+	mix := WorkloadMix{{FName: "heavy", Weight: 1}, {FName: "light", Weight: 3}, {FName: "rated", Rate: 1}}
+	r := rand.New(rand.NewSource(1))
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[mix.pick(r).FName]++
+	}
+	assert.Zero(t, counts["rated"])
+	assert.InDelta(t, 1000, counts["heavy"], 150)
+	assert.InDelta(t, 3000, counts["light"], 150)
+
+	assert.Nil(t, WorkloadMix{{FName: "rated", Rate: 1}}.pick(r))
+}
+
+func TestMixBench(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-mix")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	service := &countingService{counts: make(map[string]int)}
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	bench, err := NewMix(logger)
+	assert.Nil(t, err)
+
+	output := filepath.Join(dir, "results.json")
+	params := `{"concurrency": 2, "duration": 1, "mix": [
+		{"function_name": "echo", "args_template": "{\"seq\": {{.Seq}}}", "weight": 3},
+		{"function_name": "broken", "weight": 1}]}`
+	err = bench.RunBench(&srk.Provider{Faas: service}, &srk.BenchArgs{BParams: params, Output: output})
+	assert.Nil(t, err)
+
+	raw, err := ioutil.ReadFile(output)
+	assert.Nil(t, err)
+	var summary map[string]map[string]float64
+	assert.Nil(t, json.Unmarshal(raw, &summary))
+
+	assert.Equal(t, float64(service.counts["echo"]), summary["echo"]["invocations"])
+	assert.Zero(t, summary["echo"]["errors"])
+	assert.Equal(t, float64(service.counts["broken"]), summary["broken"]["errors"])
+	assert.Equal(t, float64(service.counts["broken"]), summary["broken"]["functionErrors"])
+	assert.NotContains(t, summary["broken"], "meanMs")
+}
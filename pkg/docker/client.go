@@ -0,0 +1,396 @@
+// A minimal client for the Docker Engine API. Only the calls needed by SRK
+// are implemented. The client talks HTTP over any connection (typically the
+// docker unix socket, possibly forwarded from a remote host).
+package docker
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultSocket = "/var/run/docker.sock"
+
+// Opens a new connection to the docker daemon
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+type Client struct {
+	http *http.Client
+}
+
+func NewClient(dial DialFunc) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(ctx)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport}}
+}
+
+// Entry of the container list
+type Container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
+}
+
+type ContainerState struct {
+	Status    string    `json:"Status"`
+	Running   bool      `json:"Running"`
+	StartedAt time.Time `json:"StartedAt"`
+}
+
+// Result of inspecting a container
+type ContainerInfo struct {
+	ID    string          `json:"Id"`
+	Name  string          `json:"Name"`
+	State *ContainerState `json:"State"`
+}
+
+// Port binding on the docker host
+type PortBinding struct {
+	HostIP   string `json:"HostIp,omitempty"`
+	HostPort string `json:"HostPort"`
+}
+
+type HostConfig struct {
+	// Volume bindings in "host-path:container-path[:options]" form
+	Binds []string `json:"Binds,omitempty"`
+	// Published ports by container port, e.g. "9001/tcp"
+	PortBindings map[string][]PortBinding `json:"PortBindings,omitempty"`
+}
+
+// Configuration of a new container
+type ContainerConfig struct {
+	Image        string              `json:"Image"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	HostConfig   *HostConfig         `json:"HostConfig,omitempty"`
+}
+
+// Returned for API errors, e.g. a missing container
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("docker API error (%d): %s", e.StatusCode, e.Message)
+}
+
+func IsNotFound(err error) bool {
+	apiErr, ok := errors.Cause(err).(*Error)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Check that the daemon answers API requests
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.do(ctx, http.MethodGet, "/_ping", nil, nil, nil); err != nil {
+		return errors.Wrap(err, "failed to reach docker daemon")
+	}
+	return nil
+}
+
+// List containers. filters uses the docker filter syntax, e.g.
+// {"publish": ["9001"], "label": ["srk.function=echo"]}. All containers
+// (including stopped ones) are listed if all is true.
+func (c *Client) ListContainers(ctx context.Context, all bool, filters map[string][]string) ([]Container, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	if len(filters) > 0 {
+		encoded, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(encoded))
+	}
+
+	var containers []Container
+	if err := c.do(ctx, http.MethodGet, "/containers/json", query, nil, &containers); err != nil {
+		return nil, errors.Wrap(err, "failed to list containers")
+	}
+	return containers, nil
+}
+
+func (c *Client) InspectContainer(ctx context.Context, id string) (*ContainerInfo, error) {
+	var info ContainerInfo
+	if err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil, nil, &info); err != nil {
+		return nil, errors.Wrapf(err, "failed to inspect container %s", id)
+	}
+	return &info, nil
+}
+
+// Create a container and return its id. The image must be present (see
+// PullImage).
+func (c *Client) CreateContainer(ctx context.Context, name string, config *ContainerConfig) (string, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/containers/create", query, config, &created); err != nil {
+		return "", errors.Wrapf(err, "failed to create container %s", name)
+	}
+	return created.ID, nil
+}
+
+func (c *Client) StartContainer(ctx context.Context, id string) error {
+	if err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/start", nil, nil, nil); err != nil {
+		return errors.Wrapf(err, "failed to start container %s", id)
+	}
+	return nil
+}
+
+// Stop a container, killing it if it did not stop after timeout
+func (c *Client) StopContainer(ctx context.Context, id string, timeout time.Duration) error {
+	query := url.Values{}
+	query.Set("t", strconv.Itoa(int(timeout.Seconds())))
+
+	err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/stop", query, nil, nil)
+	// 304 means the container was already stopped
+	if apiErr, ok := err.(*Error); ok && apiErr.StatusCode == http.StatusNotModified {
+		err = nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to stop container %s", id)
+	}
+	return nil
+}
+
+// Remove a container, running containers are only removed if force is set
+func (c *Client) RemoveContainer(ctx context.Context, id string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	if err := c.do(ctx, http.MethodDelete, "/containers/"+url.PathEscape(id), query, nil, nil); err != nil {
+		return errors.Wrapf(err, "failed to remove container %s", id)
+	}
+	return nil
+}
+
+// Pull an image ("name:tag", the tag defaults to "latest") and wait for the
+// pull to finish
+func (c *Client) PullImage(ctx context.Context, image string) error {
+	name, tag := image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name, tag = image[:i], image[i+1:]
+	}
+	query := url.Values{}
+	query.Set("fromImage", name)
+	query.Set("tag", tag)
+
+	var pullErr error
+	err := c.stream(ctx, http.MethodPost, "/images/create", query, func(msg json.RawMessage) {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(msg, &progress) == nil && progress.Error != "" {
+			pullErr = errors.New(progress.Error)
+		}
+	})
+	if err == nil {
+		err = pullErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to pull image %s", image)
+	}
+	return nil
+}
+
+// A line written by a container
+type LogLine struct {
+	Time time.Time
+	// Written to stderr (instead of stdout)
+	Stderr bool
+	Text   string
+}
+
+// Read the output of a container from since on (all of it if since is zero),
+// ordered by time. Only containers with the json-file or journald logging
+// driver (the default) keep their output.
+func (c *Client) ContainerLogs(ctx context.Context, id string, since time.Time) ([]LogLine, error) {
+	query := url.Values{}
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+	query.Set("timestamps", "1")
+	if !since.IsZero() {
+		query.Set("since", fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()))
+	}
+
+	resp, err := c.open(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs", query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read logs of container %s", id)
+	}
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read logs of container %s", id)
+	}
+	return parseLogs(raw), nil
+}
+
+// Parse the output of a container. Unless the container has a TTY, the
+// output is multiplexed: every frame starts with an 8 byte header (the
+// stream, 3 zero bytes and the size of the frame, big endian).
+func parseLogs(raw []byte) []LogLine {
+	var stdout, stderr []byte
+	if len(raw) >= 8 && raw[0] <= 2 && raw[1] == 0 && raw[2] == 0 && raw[3] == 0 {
+		for len(raw) >= 8 {
+			size := int(binary.BigEndian.Uint32(raw[4:8]))
+			if size > len(raw)-8 {
+				size = len(raw) - 8
+			}
+			if raw[0] == 2 {
+				stderr = append(stderr, raw[8:8+size]...)
+			} else {
+				stdout = append(stdout, raw[8:8+size]...)
+			}
+			raw = raw[8+size:]
+		}
+	} else {
+		stdout = raw
+	}
+
+	lines := append(splitLogLines(stdout, false), splitLogLines(stderr, true)...)
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+	return lines
+}
+
+// Split output into lines of the form "TIMESTAMP TEXT"
+func splitLogLines(output []byte, stderr bool) []LogLine {
+	var lines []LogLine
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		logLine := LogLine{Stderr: stderr, Text: line}
+		if i := strings.IndexByte(line, ' '); i > 0 {
+			if t, err := time.Parse(time.RFC3339Nano, line[:i]); err == nil {
+				logLine.Time, logLine.Text = t, line[i+1:]
+			}
+		}
+		lines = append(lines, logLine)
+	}
+	return lines
+}
+
+// Perform an API request. body (if not nil) is sent as JSON and the response
+// is decoded into result (if not nil).
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = strings.NewReader(string(encoded))
+	}
+
+	u := "http://docker" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return readError(resp)
+	}
+
+	if result == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Perform an API request that responds with a stream of JSON messages and
+// call handle for each message until the stream ends
+func (c *Client) stream(ctx context.Context, method, path string, query url.Values, handle func(json.RawMessage)) error {
+	resp, err := c.open(ctx, method, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg json.RawMessage
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		handle(msg)
+	}
+}
+
+// Perform an API request without a body and return the response for reading
+// (the caller must close the body). Fails if the request failed.
+func (c *Client) open(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	u := "http://docker" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+func readError(resp *http.Response) error {
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	raw, _ := ioutil.ReadAll(resp.Body)
+	if json.Unmarshal(raw, &apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(raw))
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: apiErr.Message}
+}
@@ -0,0 +1,207 @@
+package docker_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/serverlessresearch/srk/pkg/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Serves handler on a unix socket and returns a client connected to it
+func newTestClient(t *testing.T, handler http.Handler) (*docker.Client, func()) {
+	dir, err := ioutil.TempDir("", "srk-docker")
+	require.Nil(t, err)
+	socket := filepath.Join(dir, "docker.sock")
+
+	listener, err := net.Listen("unix", socket)
+	require.Nil(t, err)
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+
+	client := docker.NewClient(func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", socket)
+	})
+	return client, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPing(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	client, cleanup := newTestClient(t, mux)
+	assert.Nil(t, client.Ping(context.Background()))
+	cleanup()
+
+	// nothing listens on the socket any more
+	assert.NotNil(t, client.Ping(context.Background()))
+}
+
+func TestListAndInspect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		var filters map[string][]string
+		assert.Nil(t, json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters))
+		assert.Equal(t, []string{"9001"}, filters["publish"])
+		assert.Equal(t, "", r.URL.Query().Get("all"))
+		w.Write([]byte(`[{"Id": "abc", "Names": ["/srk-echo"], "State": "running"}]`))
+	})
+	mux.HandleFunc("/containers/abc/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Id": "abc", "Name": "/srk-echo", "State": {"Status": "running", "Running": true, "StartedAt": "2020-05-01T10:00:00.5Z"}}`))
+	})
+	mux.HandleFunc("/containers/missing/json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "No such container: missing"}`))
+	})
+
+	client, cleanup := newTestClient(t, mux)
+	defer cleanup()
+	ctx := context.Background()
+
+	containers, err := client.ListContainers(ctx, false, map[string][]string{"publish": {"9001"}})
+	require.Nil(t, err)
+	require.Len(t, containers, 1)
+	assert.Equal(t, "abc", containers[0].ID)
+	assert.Equal(t, []string{"/srk-echo"}, containers[0].Names)
+
+	info, err := client.InspectContainer(ctx, "abc")
+	require.Nil(t, err)
+	assert.True(t, info.State.Running)
+	assert.Equal(t, 500000000, info.State.StartedAt.Nanosecond())
+
+	_, err = client.InspectContainer(ctx, "missing")
+	assert.NotNil(t, err)
+	assert.True(t, docker.IsNotFound(err))
+	assert.Contains(t, err.Error(), "No such container")
+}
+
+func TestContainerLifecycle(t *testing.T) {
+	var pulled bool
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "create")
+		if !pulled {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "No such image: lambci/lambda:python3.8"}`))
+			return
+		}
+		assert.Equal(t, "srk-echo", r.URL.Query().Get("name"))
+		var config docker.ContainerConfig
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&config))
+		assert.Equal(t, "lambci/lambda:python3.8", config.Image)
+		assert.Equal(t, []docker.PortBinding{{HostPort: "9001"}}, config.HostConfig.PortBindings["9001/tcp"])
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id": "abc"}`))
+	})
+	mux.HandleFunc("/images/create", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "lambci/lambda", r.URL.Query().Get("fromImage"))
+		assert.Equal(t, "python3.8", r.URL.Query().Get("tag"))
+		pulled = true
+		w.Write([]byte("{\"status\": \"Pulling\"}\n{\"status\": \"Done\"}\n"))
+	})
+	mux.HandleFunc("/containers/abc/start", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "start")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/containers/abc/stop", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "stop")
+		assert.Equal(t, "5", r.URL.Query().Get("t"))
+		// already stopped
+		w.WriteHeader(http.StatusNotModified)
+	})
+	mux.HandleFunc("/containers/abc", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "remove")
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, "1", r.URL.Query().Get("force"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	client, cleanup := newTestClient(t, mux)
+	defer cleanup()
+	ctx := context.Background()
+
+	config := &docker.ContainerConfig{
+		Image: "lambci/lambda:python3.8",
+		HostConfig: &docker.HostConfig{
+			PortBindings: map[string][]docker.PortBinding{"9001/tcp": {{HostPort: "9001"}}},
+		},
+	}
+	_, err := client.CreateContainer(ctx, "srk-echo", config)
+	assert.True(t, docker.IsNotFound(err))
+	assert.Nil(t, client.PullImage(ctx, "lambci/lambda:python3.8"))
+
+	id, err := client.CreateContainer(ctx, "srk-echo", config)
+	require.Nil(t, err)
+	assert.Equal(t, "abc", id)
+	assert.Nil(t, client.StartContainer(ctx, id))
+	assert.Nil(t, client.StopContainer(ctx, id, 5*time.Second))
+	assert.Nil(t, client.RemoveContainer(ctx, id, true))
+	assert.Equal(t, []string{"create", "create", "start", "stop", "remove"}, calls)
+}
+
+func TestPullImageError(t *testing.T) {
+	client, cleanup := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "latest", r.URL.Query().Get("tag"))
+		w.Write([]byte("{\"status\": \"Pulling\"}\n{\"error\": \"manifest unknown\"}\n"))
+	}))
+	defer cleanup()
+
+	err := client.PullImage(context.Background(), "localhost:5000/lambci")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "manifest unknown")
+}
+
+// A frame of multiplexed container output
+func logFrame(stream byte, text string) []byte {
+	frame := []byte{stream, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(text)))
+	return append(frame, text...)
+}
+
+func TestContainerLogs(t *testing.T) {
+	client, cleanup := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/containers/abc/logs", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("timestamps"))
+		assert.Equal(t, "1588327200.500000000", r.URL.Query().Get("since"))
+		w.Write(logFrame(1, "2020-05-01T10:00:01.000000000Z START RequestId: 1\n"))
+		w.Write(logFrame(2, "2020-05-01T10:00:01.500000000Z Traceback (most recent call last):\n"))
+		w.Write(logFrame(1, "2020-05-01T10:00:02.000000000Z END RequestId: 1\n"))
+	}))
+	defer cleanup()
+
+	since := time.Date(2020, 5, 1, 10, 0, 0, 500000000, time.UTC)
+	lines, err := client.ContainerLogs(context.Background(), "abc", since)
+	require.Nil(t, err)
+	require.Len(t, lines, 3)
+	assert.Equal(t, "START RequestId: 1", lines[0].Text)
+	assert.False(t, lines[0].Stderr)
+	assert.Equal(t, "Traceback (most recent call last):", lines[1].Text)
+	assert.True(t, lines[1].Stderr)
+	assert.True(t, lines[1].Time.Equal(since.Add(time.Second)))
+	assert.Equal(t, "END RequestId: 1", lines[2].Text)
+
+	// containers with a TTY don't multiplex their output
+	client, cleanup = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("2020-05-01T10:00:01Z hello\n2020-05-01T10:00:02Z world\n"))
+	}))
+	defer cleanup()
+	lines, err = client.ContainerLogs(context.Background(), "abc", time.Time{})
+	require.Nil(t, err)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "world", lines[1].Text)
+}
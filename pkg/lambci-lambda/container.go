@@ -0,0 +1,344 @@
+package lambcilambda
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/serverlessresearch/srk/pkg/docker"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/spf13/viper"
+)
+
+const (
+	// port of the server API inside the lambci container
+	containerPort = "9001/tcp"
+	// labels of the containers managed by srk
+	functionLabel  = "srk.function"
+	directoryLabel = "srk.directory"
+
+	// mount point of the function's env file inside the container
+	containerEnvFile = "/var/srk/env"
+
+	defaultImage       = "lambci/lambda:python3.8"
+	defaultHandler     = "lambda_function.lambda_handler"
+	defaultStopTimeout = 10 * time.Second
+	defaultPullTimeout = 10 * time.Minute
+)
+
+// what the container of a function runs
+type containerSpec struct {
+	image   string   // lambci image, empty for the configured image
+	handler string   // empty for the configured handler
+	env     []string // environment of the function
+}
+
+// starts and stops the lambci containers of the functions via the Docker
+// Engine API, one container per function
+type containerManager struct {
+	docker      *docker.Client
+	image       string        // default lambci image, e.g. lambci/lambda:python3.8
+	handler     string        // default handler of the lambda functions
+	hostDir     string        // absolute path of the lambci directory on the docker host
+	namePrefix  string        // prefix of container names, unique per lambci directory
+	keepRunning bool          // leave containers running on Destroy()
+	timeout     time.Duration // timeout for docker API calls
+	stopTimeout time.Duration
+	pullTimeout time.Duration
+	// id of the serving container of each function, empty for containers
+	// that were not started by srk
+	containers map[string]string
+	lock       sync.RWMutex // protects containers and functionLocks
+	// serializes starting and stopping the container of each function
+	functionLocks map[string]*sync.Mutex
+	log           srk.Logger
+}
+
+func newContainerManager(logger srk.Logger, config *viper.Viper, client *docker.Client, hostDir string, timeout time.Duration) *containerManager {
+
+	manager := &containerManager{
+		docker:      client,
+		image:       config.GetString("container.image"),
+		handler:     config.GetString("container.handler"),
+		hostDir:     hostDir,
+		namePrefix:  containerNamePrefix(hostDir),
+		keepRunning: config.GetBool("container.keep-running"),
+		timeout:     timeout,
+		stopTimeout: defaultStopTimeout,
+		pullTimeout: defaultPullTimeout,
+		containers:  make(map[string]string),
+		log:         logger,
+
+		functionLocks: make(map[string]*sync.Mutex),
+	}
+
+	if manager.image == "" {
+		manager.image = defaultImage
+	}
+	if manager.handler == "" {
+		manager.handler = defaultHandler
+	}
+	if config.IsSet("container.stop-timeout") {
+		manager.stopTimeout = time.Duration(config.GetInt("container.stop-timeout")) * time.Second
+	}
+	if config.IsSet("container.pull-timeout") {
+		manager.pullTimeout = time.Duration(config.GetInt("container.pull-timeout")) * time.Second
+	}
+
+	return manager
+}
+
+// containers of different lambci directories on the same docker host must not
+// share names
+func containerNamePrefix(hostDir string) string {
+
+	hash := sha256.Sum256([]byte(hostDir))
+	return "srk-lambci-" + hex.EncodeToString(hash[:4]) + "-"
+}
+
+// find the containers of a function, including stopped ones
+func (manager *containerManager) find(ctx context.Context, fName string) ([]docker.Container, error) {
+
+	return manager.docker.ListContainers(ctx, true, map[string][]string{
+		"label": {functionLabel + "=" + fName, directoryLabel + "=" + manager.hostDir},
+	})
+}
+
+// lock of a function's container
+func (manager *containerManager) functionLock(fName string) *sync.Mutex {
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	lock, exists := manager.functionLocks[fName]
+	if !exists {
+		lock = &sync.Mutex{}
+		manager.functionLocks[fName] = lock
+	}
+	return lock
+}
+
+// returns true if a container is known to serve the function
+func (manager *containerManager) serving(fName string) bool {
+
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+
+	_, exists := manager.containers[fName]
+	return exists
+}
+
+// record the container serving a function, "" for containers not started by srk
+func (manager *containerManager) track(fName string, id string) {
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	manager.containers[fName] = id
+}
+
+// make sure a container serves the function, starting one if necessary
+// a running container is reused (and left running) even if srk did not start it
+// spec is only loaded if a new container is started, ready is called to wait
+// for a new container to serve (before other callers may use it). Only calls
+// for the same function wait for each other.
+func (manager *containerManager) ensure(fName string, port int, spec func() (containerSpec, error), ready func() error) error {
+
+	if manager.serving(fName) {
+		return nil
+	}
+
+	lock := manager.functionLock(fName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// another caller may have started the container in the meantime
+	if manager.serving(fName) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), manager.timeout)
+	defer cancel()
+
+	containers, err := manager.find(ctx, fName)
+	if err != nil {
+		return err
+	}
+	for _, container := range containers {
+		if container.State == "running" {
+			manager.track(fName, "")
+			return nil
+		}
+	}
+
+	newSpec, err := spec()
+	if err != nil {
+		return err
+	}
+	// stopped containers, e.g. of an earlier srk run, hold the container name
+	if err := manager.remove(fName); err != nil {
+		return err
+	}
+	id, err := manager.start(fName, port, newSpec)
+	if err != nil {
+		return err
+	}
+	// tracked only once it serves, but also if it does not, to be cleaned up
+	err = ready()
+	manager.track(fName, id)
+	return err
+}
+
+// replace the container of a function with a new one
+func (manager *containerManager) restart(fName string, port int, spec containerSpec) error {
+
+	lock := manager.functionLock(fName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := manager.remove(fName); err != nil {
+		return err
+	}
+	id, err := manager.start(fName, port, spec)
+	if err != nil {
+		return err
+	}
+	manager.track(fName, id)
+	return nil
+}
+
+// start a new container for a function and return its id, the function must
+// be locked. The function's env file is mounted at /var/srk/env for
+// reference, the lambci images only read the function's environment from the
+// container's environment, so changing it requires a new container.
+func (manager *containerManager) start(fName string, port int, spec containerSpec) (string, error) {
+
+	image, handler := spec.image, spec.handler
+	if image == "" {
+		image = manager.image
+	}
+	if handler == "" {
+		handler = manager.handler
+	}
+
+	fDir := filepath.Join(manager.hostDir, functionsDir, fName)
+	config := &docker.ContainerConfig{
+		Image: image,
+		Cmd:   []string{handler},
+		Env:   append([]string{"DOCKER_LAMBDA_STAY_OPEN=1"}, spec.env...),
+		Labels: map[string]string{
+			functionLabel:  fName,
+			directoryLabel: manager.hostDir,
+		},
+		ExposedPorts: map[string]struct{}{containerPort: {}},
+		HostConfig: &docker.HostConfig{
+			Binds: []string{
+				filepath.Join(fDir, taskDir) + ":/var/task:ro,delegated",
+				filepath.Join(fDir, runtimeDir) + ":/opt:ro,delegated",
+				filepath.Join(fDir, envFile) + ":" + containerEnvFile + ":ro",
+			},
+			PortBindings: map[string][]docker.PortBinding{
+				containerPort: {{HostPort: strconv.Itoa(port)}},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), manager.timeout)
+	defer cancel()
+
+	name := manager.namePrefix + fName
+	id, err := manager.docker.CreateContainer(ctx, name, config)
+	if docker.IsNotFound(err) {
+		manager.log.Infof("pulling image %s", image)
+		pullCtx, pullCancel := context.WithTimeout(context.Background(), manager.pullTimeout)
+		err = manager.docker.PullImage(pullCtx, image)
+		pullCancel()
+		if err != nil {
+			return "", err
+		}
+		id, err = manager.docker.CreateContainer(ctx, name, config)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := manager.docker.StartContainer(ctx, id); err != nil {
+		manager.docker.RemoveContainer(ctx, id, true)
+		return "", err
+	}
+	manager.log.Infof("started container %s for function '%s' on port %d", name, fName, port)
+	return id, nil
+}
+
+// stop and remove the containers of a function (if any), including stopped
+// ones, the function must be locked
+func (manager *containerManager) remove(fName string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), manager.timeout+manager.stopTimeout)
+	defer cancel()
+
+	containers, err := manager.find(ctx, fName)
+	if err != nil {
+		return err
+	}
+	manager.lock.RLock()
+	tracked := manager.containers[fName]
+	manager.lock.RUnlock()
+	ids := make([]string, 0, len(containers)+1)
+	if tracked != "" {
+		ids = append(ids, tracked)
+	}
+	for _, container := range containers {
+		if container.ID != tracked {
+			ids = append(ids, container.ID)
+		}
+	}
+
+	for _, id := range ids {
+		if err := manager.docker.StopContainer(ctx, id, manager.stopTimeout); err != nil && !docker.IsNotFound(err) {
+			return err
+		}
+		if err := manager.docker.RemoveContainer(ctx, id, true); err != nil && !docker.IsNotFound(err) {
+			return err
+		}
+	}
+	manager.lock.Lock()
+	delete(manager.containers, fName)
+	manager.lock.Unlock()
+	return nil
+}
+
+// stop and remove a function's container
+func (manager *containerManager) stop(fName string) error {
+
+	lock := manager.functionLock(fName)
+	lock.Lock()
+	defer lock.Unlock()
+	return manager.remove(fName)
+}
+
+// stop and remove all containers started by the manager
+func (manager *containerManager) stopAll() {
+
+	if manager.keepRunning {
+		return
+	}
+
+	manager.lock.RLock()
+	var started []string
+	for fName, id := range manager.containers {
+		if id != "" {
+			started = append(started, fName)
+		}
+	}
+	manager.lock.RUnlock()
+
+	for _, fName := range started {
+		if err := manager.stop(fName); err != nil {
+			manager.log.Warnf("error removing container of function '%s': %v", fName, err)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package lambcilambda
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serverlessresearch/srk/pkg/docker"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a fake docker daemon that keeps track of containers
+type fakeDaemon struct {
+	lock    sync.Mutex
+	running map[string]docker.ContainerConfig
+	stopped map[string]docker.ContainerConfig
+	names   map[string]string // id of each container name
+	removed []string
+	next    int
+}
+
+func (d *fakeDaemon) container(id string) (docker.ContainerConfig, bool) {
+	if config, ok := d.running[id]; ok {
+		return config, true
+	}
+	config, ok := d.stopped[id]
+	return config, ok
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/containers/json":
+		var filters map[string][]string
+		json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+		list := []docker.Container{}
+		for id, config := range d.running {
+			if matchesLabels(config, filters["label"]) {
+				list = append(list, docker.Container{ID: id, State: "running"})
+			}
+		}
+		for id, config := range d.stopped {
+			if r.URL.Query().Get("all") == "1" && matchesLabels(config, filters["label"]) {
+				list = append(list, docker.Container{ID: id, State: "exited"})
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.URL.Path == "/containers/create":
+		name := r.URL.Query().Get("name")
+		if _, exists := d.names[name]; exists {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var config docker.ContainerConfig
+		json.NewDecoder(r.Body).Decode(&config)
+		d.next++
+		id := string(rune('a' + d.next))
+		d.running[id] = config
+		d.names[name] = id
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"Id": id})
+	case len(parts) == 3 && parts[2] == "start":
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 3 && parts[2] == "stop":
+		if config, ok := d.running[parts[1]]; ok {
+			delete(d.running, parts[1])
+			d.stopped[parts[1]] = config
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		delete(d.running, parts[1])
+		delete(d.stopped, parts[1])
+		for name, id := range d.names {
+			if id == parts[1] {
+				delete(d.names, name)
+			}
+		}
+		d.removed = append(d.removed, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func matchesLabels(config docker.ContainerConfig, labels []string) bool {
+	for _, label := range labels {
+		kv := strings.SplitN(label, "=", 2)
+		if config.Labels[kv[0]] != kv[1] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestContainerManager(t *testing.T) {
+	prefix := containerNamePrefix("/home/srk/lambci")
+	daemon := &fakeDaemon{
+		running: map[string]docker.ContainerConfig{
+			// started by someone else
+			"x": {Labels: map[string]string{functionLabel: "other", directoryLabel: "/home/srk/lambci"}},
+		},
+		stopped: map[string]docker.ContainerConfig{
+			// left behind by earlier runs
+			"y": {Labels: map[string]string{functionLabel: "echo", directoryLabel: "/home/srk/lambci"}},
+			"z": {Labels: map[string]string{functionLabel: "hello", directoryLabel: "/home/srk/lambci"}},
+		},
+		names: map[string]string{prefix + "echo": "y", prefix + "hello": "z"},
+	}
+	server := httptest.NewServer(daemon)
+	defer server.Close()
+
+	client := docker.NewClient(func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", server.Listener.Addr().String())
+	})
+	config := viper.New()
+	config.Set("container.image", "lambci/lambda:provided")
+	manager := newContainerManager(logrus.New(), config, client, "/home/srk/lambci", 5*time.Second)
+
+	// the directory is part of the container names
+	assert.NotEqual(t, prefix, containerNamePrefix("/home/other/lambci"))
+
+	// install starts a container with the function's directories and port,
+	// replacing the stopped container of an earlier run
+	require.Nil(t, manager.restart("echo", 9002, containerSpec{env: []string{"KEY=value"}}))
+	id := manager.containers["echo"]
+	require.NotEqual(t, "", id)
+	assert.Equal(t, []string{"y"}, daemon.removed)
+	assert.Equal(t, id, daemon.names[prefix+"echo"])
+	started := daemon.running[id]
+	assert.Equal(t, "lambci/lambda:provided", started.Image)
+	assert.Equal(t, []string{defaultHandler}, started.Cmd)
+	assert.Equal(t, []string{"DOCKER_LAMBDA_STAY_OPEN=1", "KEY=value"}, started.Env)
+	assert.Equal(t, []string{
+		"/home/srk/lambci/functions/echo/task:/var/task:ro,delegated",
+		"/home/srk/lambci/functions/echo/runtime:/opt:ro,delegated",
+		"/home/srk/lambci/functions/echo/env:/var/srk/env:ro",
+	}, started.HostConfig.Binds)
+	assert.Equal(t, "9002", started.HostConfig.PortBindings[containerPort][0].HostPort)
+
+	// reinstalling replaces the container, the runtime selects the image
+	require.Nil(t, manager.restart("echo", 9002, containerSpec{image: "lambci/lambda:nodejs12.x", handler: "index.handler"}))
+	assert.NotEqual(t, id, manager.containers["echo"])
+	assert.Equal(t, []string{"y", id}, daemon.removed)
+	started = daemon.running[manager.containers["echo"]]
+	assert.Equal(t, "lambci/lambda:nodejs12.x", started.Image)
+	assert.Equal(t, []string{"index.handler"}, started.Cmd)
+
+	// running containers are adopted, missing or stopped ones are started on
+	// demand
+	noSpec := func() (containerSpec, error) {
+		t.Error("spec must not be loaded for running containers")
+		return containerSpec{}, nil
+	}
+	ready := 0
+	assert.Nil(t, manager.ensure("other", 9003, noSpec, func() error { ready++; return nil }))
+	assert.Equal(t, "", manager.containers["other"])
+	spec := func() (containerSpec, error) { return containerSpec{env: []string{"A=b"}}, nil }
+	assert.Nil(t, manager.ensure("hello", 9004, spec, func() error { ready++; return nil }))
+	assert.Equal(t, 1, ready)
+	assert.NotContains(t, daemon.stopped, "z")
+	assert.NotEqual(t, "", manager.containers["hello"])
+
+	// only containers started by srk are cleaned up
+	manager.stopAll()
+	assert.Len(t, daemon.running, 1)
+	assert.Contains(t, daemon.running, "x")
+}
+
+func TestContainerManagerConcurrentStarts(t *testing.T) {
+	daemon := &fakeDaemon{
+		running: make(map[string]docker.ContainerConfig),
+		stopped: make(map[string]docker.ContainerConfig),
+		names:   make(map[string]string),
+	}
+	server := httptest.NewServer(daemon)
+	defer server.Close()
+
+	client := docker.NewClient(func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", server.Listener.Addr().String())
+	})
+	manager := newContainerManager(logrus.New(), viper.New(), client, "/home/srk/lambci", 5*time.Second)
+	spec := func() (containerSpec, error) { return containerSpec{}, nil }
+
+	// a slow start of one function does not hold up the others
+	echoStarted := make(chan struct{})
+	release := make(chan struct{})
+	slowReady := func() error {
+		close(echoStarted)
+		<-release
+		return nil
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.Nil(t, manager.ensure("echo", 9002, spec, slowReady))
+	}()
+	<-echoStarted
+	// callers for the same function wait for the start to complete
+	go func() {
+		defer wg.Done()
+		assert.Nil(t, manager.ensure("echo", 9002, spec, func() error {
+			t.Error("the container must only be started once")
+			return nil
+		}))
+	}()
+	done := make(chan struct{})
+	go func() {
+		assert.Nil(t, manager.ensure("hello", 9003, spec, func() error { return nil }))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("start of another function was blocked")
+	}
+	assert.False(t, manager.serving("echo"))
+	close(release)
+	wg.Wait()
+	assert.True(t, manager.serving("echo"))
+	assert.True(t, manager.serving("hello"))
+	assert.Len(t, daemon.running, 2)
+}
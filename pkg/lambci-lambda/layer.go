@@ -0,0 +1,80 @@
+package lambcilambda
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+)
+
+// Create a new version of a layer in the layer pool from the contents of dir.
+// The layer is stored in the directory 'name-<version>'.
+func (service *lambciLambda) CreateLayer(name string, dir string) (*srk.Layer, error) {
+
+	if name == "" || strings.ContainsAny(name, "/ ") {
+		return nil, errors.Errorf("invalid layer name '%s'", name)
+	}
+
+	layers, err := service.ListLayers()
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, layer := range layers {
+		if layer.Name == name {
+			versions = append(versions, layer.Ref)
+		}
+	}
+
+	layer := &srk.Layer{Name: name, Version: NextLayerVersion(versions)}
+	layer.Ref = name + "-" + strconv.Itoa(layer.Version)
+
+	if err := service.copy(dir, filepath.Join(service.homeDir, layersDir, layer.Ref)); err != nil {
+		return nil, errors.Wrapf(err, "error uploading layer '%s'", layer.Ref)
+	}
+	return layer, nil
+}
+
+// List all layers in the layer pool
+func (service *lambciLambda) ListLayers() ([]srk.Layer, error) {
+
+	listing, err := service.exec("ls", "-1", filepath.Join(service.homeDir, layersDir))
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing layers")
+	}
+
+	var layers []srk.Layer
+	for _, dir := range strings.Fields(listing) {
+		name, version := ParseLayerName(dir)
+		layers = append(layers, srk.Layer{Name: name, Version: version, Ref: dir})
+	}
+	sort.Slice(layers, func(i, j int) bool {
+		if layers[i].Name != layers[j].Name {
+			return layers[i].Name < layers[j].Name
+		}
+		return layers[i].Version < layers[j].Version
+	})
+	return layers, nil
+}
+
+// Remove a layer from the layer pool, functions keep their copy of the layer
+// until they are reinstalled
+func (service *lambciLambda) RemoveLayer(name string, version int) error {
+
+	layers, err := service.ListLayers()
+	if err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		if layer.Name == name && layer.Version == version {
+			if _, err := service.exec("rm", "-r", filepath.Join(service.homeDir, layersDir, layer.Ref)); err != nil {
+				return errors.Wrapf(err, "error removing layer '%s'", layer.Ref)
+			}
+			return nil
+		}
+	}
+	return errors.Errorf("layer '%s' version %d does not exist", name, version)
+}
@@ -0,0 +1,64 @@
+package lambcilambda_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/serverlessresearch/srk/pkg/lambci-lambda"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayers(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "srk-lambci")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := viper.New()
+	config.Set("directory", filepath.Join(dir, "lambci"))
+	config.Set("address", "localhost:9001")
+	config.Set("readiness.method", "none")
+	service, err := lambcilambda.NewFunctionService(logrus.New(), config)
+	require.Nil(t, err)
+	defer service.Destroy()
+
+	source := filepath.Join(dir, "source")
+	require.Nil(t, os.MkdirAll(filepath.Join(source, "python"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(source, "python", "lib.py"), []byte("x = 1\n"), 0644))
+	// layers created by hand without a version are listed as well
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "lambci", "layers", "manual"), 0755))
+
+	layer, err := service.CreateLayer("lib", source)
+	require.Nil(t, err)
+	assert.Equal(t, &srk.Layer{Name: "lib", Version: 1, Ref: "lib-1"}, layer)
+	layer, err = service.CreateLayer("lib", source)
+	require.Nil(t, err)
+	assert.Equal(t, 2, layer.Version)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "lambci", "layers", "lib-2", "python", "lib.py"))
+	require.Nil(t, err)
+	assert.Equal(t, "x = 1\n", string(data))
+
+	layers, err := service.ListLayers()
+	require.Nil(t, err)
+	assert.Equal(t, []srk.Layer{
+		{Name: "lib", Version: 1, Ref: "lib-1"},
+		{Name: "lib", Version: 2, Ref: "lib-2"},
+		{Name: "manual", Version: 0, Ref: "manual"},
+	}, layers)
+
+	assert.Nil(t, service.RemoveLayer("lib", 1))
+	assert.NotNil(t, service.RemoveLayer("lib", 1))
+	layer, err = service.CreateLayer("lib", source)
+	require.Nil(t, err)
+	assert.Equal(t, 3, layer.Version)
+
+	_, err = service.CreateLayer("../lib", source)
+	assert.NotNil(t, err)
+}
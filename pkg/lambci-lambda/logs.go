@@ -0,0 +1,45 @@
+package lambcilambda
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+)
+
+// Read the output of the container serving a function: everything the
+// function printed and the START, END and REPORT lines of every invocation.
+// The output is lost when the container is replaced, e.g. by a new install
+// of the function.
+func (service *lambciLambda) Logs(fName string, since time.Time) ([]srk.LogEntry, error) {
+
+	service.portsLock.Lock()
+	port, exists := service.ports[fName]
+	service.portsLock.Unlock()
+	if !exists || port == 0 {
+		return nil, errors.Errorf("function '%s' is not installed", fName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), service.timeout)
+	defer cancel()
+
+	containers, err := service.docker.ListContainers(ctx, false, map[string][]string{"publish": {strconv.Itoa(port)}})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error finding container of function '%s'", fName)
+	}
+	if len(containers) != 1 {
+		return nil, errors.Errorf("%d containers serve function '%s' on port %d", len(containers), fName, port)
+	}
+
+	lines, err := service.docker.ContainerLogs(ctx, containers[0].ID, since)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]srk.LogEntry, len(lines))
+	for i, line := range lines {
+		entries[i] = srk.LogEntry{Time: line.Time, Message: line.Text}
+	}
+	return entries, nil
+}
@@ -0,0 +1,68 @@
+package lambcilambda
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/serverlessresearch/srk/pkg/docker"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-lambci")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// a function installed on port 9002 and a docker daemon serving its
+	// container's output (a container with a TTY)
+	fDir := filepath.Join(dir, "lambci", functionsDir, "echo")
+	require.Nil(t, os.MkdirAll(fDir, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(fDir, portFile), []byte("9002"), 0644))
+
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	require.Nil(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			var filters map[string][]string
+			json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+			assert.Equal(t, []string{"9002"}, filters["publish"])
+			json.NewEncoder(w).Encode([]docker.Container{{ID: "abc"}})
+		case "/containers/abc/logs":
+			w.Write([]byte("2020-05-01T10:00:01Z START RequestId: 1 Version: $LATEST\n2020-05-01T10:00:01.5Z hello\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	config := viper.New()
+	config.Set("directory", filepath.Join(dir, "lambci"))
+	config.Set("address", "localhost:9001")
+	config.Set("docker-socket", socket)
+	service, err := NewFunctionService(logrus.New(), config)
+	require.Nil(t, err)
+	defer service.Destroy()
+
+	entries, err := service.Logs("echo", time.Time{})
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "hello", entries[1].Message)
+	assert.Equal(t, time.Date(2020, 5, 1, 10, 0, 1, 500000000, time.UTC), entries[1].Time)
+
+	_, err = service.Logs("missing", time.Time{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,255 @@
+package lambcilambda
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/docker"
+	"github.com/spf13/viper"
+)
+
+// methods to detect that a function container serves newly installed code
+const (
+	// wait for the container publishing the function's port to be replaced
+	// (via the Docker Engine API), then for it to answer a probe
+	ReadinessDocker = "docker"
+	// wait for the function's server API to answer a probe with the version
+	// written to the function's environment on install
+	ReadinessProbe = "probe"
+	// do not wait at all
+	ReadinessNone = "none"
+)
+
+const (
+	defaultReadinessTimeout  = 30 * time.Second
+	defaultReadinessInterval = 200 * time.Millisecond
+	defaultProbePayload      = "{}"
+	dockerPingTimeout        = 5 * time.Second
+
+	// the lambci runtimes report this variable as version in the START line
+	// of an invocation's log
+	versionEnv = "AWS_LAMBDA_FUNCTION_VERSION"
+)
+
+// readiness configuration
+type readiness struct {
+	method   string
+	timeout  time.Duration // maximum time to wait for the new code
+	interval time.Duration // time between checks
+	payload  string        // no-op invocation payload used for probes
+	docker   *docker.Client
+	probes   *http.Client
+}
+
+// state of a function's server before its code is replaced
+type reloadState struct {
+	serving     bool   // server API answered a probe
+	containerID string // container publishing the port (docker method)
+	startedAt   time.Time
+}
+
+func newReadiness(config *viper.Viper, client *docker.Client) (*readiness, error) {
+
+	r := &readiness{
+		method:   config.GetString("readiness.method"),
+		timeout:  defaultReadinessTimeout,
+		interval: defaultReadinessInterval,
+		payload:  config.GetString("readiness.probe-payload"),
+	}
+
+	if config.IsSet("readiness.timeout") {
+		r.timeout = time.Duration(config.GetInt("readiness.timeout")) * time.Second
+	}
+	if config.IsSet("readiness.interval") {
+		r.interval = time.Duration(config.GetInt("readiness.interval")) * time.Millisecond
+	}
+	if r.payload == "" {
+		r.payload = defaultProbePayload
+	}
+
+	if r.method == "" {
+		// probes depend on the runtime reporting the version, containers
+		// are watched whenever the docker socket can be reached
+		r.method = ReadinessProbe
+		if client != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), dockerPingTimeout)
+			if client.Ping(ctx) == nil {
+				r.method = ReadinessDocker
+			}
+			cancel()
+		}
+	}
+
+	switch r.method {
+	case ReadinessDocker, ReadinessProbe, ReadinessNone:
+	default:
+		return nil, errors.Errorf("unknown readiness method '%s'", r.method)
+	}
+
+	r.docker = client
+	// a probe that takes longer than the whole wait is as good as no answer
+	r.probes = &http.Client{Timeout: r.timeout}
+	return r, nil
+}
+
+// send a probe invocation to the server API at url. Returns whether the server
+// answered and the log of the invocation (if the server returned it). Any HTTP
+// response counts, the function itself may fail on the probe payload.
+func (r *readiness) probe(ctx context.Context, url string) (bool, string) {
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(r.payload))
+	if err != nil {
+		return false, ""
+	}
+	req.Header.Set("X-Amz-Log-Type", "Tail")
+	resp, err := r.probes.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, ""
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	tail, err := base64.StdEncoding.DecodeString(resp.Header.Get("X-Amz-Log-Result"))
+	if err != nil {
+		return true, ""
+	}
+	return true, string(tail)
+}
+
+// returns true if the server API at url answers a probe invocation
+func (r *readiness) serving(ctx context.Context, url string) bool {
+
+	answered, _ := r.probe(ctx, url)
+	return answered
+}
+
+// returns true if the server API at url runs the given version of the function
+func (r *readiness) servingVersion(ctx context.Context, url string, version string) bool {
+
+	answered, tail := r.probe(ctx, url)
+	return answered && strings.Contains(tail, "Version: "+version+"\n")
+}
+
+// find the running container that publishes port
+func (r *readiness) container(ctx context.Context, port int) (*docker.ContainerInfo, error) {
+
+	containers, err := r.docker.ListContainers(ctx, false, map[string][]string{"publish": {strconv.Itoa(port)}})
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, nil
+	}
+	if len(containers) > 1 {
+		return nil, fmt.Errorf("%d containers publish port %d", len(containers), port)
+	}
+	return r.docker.InspectContainer(ctx, containers[0].ID)
+}
+
+// record the state of a function's server before replacing its code
+func (r *readiness) snapshot(port int, url string) (reloadState, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var state reloadState
+	switch r.method {
+	case ReadinessDocker:
+		info, err := r.container(ctx, port)
+		if err != nil {
+			return state, errors.Wrap(err, "error looking up function container")
+		}
+		if info != nil && info.State != nil && info.State.Running {
+			state.serving = true
+			state.containerID = info.ID
+			state.startedAt = info.State.StartedAt
+		}
+	case ReadinessProbe:
+		state.serving = r.serving(ctx, url)
+	}
+	return state, nil
+}
+
+// wait until the function's server serves the code installed after
+// snapshot() returned before. With the probe method the server has to report
+// version, which the install wrote to the function's environment.
+func (r *readiness) wait(port int, url string, before reloadState, version string) error {
+
+	if r.method == ReadinessNone {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	restarted := false
+	for {
+		switch r.method {
+		case ReadinessDocker:
+			if !restarted {
+				info, err := r.container(ctx, port)
+				if err != nil && ctx.Err() == nil {
+					return errors.Wrap(err, "error looking up function container")
+				}
+				restarted = info != nil && info.State != nil && info.State.Running &&
+					(info.ID != before.containerID || !info.State.StartedAt.Equal(before.startedAt))
+			}
+			if restarted && r.serving(ctx, url) {
+				return nil
+			}
+		case ReadinessProbe:
+			if r.servingVersion(ctx, url, version) {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if !before.serving {
+				return errors.Errorf("no container served port %d within %v", port, r.timeout)
+			}
+			if r.method == ReadinessProbe {
+				return errors.Errorf("function container on port %d did not report version %s within %v", port, version, r.timeout)
+			}
+			if !restarted {
+				return errors.Errorf("function container on port %d did not reload within %v", port, r.timeout)
+			}
+			return errors.Errorf("function container on port %d did not serve requests within %v", port, r.timeout)
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// wait until the function's server API answers probes, e.g. after starting a
+// new container
+func (r *readiness) waitServing(url string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	for !r.serving(ctx, url) {
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("server API at %s did not answer within %v", url, r.timeout)
+		case <-time.After(r.interval):
+		}
+	}
+	return nil
+}
+
+// dial the docker socket of the host
+func dockerDialer(dial func(ctx context.Context, network, address string) (net.Conn, error), socket string) docker.DialFunc {
+
+	return func(ctx context.Context) (net.Conn, error) {
+		return dial(ctx, "unix", socket)
+	}
+}
@@ -0,0 +1,138 @@
+package lambcilambda
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serverlessresearch/srk/pkg/docker"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testReadiness(t *testing.T, method string, dial docker.DialFunc) *readiness {
+	var client *docker.Client
+	if dial != nil {
+		client = docker.NewClient(dial)
+	}
+	config := viper.New()
+	config.Set("readiness.method", method)
+	config.Set("readiness.timeout", 2)
+	config.Set("readiness.interval", 10)
+	r, err := newReadiness(config, client)
+	require.Nil(t, err)
+	return r
+}
+
+func TestReadinessConfig(t *testing.T) {
+	r, err := newReadiness(viper.New(), nil)
+	require.Nil(t, err)
+	assert.Equal(t, ReadinessProbe, r.method)
+	assert.Equal(t, defaultReadinessTimeout, r.timeout)
+	assert.Equal(t, defaultProbePayload, r.payload)
+
+	// containers are watched whenever the daemon can be reached
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/_ping", r.URL.Path)
+		w.Write([]byte("OK"))
+	}))
+	dial := func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", daemon.Listener.Addr().String())
+	}
+	r, err = newReadiness(viper.New(), docker.NewClient(dial))
+	require.Nil(t, err)
+	assert.Equal(t, ReadinessDocker, r.method)
+
+	daemon.Close()
+	r, err = newReadiness(viper.New(), docker.NewClient(dial))
+	require.Nil(t, err)
+	assert.Equal(t, ReadinessProbe, r.method)
+
+	config := viper.New()
+	config.Set("readiness.method", "ps")
+	_, err = newReadiness(config, nil)
+	assert.NotNil(t, err)
+}
+
+func TestReadinessProbe(t *testing.T) {
+	// the server reports the new version after a few probes
+	var probes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Tail", r.Header.Get("X-Amz-Log-Type"))
+		version := "$LATEST"
+		if atomic.AddInt32(&probes, 1) > 3 {
+			version = "srk-2"
+		}
+		tail := "START RequestId: 1 Version: " + version + "\nEND RequestId: 1\n"
+		w.Header().Set("X-Amz-Log-Result", base64.StdEncoding.EncodeToString([]byte(tail)))
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	r := testReadiness(t, ReadinessProbe, nil)
+	before, err := r.snapshot(0, server.URL)
+	require.Nil(t, err)
+	assert.True(t, before.serving)
+	assert.Nil(t, r.wait(0, server.URL, before, "srk-2"))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&probes))
+
+	// answering is not enough, the server has to report the version
+	r.timeout = 100 * time.Millisecond
+	err = r.wait(0, server.URL, before, "srk-3")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "did not report version srk-3")
+	err = r.wait(0, server.URL, before, "srk-")
+	assert.NotNil(t, err)
+
+	// nothing serving is an error too
+	err = r.wait(0, "http://127.0.0.1:1/", reloadState{}, "srk-2")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no container served")
+}
+
+func TestReadinessDocker(t *testing.T) {
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer function.Close()
+	port, err := strconv.Atoi(function.URL[strings.LastIndex(function.URL, ":")+1:])
+	require.Nil(t, err)
+
+	// the container is replaced after a few inspections
+	var inspections int32
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/containers/json" {
+			assert.Contains(t, r.URL.Query().Get("filters"), strconv.Itoa(port))
+			w.Write([]byte(`[{"Id": "c1"}]`))
+			return
+		}
+		started := "2020-05-01T10:00:00Z"
+		if atomic.AddInt32(&inspections, 1) > 3 {
+			started = "2020-05-01T10:00:05Z"
+		}
+		fmt.Fprintf(w, `{"Id": "c1", "State": {"Running": true, "StartedAt": "%s"}}`, started)
+	}))
+	defer daemon.Close()
+
+	r := testReadiness(t, ReadinessDocker, func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", daemon.Listener.Addr().String())
+	})
+
+	before, err := r.snapshot(port, function.URL)
+	require.Nil(t, err)
+	assert.True(t, before.serving)
+	assert.Equal(t, "c1", before.containerID)
+	assert.Nil(t, r.wait(port, function.URL, before, ""))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&inspections))
+}
@@ -1,74 +1,113 @@
 package lambcilambda
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os/user"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/serverlessresearch/srk/pkg/docker"
 	"github.com/serverlessresearch/srk/pkg/shell"
 	"github.com/serverlessresearch/srk/pkg/srk"
 
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/pkg/errors"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 )
 
 const (
-	checkDelay = 100 * time.Millisecond
-	maxChecks  = 10
-	envFile    = "env"
-	taskDir    = "task"
-	runtimeDir = "runtime"
-	layersDir  = "layers"
+	envFile      = "env"
+	portFile     = "port"
+	installFile  = "install"
+	taskDir      = "task"
+	runtimeDir   = "runtime"
+	layersDir    = "layers"
+	functionsDir = "functions"
+	// default timeout for commands on the lambci host
+	defaultTimeout = 60 * time.Second
+	// prints "<name> <port>" for every function directory in $1
+	listFunctionsScript = `for d in "$1"/*/; do [ -d "$d" ] || continue; printf '%s %s\n' "$(basename "$d")" "$(cat "$d/port" 2>/dev/null)"; done`
+	// prints file $1 if it exists
+	catIfExistsScript = `[ ! -f "$1" ] || cat "$1"`
 )
 
-// LambCI remote configuration
-type lambciRemote struct {
-	scp  string // path to scp command
-	ssh  string // path to ssh command
-	host string // IP or hostname of server running the lambci/lambda docker image
-	user string // user for scp + ssh
-	pem  string // key file for scp + ssh
+// what srk recorded about the install of a function, stored as JSON in the
+// function's directory
+type installInfo struct {
+	Runtime     string    `json:"runtime"`
+	Layers      []string  `json:"layers,omitempty"`
+	CodeHash    string    `json:"codeHash"`
+	EnvHash     string    `json:"envHash"`
+	InstallTime time.Time `json:"installTime"`
+}
+
+// configuration of a runtime
+type lambciRuntime struct {
+	layers  []string // layers copied to the function's runtime directory
+	image   string   // lambci image of managed containers, empty for the default
+	handler string   // handler of managed containers, empty for the default
 }
 
 // LambCI function service
 type lambciLambda struct {
-	remote         *lambciRemote       // optional remote configuration
-	address        string              // address of lambci server API
-	homeDir        string              // root directory of lambci files
-	runtimes       map[string][]string // runtime configuration
+	host           shell.Remote      // host running the container (local or remote)
+	timeout        time.Duration     // timeout for commands on the host
+	docker         *docker.Client    // docker daemon of the host
+	ready          *readiness        // detects when reinstalled functions serve
+	containers     *containerManager // starts and stops function containers, nil if not managed by srk
+	apiHost        string            // host of the lambci server APIs
+	basePort       int               // port of the first function's server API
+	ports          map[string]int    // server API port of each installed function
+	portsLock      sync.Mutex
+	homeDir        string                   // root directory of lambci files
+	runtimes       map[string]lambciRuntime // runtime configuration
 	defaultRuntime string
+	retry          *srk.RetryPolicy // retries of invocations
 	session        *lambda.Lambda
 	log            srk.Logger
 }
 
 func NewFunctionService(logger srk.Logger, config *viper.Viper) (*lambciLambda, error) {
 
-	var remote *lambciRemote
-	if config.IsSet("remote") {
-		remote = &lambciRemote{
-			scp:  config.GetString("remote.scp"),
-			ssh:  config.GetString("remote.ssh"),
-			host: config.GetString("remote.host"),
-			user: config.GetString("remote.user"),
-			pem:  config.GetString("remote.pem"),
-		}
-		if remote.scp == "" {
-			remote.scp = "scp"
+	var host shell.Remote = &shell.Local{Runner: shell.Runner{Logger: logger}}
+	isRemote := config.IsSet("remote")
+	if isRemote {
+		if config.IsSet("remote.ssh") || config.IsSet("remote.scp") {
+			logger.Warn("the 'remote.ssh' and 'remote.scp' options are ignored, SRK uses a built-in ssh client")
 		}
-		if remote.ssh == "" {
-			remote.ssh = "ssh"
+
+		var err error
+		host, err = shell.NewSSHRemote(shell.SSHConfig{
+			Host:                  config.GetString("remote.host"),
+			User:                  config.GetString("remote.user"),
+			KeyFile:               config.GetString("remote.pem"),
+			KnownHostsFile:        config.GetString("remote.known-hosts"),
+			InsecureIgnoreHostKey: config.GetBool("remote.insecure-ignore-host-key"),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error configuring remote host")
 		}
 	}
 
+	timeout := defaultTimeout
+	if config.IsSet("remote.timeout") {
+		timeout = time.Duration(config.GetInt("remote.timeout")) * time.Second
+	}
+
 	service := &lambciLambda{
-		remote:         remote,
-		address:        config.GetString("address"),
+		host:           host,
+		timeout:        timeout,
 		homeDir:        config.GetString("directory"),
-		runtimes:       make(map[string][]string),
+		runtimes:       make(map[string]lambciRuntime),
 		defaultRuntime: config.GetString("default-runtime"),
 		session:        nil,
 		log:            logger,
@@ -79,36 +118,74 @@ func NewFunctionService(logger srk.Logger, config *viper.Viper) (*lambciLambda,
 		return nil, errors.New("configuration setting 'directory' is required")
 	}
 
-	if remote == nil && strings.HasPrefix(service.homeDir, "~/") {
-		usr, err := user.Current()
-		if err != nil {
-			return nil, errors.Wrap(err, "error loading current user")
+	if strings.HasPrefix(service.homeDir, "~/") {
+		if !isRemote {
+			usr, err := user.Current()
+			if err != nil {
+				return nil, errors.Wrap(err, "error loading current user")
+			}
+			service.homeDir = usr.HomeDir + service.homeDir[1:]
+		} else {
+			// remote paths are relative to the login directory
+			service.homeDir = service.homeDir[2:]
 		}
-		service.homeDir = usr.HomeDir + service.homeDir[1:]
 	}
 
-	_, err := service.exec(fmt.Sprintf("mkdir -p %s %s %s", filepath.Join(service.homeDir, taskDir), filepath.Join(service.homeDir, runtimeDir), filepath.Join(service.homeDir, layersDir)))
+	socket := config.GetString("docker-socket")
+	if socket == "" {
+		// location of the setting in earlier versions
+		socket = config.GetString("readiness.docker-socket")
+	}
+	if socket == "" {
+		socket = docker.DefaultSocket
+	}
+	dockerClient := docker.NewClient(dockerDialer(host.Dial, socket))
+	service.docker = dockerClient
+
+	var err error
+	service.retry, err = srk.NewRetryPolicy(config)
 	if err != nil {
-		return nil, errors.Wrap(err, "error creating lambci directories")
+		return nil, errors.Wrap(err, "error configuring retries")
 	}
 
-	envFilePath := filepath.Join(service.homeDir, envFile)
-	_, err = service.exec(fmt.Sprintf("if [ ! -f %s ]; then touch %s; fi", envFilePath, envFilePath))
+	service.ready, err = newReadiness(config, dockerClient)
 	if err != nil {
-		return nil, errors.Wrap(err, "error creating lambci env file")
+		return nil, errors.Wrap(err, "error configuring readiness detection")
 	}
 
-	for name, config := range config.GetStringMap("runtimes") {
+	service.apiHost, service.basePort, err = SplitAddress(config.GetString("address"))
+	if err != nil {
+		return nil, errors.Wrap(err, "configuration setting 'address' must have the form host:port")
+	}
 
-		runtimeConfig := config.(map[string]interface{})
-		layerConfig := runtimeConfig["layers"].([]interface{})
+	_, err = service.exec("mkdir", "-p", filepath.Join(service.homeDir, functionsDir), filepath.Join(service.homeDir, layersDir))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating lambci directories")
+	}
 
-		layers := make([]string, len(layerConfig))
-		for i := 0; i < len(layerConfig); i++ {
-			layers[i] = layerConfig[i].(string)
+	listing, err := service.exec(shell.Shell, "-c", listFunctionsScript, "sh", filepath.Join(service.homeDir, functionsDir))
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing installed functions")
+	}
+	service.ports = ParseFunctionPorts(listing)
+
+	if config.GetBool("container.manage") {
+		// docker needs absolute paths to mount the function directories
+		hostDir, err := service.exec(shell.Shell, "-c", `cd "$1" && pwd`, "sh", service.homeDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "error resolving lambci directory")
 		}
+		service.containers = newContainerManager(logger, config, dockerClient, strings.TrimSpace(hostDir), timeout)
+	}
+
+	for name, config := range config.GetStringMap("runtimes") {
 
-		service.runtimes[name] = layers
+		runtimeConfig := config.(map[string]interface{})
+		// runtimes may only select the image of managed containers
+		runtime := lambciRuntime{layers: cast.ToStringSlice(runtimeConfig["layers"])}
+		runtime.image, _ = runtimeConfig["image"].(string)
+		runtime.handler, _ = runtimeConfig["handler"].(string)
+		service.runtimes[name] = runtime
 	}
 
 	return service, nil
@@ -141,128 +218,415 @@ func (service *lambciLambda) Install(rawDir string, env map[string]string, runti
 		}
 	}
 
-	// remove old layer
-	_, err := service.exec(fmt.Sprintf("find %s -mindepth 1 -maxdepth 1 -exec rm -r {} +", filepath.Join(service.homeDir, runtimeDir)))
+	fName := filepath.Base(rawDir)
+	fDir := service.functionDir(fName)
+
+	_, err := service.exec("mkdir", "-p", filepath.Join(fDir, taskDir), filepath.Join(fDir, runtimeDir))
 	if err != nil {
-		return errors.Wrap(err, "error removing old layer")
+		return errors.Wrap(err, "error creating function directories")
 	}
 
-	// install new layer
-	if runtime != "" {
-		for _, layer := range service.runtimes[runtime] {
-			// this has to be Exec instead of Copy because it copies on the target machine
-			_, err := service.exec(fmt.Sprintf("cp -r %s %s", filepath.Join(service.homeDir, layersDir, layer, "*"), filepath.Join(service.homeDir, runtimeDir)))
+	// every function is served by its own container on its own port
+	port, err := service.assignPort(fName)
+	if err != nil {
+		return err
+	}
+
+	layers := service.runtimes[runtime].layers
+	envLines := Map2Lines(env)
+	envHash := sha256.Sum256([]byte(envLines))
+	codeHash, err := srk.HashDir(rawDir)
+	if err != nil {
+		return err
+	}
+	installed, err := service.readInstallInfo(fName)
+	if err != nil {
+		return err
+	}
+	info := &installInfo{
+		Runtime:     runtime,
+		Layers:      layers,
+		CodeHash:    codeHash,
+		EnvHash:     hex.EncodeToString(envHash[:]),
+		InstallTime: time.Now(),
+	}
+
+	// layers are compared by name, changes to the layer pool are not noticed
+	runtimeChanged := installed == nil || installed.Runtime != info.Runtime ||
+		strings.Join(installed.Layers, "\n") != strings.Join(info.Layers, "\n")
+	codeChanged := installed == nil || installed.CodeHash != info.CodeHash
+	if !runtimeChanged && !codeChanged && installed.EnvHash == info.EnvHash {
+		service.log.Infof("function '%s' is up to date", fName)
+		return nil
+	}
+
+	// an interrupted copy must not look up to date
+	if _, err := service.exec("rm", "-f", filepath.Join(fDir, installFile)); err != nil {
+		return errors.Wrap(err, "error removing old install information")
+	}
+
+	if runtimeChanged {
+		// remove old layer
+		err = service.clearDir(filepath.Join(fDir, runtimeDir))
+		if err != nil {
+			return errors.Wrap(err, "error removing old layer")
+		}
+
+		// install new layer
+		for _, layer := range layers {
+			// this has to be exec instead of copy because it copies on the target machine
+			_, err := service.exec("cp", "-r", filepath.Join(service.homeDir, layersDir, layer)+"/.", filepath.Join(fDir, runtimeDir))
 			if err != nil {
 				return errors.Wrapf(err, "error installing layer '%s'", layer)
 			}
 		}
 	}
 
-	// remove old task
-	_, err = service.exec(fmt.Sprintf("find %s -mindepth 1 -maxdepth 1 -exec rm -r {} +", filepath.Join(service.homeDir, taskDir)))
-	if err != nil {
-		return errors.Wrap(err, "error removing old task")
+	if codeChanged {
+		// remove old task
+		err = service.clearDir(filepath.Join(fDir, taskDir))
+		if err != nil {
+			return errors.Wrap(err, "error removing old task")
+		}
+
+		// install new task
+		err = service.copy(rawDir, filepath.Join(fDir, taskDir))
+		if err != nil {
+			return errors.Wrap(err, "error installing function")
+		}
 	}
 
-	// install new task
-	_, err = service.copy(filepath.Join(rawDir, "*"), filepath.Join(service.homeDir, taskDir))
+	rawInfo, err := json.Marshal(info)
 	if err != nil {
-		return errors.Wrap(err, "error installing function")
+		return err
+	}
+	if err := service.writeFile(filepath.Join(fDir, installFile), rawInfo); err != nil {
+		return errors.Wrap(err, "error recording install")
+	}
+
+	url := service.invocationURL(fName, port)
+	if service.containers != nil {
+		err = service.writeFile(filepath.Join(fDir, envFile), []byte(envLines))
+		if err != nil {
+			return errors.Wrap(err, "error updating environment")
+		}
+
+		// replace the container so that it serves the new code
+		if err := service.containers.restart(fName, port, service.containerSpec(runtime, envLines)); err != nil {
+			return errors.Wrapf(err, "error starting container of function '%s'", fName)
+		}
+		if err := service.ready.waitServing(url); err != nil {
+			return errors.Wrapf(err, "function '%s' is not serving", fName)
+		}
+		service.log.Infof("function '%s' is served at %s:%d", fName, service.apiHost, port)
+		return nil
 	}
 
-	// retrieve process id of running lambda docker image
-	pid, err := service.exec("ps ax | grep \"LAMBDA\" | grep -v entr | grep -v grep | awk \"{print $1}\"")
+	// remember what is serving now to recognize the reload
+	before, err := service.ready.snapshot(port, url)
 	if err != nil {
-		return errors.Wrap(err, "error retrieving lambda process id")
+		return err
+	}
+
+	// probes recognize the new code by the version it reports
+	version := ""
+	if service.ready.method == ReadinessProbe {
+		version = "srk-" + strconv.FormatInt(info.InstallTime.UnixNano(), 36)
+		versioned := map[string]string{versionEnv: version}
+		for key, value := range env {
+			if key != versionEnv {
+				versioned[key] = value
+			}
+		}
+		envLines = Map2Lines(versioned)
 	}
 
 	// install new env map - this triggers the lambda function reload
-	_, err = service.exec(fmt.Sprintf("echo -n \"%s\" > %s", Map2Lines(env), filepath.Join(service.homeDir, envFile)))
+	err = service.writeFile(filepath.Join(fDir, envFile), []byte(envLines))
 	if err != nil {
 		return errors.Wrap(err, "error updating environment")
 	}
 
-	// wait until function reload happened in case of running lambda docker image
-	if pid != "" {
+	// only return once the new code is serving
+	if err := service.ready.wait(port, url, before, version); err != nil {
+		if !before.serving {
+			return errors.Wrapf(err, "no container is serving function '%s', start one to use the function", fName)
+		}
+		return errors.Wrapf(err, "function '%s' is not serving the new code", fName)
+	}
+	service.log.Infof("function '%s' is served at %s:%d", fName, service.apiHost, port)
+	return nil
+}
 
-		checks := 0
-		for {
-			time.Sleep(checkDelay)
+// Removes a function from the service. Does not affect packages.
+func (service *lambciLambda) Remove(fName string) error {
 
-			newPid, err := service.exec("ps ax | grep \"LAMBDA\" | grep -v entr | grep -v grep | awk \"{print $1}\"")
-			if err != nil {
-				return errors.Wrap(err, "error retrieving lambda process id")
-			}
-			if newPid != "" && newPid != pid {
-				break
-			}
+	service.portsLock.Lock()
+	defer service.portsLock.Unlock()
 
-			if checks >= maxChecks {
-				return errors.Errorf("lambda function container did not reload after %v, giving up", time.Duration(checks)*checkDelay)
-			}
-			checks++
+	if _, exists := service.ports[fName]; !exists {
+		return errors.Errorf("function '%s' is not installed", fName)
+	}
+
+	if service.containers != nil {
+		if err := service.containers.stop(fName); err != nil {
+			return errors.Wrapf(err, "error stopping container of function '%s'", fName)
 		}
 	}
 
+	if _, err := service.exec("rm", "-r", service.functionDir(fName)); err != nil {
+		return errors.Wrapf(err, "error removing function '%s'", fName)
+	}
+	delete(service.ports, fName)
 	return nil
 }
 
-// Removes a function from the service. Does not affect packages.
-func (service *lambciLambda) Remove(fName string) error {
+// Read what srk recorded about the install of a function, nil if nothing was
+// recorded
+func (service *lambciLambda) readInstallInfo(fName string) (*installInfo, error) {
 
-	return nil
+	rawInfo, err := service.exec(shell.Shell, "-c", catIfExistsScript, "sh", filepath.Join(service.functionDir(fName), installFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading install information of function '%s'", fName)
+	}
+	if strings.TrimSpace(rawInfo) == "" {
+		return nil, nil
+	}
+	var info installInfo
+	if err := json.Unmarshal([]byte(rawInfo), &info); err != nil {
+		return nil, errors.Wrapf(err, "invalid install information of function '%s'", fName)
+	}
+	return &info, nil
+}
+
+// List the installed functions, ordered by name
+func (service *lambciLambda) List() ([]srk.FunctionInfo, error) {
+
+	service.portsLock.Lock()
+	names := make([]string, 0, len(service.ports))
+	for name := range service.ports {
+		names = append(names, name)
+	}
+	service.portsLock.Unlock()
+	sort.Strings(names)
+
+	infos := make([]srk.FunctionInfo, 0, len(names))
+	for _, name := range names {
+		info, err := service.Describe(name)
+		if err != nil {
+			return nil, err
+		}
+		// removed in the meantime
+		if info != nil {
+			infos = append(infos, *info)
+		}
+	}
+	return infos, nil
+}
+
+// Describe an installed function. Functions installed by earlier versions of
+// srk have no runtime, code hash and install time.
+func (service *lambciLambda) Describe(fName string) (*srk.FunctionInfo, error) {
+
+	service.portsLock.Lock()
+	port, exists := service.ports[fName]
+	service.portsLock.Unlock()
+	if !exists {
+		return nil, nil
+	}
+
+	fDir := service.functionDir(fName)
+	env, err := service.exec(shell.Shell, "-c", catIfExistsScript, "sh", filepath.Join(fDir, envFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading environment of function '%s'", fName)
+	}
+	install, err := service.readInstallInfo(fName)
+	if err != nil {
+		return nil, err
+	}
+	if install == nil {
+		install = &installInfo{}
+	}
+
+	envMap := Lines2Map(env)
+	if service.ready.method == ReadinessProbe {
+		// written by Install, not part of the function's environment
+		delete(envMap, versionEnv)
+	}
+
+	info := &srk.FunctionInfo{
+		Name:        fName,
+		Runtime:     install.Runtime,
+		Env:         envMap,
+		CodeHash:    install.CodeHash,
+		InstallTime: install.InstallTime,
+		Config: map[string]string{
+			"directory": fDir,
+			"port":      strconv.Itoa(port),
+			"url":       service.invocationURL(fName, port),
+		},
+	}
+	return info, nil
 }
 
 // Invoke function
 // fName: Name of function
 // args: JSON-encoded argument string
-// Returns: function response as a bytes buffer. The exact format of this
-// response may depend on the FaaS service. resp may be nil (indicating no
-// valid response was received)
-func (service *lambciLambda) Invoke(fName string, args string) (*bytes.Buffer, error) {
+// Returns: function response and information about the invocation. resp may
+// be nil (indicating no valid response was received)
+func (service *lambciLambda) Invoke(fName string, args string) (*srk.InvokeResult, error) {
+
+	service.portsLock.Lock()
+	port, exists := service.ports[fName]
+	service.portsLock.Unlock()
+	if !exists || port == 0 {
+		return nil, srk.NewInvokeError(srk.ErrNotFound, fName, errors.New("function is not installed"))
+	}
+
+	url := service.invocationURL(fName, port)
+	if service.containers != nil {
+		if err := service.startContainer(fName, port, url); err != nil {
+			return nil, err
+		}
+	}
 
-	url := fmt.Sprintf("http://%s/2015-03-31/functions/%s/invocations", service.address, fName)
-	return srk.HttpPost(url, args)
+	var resp *srk.InvokeResult
+	err := service.retry.Do(func() (err error) {
+		resp, err = srk.HttpPost(url, args)
+		if err != nil {
+			return srk.HttpInvokeError(fName, err)
+		}
+		if resp.FunctionError {
+			return srk.FunctionInvokeError(fName, resp.Body)
+		}
+		return nil
+	})
+	return resp, err
 }
 
 // Users must call Destroy on any created services to perform cleanup.
 // Failure to destroy may leave the system in an inconsistent state that
 // requires manual intervention.
 func (service *lambciLambda) Destroy() {
-	// nothing to do
+
+	if service.containers != nil {
+		service.containers.stopAll()
+	}
+	if err := service.host.Close(); err != nil {
+		service.log.Warnf("error closing connection to host: %v", err)
+	}
 }
 
 // Report any collected statistics for this service. The collected
 // statistics are dependent on the underlying implementation (you should
 // always check if an expected category is available before reading).
 func (service *lambciLambda) ReportStats() (map[string]float64, error) {
-	// stats not implemented
-	return nil, nil
+
+	return map[string]float64{"srkRetries": float64(service.retry.Retries())}, nil
 }
 
 // Resets all statistics to a 0 state. New calls to ReportStats() will only
 // report new events.
 func (service *lambciLambda) ResetStats() error {
-	// stats not implemented
+
+	service.retry.ResetRetries()
 	return nil
 }
 
-// execute a shell command
-func (service *lambciLambda) exec(cmd string) (string, error) {
+// execute a command (argument vector) on the host
+func (service *lambciLambda) exec(args ...string) (string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), service.timeout)
+	defer cancel()
+	return service.host.Run(ctx, args...)
+}
+
+// start the container of a function unless it is running already
+func (service *lambciLambda) startContainer(fName string, port int, url string) error {
 
-	if service.remote != nil {
-		return shell.Ssh(service.remote.ssh, service.remote.user, service.remote.host, service.remote.pem, cmd)
-	} else {
-		return shell.Sh(cmd)
+	spec := func() (containerSpec, error) {
+		lines, err := service.exec("cat", filepath.Join(service.functionDir(fName), envFile))
+		if err != nil {
+			return containerSpec{}, errors.Wrap(err, "error reading environment")
+		}
+		install, err := service.readInstallInfo(fName)
+		if err != nil {
+			return containerSpec{}, err
+		}
+		runtime := ""
+		if install != nil {
+			runtime = install.Runtime
+		}
+		return service.containerSpec(runtime, lines), nil
+	}
+	ready := func() error {
+		return service.ready.waitServing(url)
+	}
+
+	if err := service.containers.ensure(fName, port, spec, ready); err != nil {
+		return errors.Wrapf(err, "error starting container of function '%s'", fName)
 	}
+	return nil
+}
+
+// what the container of a function with the given runtime and env file runs
+func (service *lambciLambda) containerSpec(runtime string, envLines string) containerSpec {
+
+	config := service.runtimes[runtime]
+	return containerSpec{image: config.image, handler: config.handler, env: ParseEnvLines(envLines)}
 }
 
-// copy files via shell command
-func (service *lambciLambda) copy(src, dst string) (string, error) {
+// url of a function's invocation endpoint
+func (service *lambciLambda) invocationURL(fName string, port int) string {
 
-	if service.remote != nil {
-		return shell.Scp(service.remote.scp, service.remote.user, service.remote.host, service.remote.pem, src, dst)
-	} else {
-		return shell.Cp(src, dst)
+	return fmt.Sprintf("http://%s:%d/2015-03-31/functions/%s/invocations", service.apiHost, port, fName)
+}
+
+// directory of a function on the host
+func (service *lambciLambda) functionDir(fName string) string {
+
+	return filepath.Join(service.homeDir, functionsDir, fName)
+}
+
+// return the port of a function, assigning the next free port to new
+// functions
+func (service *lambciLambda) assignPort(fName string) (int, error) {
+
+	service.portsLock.Lock()
+	defer service.portsLock.Unlock()
+
+	if port := service.ports[fName]; port != 0 {
+		return port, nil
+	}
+
+	port := NextFreePort(service.basePort, service.ports)
+	err := service.writeFile(filepath.Join(service.functionDir(fName), portFile), []byte(strconv.Itoa(port)+"\n"))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error assigning port to function '%s'", fName)
 	}
+	service.ports[fName] = port
+	return port, nil
+}
+
+// remove all contents of a directory on the host
+func (service *lambciLambda) clearDir(dir string) error {
+
+	_, err := service.exec("find", dir, "-mindepth", "1", "-maxdepth", "1", "-exec", "rm", "-r", "{}", "+")
+	return err
+}
+
+// copy the contents of directory src into directory dst on the host
+func (service *lambciLambda) copy(src, dst string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), service.timeout)
+	defer cancel()
+	return service.host.Upload(ctx, src, dst)
+}
+
+// create or replace a file on the host
+func (service *lambciLambda) writeFile(dst string, data []byte) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), service.timeout)
+	defer cancel()
+	return service.host.WriteFile(ctx, dst, data, 0644)
 }
@@ -0,0 +1,153 @@
+package lambcilambda
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListDescribe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-lambci")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// a function installed by this version of srk and one installed before
+	// install information was recorded
+	functions := filepath.Join(dir, "lambci", functionsDir)
+	echoDir := filepath.Join(functions, "echo")
+	require.Nil(t, os.MkdirAll(echoDir, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(echoDir, portFile), []byte("9002"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(echoDir, envFile), []byte("A=1\nB=2\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(echoDir, installFile),
+		[]byte(`{"runtime":"python3.8","codeHash":"abc","installTime":"2020-05-01T10:00:00Z"}`), 0644))
+	oldDir := filepath.Join(functions, "old")
+	require.Nil(t, os.MkdirAll(oldDir, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(oldDir, portFile), []byte("9003"), 0644))
+
+	config := viper.New()
+	config.Set("directory", filepath.Join(dir, "lambci"))
+	config.Set("address", "localhost:9001")
+	service, err := NewFunctionService(logrus.New(), config)
+	require.Nil(t, err)
+	defer service.Destroy()
+
+	info, err := service.Describe("echo")
+	require.Nil(t, err)
+	require.NotNil(t, info)
+	assert.Equal(t, "python3.8", info.Runtime)
+	assert.Equal(t, "abc", info.CodeHash)
+	assert.Equal(t, map[string]string{"A": "1", "B": "2"}, info.Env)
+	assert.True(t, info.InstallTime.Equal(time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "9002", info.Config["port"])
+
+	list, err := service.List()
+	require.Nil(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "echo", list[0].Name)
+	assert.Equal(t, "old", list[1].Name)
+	assert.Equal(t, "", list[1].Runtime)
+	assert.Empty(t, list[1].Env)
+
+	info, err = service.Describe("missing")
+	assert.Nil(t, err)
+	assert.Nil(t, info)
+}
+
+func TestRuntimeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-lambci")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := viper.New()
+	config.Set("directory", filepath.Join(dir, "lambci"))
+	config.Set("address", "localhost:9001")
+	config.Set("runtimes", map[string]interface{}{
+		"with-requests": map[string]interface{}{"layers": []interface{}{"requests"}},
+		"node":          map[string]interface{}{"image": "lambci/lambda:nodejs12.x", "handler": "index.handler"},
+	})
+	service, err := NewFunctionService(logrus.New(), config)
+	require.Nil(t, err)
+	defer service.Destroy()
+
+	assert.Equal(t, []string{"requests"}, service.runtimes["with-requests"].layers)
+	assert.Equal(t, containerSpec{env: []string{"A=1"}}, service.containerSpec("with-requests", "A=1\n"))
+	assert.Equal(t, containerSpec{image: "lambci/lambda:nodejs12.x", handler: "index.handler"},
+		service.containerSpec("node", ""))
+}
+
+func TestInstallSkipsUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-lambci")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	rawDir := filepath.Join(dir, "echo")
+	require.Nil(t, os.MkdirAll(rawDir, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(rawDir, "lambda_function.py"), []byte("pass\n"), 0644))
+	layerDir := filepath.Join(dir, "lambci", layersDir, "requests")
+	require.Nil(t, os.MkdirAll(layerDir, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(layerDir, "requests.py"), []byte("pass\n"), 0644))
+
+	config := viper.New()
+	config.Set("directory", filepath.Join(dir, "lambci"))
+	config.Set("address", "localhost:9001")
+	config.Set("readiness.method", ReadinessNone)
+	config.Set("runtimes", map[string]interface{}{
+		"with-requests": map[string]interface{}{"layers": []interface{}{"requests"}},
+	})
+	service, err := NewFunctionService(logrus.New(), config)
+	require.Nil(t, err)
+	defer service.Destroy()
+
+	fDir := service.functionDir("echo")
+	require.Nil(t, service.Install(rawDir, map[string]string{"A": "1"}, "with-requests"))
+	installed, err := service.readInstallInfo("echo")
+	require.Nil(t, err)
+	require.NotNil(t, installed)
+	assert.Equal(t, []string{"requests"}, installed.Layers)
+	assert.FileExists(t, filepath.Join(fDir, runtimeDir, "requests.py"))
+
+	// files that are not replaced survive the next install
+	marker := func(sub string) string { return filepath.Join(fDir, sub, "marker") }
+	require.Nil(t, ioutil.WriteFile(marker(taskDir), nil, 0644))
+	require.Nil(t, ioutil.WriteFile(marker(runtimeDir), nil, 0644))
+	require.Nil(t, os.Remove(filepath.Join(fDir, envFile)))
+
+	// nothing changed: nothing is copied or written
+	require.Nil(t, service.Install(rawDir, map[string]string{"A": "1"}, "with-requests"))
+	unchanged, err := service.readInstallInfo("echo")
+	require.Nil(t, err)
+	assert.True(t, installed.InstallTime.Equal(unchanged.InstallTime))
+	assert.FileExists(t, marker(taskDir))
+	assert.FileExists(t, marker(runtimeDir))
+	_, err = os.Stat(filepath.Join(fDir, envFile))
+	assert.True(t, os.IsNotExist(err))
+
+	// a new environment is written, code and layers are kept
+	require.Nil(t, service.Install(rawDir, map[string]string{"A": "2"}, "with-requests"))
+	env, err := ioutil.ReadFile(filepath.Join(fDir, envFile))
+	require.Nil(t, err)
+	assert.Equal(t, "A=2\n", string(env))
+	assert.FileExists(t, marker(taskDir))
+	assert.FileExists(t, marker(runtimeDir))
+
+	// a new runtime replaces the layers only
+	require.Nil(t, service.Install(rawDir, map[string]string{"A": "2"}, ""))
+	assert.FileExists(t, marker(taskDir))
+	_, err = os.Stat(marker(runtimeDir))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(fDir, runtimeDir, "requests.py"))
+	assert.True(t, os.IsNotExist(err))
+
+	// new code replaces the task
+	require.Nil(t, ioutil.WriteFile(filepath.Join(rawDir, "lambda_function.py"), []byte("print()\n"), 0644))
+	require.Nil(t, service.Install(rawDir, map[string]string{"A": "2"}, ""))
+	_, err = os.Stat(marker(taskDir))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -2,9 +2,13 @@ package lambcilambda
 
 import (
 	"bytes"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/pkg/errors"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -37,15 +41,125 @@ func NextLayerVersion(layers []string) int {
 	return maxVersion + 1
 }
 
+// split a layer directory name into layer name and version
+// layer directory names are supposed to end with '-<version>', the version is
+// 0 for directories without a version
+func ParseLayerName(layer string) (string, int) {
+
+	i := strings.LastIndex(layer, "-")
+	if i < 0 {
+		return layer, 0
+	}
+	version, err := strconv.Atoi(layer[i+1:])
+	if err != nil || version < 1 {
+		return layer, 0
+	}
+	return layer[:i], version
+}
+
+// parse lines in key=value format (as written by Map2Lines) into a list of
+// environment variables, empty lines and comments are skipped
+func ParseEnvLines(lines string) []string {
+
+	var env []string
+	for _, line := range strings.Split(lines, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		env = append(env, line)
+	}
+	return env
+}
+
+// parse lines in key=value format (as written by Map2Lines) into a map
+func Lines2Map(lines string) map[string]string {
+
+	m := make(map[string]string)
+	for _, line := range ParseEnvLines(lines) {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) == 2 {
+			m[kv[0]] = kv[1]
+		}
+	}
+	return m
+}
+
 // convert a string map to a list of lines in key=value format
+// lines are sorted by key so that the output is deterministic
 func Map2Lines(m map[string]string) string {
 
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
 	var lines bytes.Buffer
-	for key, value := range m {
+	for _, key := range keys {
 		lines.WriteString(key)
 		lines.WriteString("=")
-		lines.WriteString(value)
+		lines.WriteString(m[key])
 		lines.WriteString("\n")
 	}
 	return lines.String()
 }
+
+// parse the output of the function listing script (one "<name> <port>" line
+// per installed function) into a map from function name to port
+// functions without a valid port are reported with port 0
+func ParseFunctionPorts(listing string) map[string]int {
+
+	ports := make(map[string]int)
+	for _, line := range strings.Split(listing, "\n") {
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		port := 0
+		if len(fields) > 1 {
+			if p, err := strconv.Atoi(fields[1]); err == nil {
+				port = p
+			} else {
+				log.Warnf("invalid port '%s' for function '%s'", fields[1], fields[0])
+			}
+		}
+		ports[fields[0]] = port
+	}
+	return ports
+}
+
+// find the lowest port >= basePort that is not used by any function
+func NextFreePort(basePort int, ports map[string]int) int {
+
+	used := make([]int, 0, len(ports))
+	for _, port := range ports {
+		used = append(used, port)
+	}
+	sort.Ints(used)
+
+	next := basePort
+	for _, port := range used {
+		if port == next {
+			next++
+		} else if port > next {
+			break
+		}
+	}
+	return next
+}
+
+// split an address of the form host:port
+func SplitAddress(address string) (string, int, error) {
+
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "invalid address '%s'", address)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "invalid port in address '%s'", address)
+	}
+	return host, port, nil
+}
@@ -19,3 +19,58 @@ func TestMap2Lines(t *testing.T) {
 	assert.Equal(t, "", lambcilambda.Map2Lines(nil))
 	assert.Equal(t, "key1=value1\nkey2=value2\n", lambcilambda.Map2Lines(map[string]string{"key1": "value1", "key2": "value2"}))
 }
+
+func TestParseFunctionPorts(t *testing.T) {
+
+	assert.Equal(t, map[string]int{}, lambcilambda.ParseFunctionPorts(""))
+	assert.Equal(t, map[string]int{"echo": 9001, "sleep": 9003, "broken": 0, "new": 0},
+		lambcilambda.ParseFunctionPorts("echo 9001\nsleep 9003\n\nbroken abc\nnew\n"))
+}
+
+func TestNextFreePort(t *testing.T) {
+
+	assert.Equal(t, 9001, lambcilambda.NextFreePort(9001, nil))
+	assert.Equal(t, 9002, lambcilambda.NextFreePort(9001, map[string]int{"a": 9001, "b": 9003}))
+	assert.Equal(t, 9001, lambcilambda.NextFreePort(9001, map[string]int{"a": 9002, "b": 0}))
+}
+
+func TestSplitAddress(t *testing.T) {
+
+	host, port, err := lambcilambda.SplitAddress("localhost:9001")
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost", host)
+	assert.Equal(t, 9001, port)
+
+	_, _, err = lambcilambda.SplitAddress("localhost")
+	assert.NotNil(t, err)
+}
+
+func TestParseEnvLines(t *testing.T) {
+
+	assert.Nil(t, lambcilambda.ParseEnvLines(""))
+	assert.Equal(t, []string{"key1=value1", "key2=a b"}, lambcilambda.ParseEnvLines("# comment\nkey1=value1\n\nkey2=a b\n"))
+	env := map[string]string{"key1": "value1", "key2": "value2"}
+	assert.Equal(t, []string{"key1=value1", "key2=value2"}, lambcilambda.ParseEnvLines(lambcilambda.Map2Lines(env)))
+}
+
+func TestLines2Map(t *testing.T) {
+
+	assert.Equal(t, map[string]string{}, lambcilambda.Lines2Map(""))
+	env := map[string]string{"key1": "value1", "key2": "a=b"}
+	assert.Equal(t, env, lambcilambda.Lines2Map("# comment\n"+lambcilambda.Map2Lines(env)))
+}
+
+func TestParseLayerName(t *testing.T) {
+
+	name, version := lambcilambda.ParseLayerName("runtime-python37-3")
+	assert.Equal(t, "runtime-python37", name)
+	assert.Equal(t, 3, version)
+
+	name, version = lambcilambda.ParseLayerName("requests")
+	assert.Equal(t, "requests", name)
+	assert.Equal(t, 0, version)
+
+	name, version = lambcilambda.ParseLayerName("runtime-python37")
+	assert.Equal(t, "runtime-python37", name)
+	assert.Equal(t, 0, version)
+}
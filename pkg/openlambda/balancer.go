@@ -0,0 +1,238 @@
+package openlambda
+
+import (
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/spf13/viper"
+)
+
+// Load balancing strategies
+const (
+	// Servers take turns
+	BalanceRoundRobin = "round-robin"
+	// The server with the fewest requests in flight
+	BalanceLeastOutstanding = "least-outstanding"
+	// Each function sticks to one server (for locality), functions move to
+	// the next server on the hash ring if their server is unhealthy
+	BalanceConsistentHash = "consistent-hash"
+)
+
+const (
+	defaultEjectAfter    = 3
+	defaultProbeInterval = 5 * time.Second
+	defaultProbePath     = "/status"
+	// points per server on the hash ring
+	ringReplicas = 100
+)
+
+// Client-side state of a server
+type backend struct {
+	url string
+	// Requests in flight
+	outstanding int64
+	// Consecutive failed requests
+	failures int64
+	// 1 if the server receives requests
+	healthy int32
+	// Completed invocations, failed invocations and total invocation time
+	// (microseconds)
+	nInvoke int64
+	nError  int64
+	tInvoke int64
+}
+
+func (b *backend) isHealthy() bool {
+	return atomic.LoadInt32(&b.healthy) == 1
+}
+
+// A balancer picks the server for an invocation
+type balancer interface {
+	// Returns a healthy server for fName, nil if no server is healthy
+	pick(fName string) *backend
+}
+
+type roundRobin struct {
+	backends []*backend
+	next     uint64
+}
+
+func (r *roundRobin) pick(fName string) *backend {
+	start := atomic.AddUint64(&r.next, 1)
+	for i := range r.backends {
+		b := r.backends[(start+uint64(i))%uint64(len(r.backends))]
+		if b.isHealthy() {
+			return b
+		}
+	}
+	return nil
+}
+
+type leastOutstanding struct {
+	backends []*backend
+	// rotates the start of the search so that ties are spread evenly
+	next uint64
+}
+
+func (l *leastOutstanding) pick(fName string) *backend {
+	start := atomic.AddUint64(&l.next, 1)
+	var best *backend
+	var bestLoad int64
+	for i := range l.backends {
+		b := l.backends[(start+uint64(i))%uint64(len(l.backends))]
+		if !b.isHealthy() {
+			continue
+		}
+		if load := atomic.LoadInt64(&b.outstanding); best == nil || load < bestLoad {
+			best, bestLoad = b, load
+		}
+	}
+	return best
+}
+
+type ringPoint struct {
+	hash    uint64
+	backend *backend
+}
+
+type consistentHash struct {
+	ring []ringPoint
+}
+
+func newConsistentHash(backends []*backend) *consistentHash {
+	c := &consistentHash{}
+	for _, b := range backends {
+		for i := 0; i < ringReplicas; i++ {
+			c.ring = append(c.ring, ringPoint{hashKey(b.url + "#" + strconv.Itoa(i)), b})
+		}
+	}
+	sort.Slice(c.ring, func(i, j int) bool { return c.ring[i].hash < c.ring[j].hash })
+	return c
+}
+
+func (c *consistentHash) pick(fName string) *backend {
+	h := hashKey(fName)
+	start := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].hash >= h })
+	for i := range c.ring {
+		if b := c.ring[(start+i)%len(c.ring)].backend; b.isHealthy() {
+			return b
+		}
+	}
+	return nil
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func newBalancer(strategy string, backends []*backend) (balancer, error) {
+	switch strategy {
+	case BalanceRoundRobin, "":
+		return &roundRobin{backends: backends}, nil
+	case BalanceLeastOutstanding:
+		return &leastOutstanding{backends: backends}, nil
+	case BalanceConsistentHash:
+		return newConsistentHash(backends), nil
+	}
+	return nil, errors.Errorf("Unknown balancer '%s'", strategy)
+}
+
+// Ejects servers after consecutive failures and probes them until they
+// respond again
+type healthChecker struct {
+	ejectAfter    int64
+	probeInterval time.Duration
+	probePath     string
+	client        *http.Client
+	log           srk.Logger
+	stop          chan struct{}
+	wg            sync.WaitGroup
+}
+
+func newHealthChecker(logger srk.Logger, config *viper.Viper) *healthChecker {
+	h := &healthChecker{
+		ejectAfter:    defaultEjectAfter,
+		probeInterval: defaultProbeInterval,
+		probePath:     config.GetString("health.probe-path"),
+		log:           logger,
+		stop:          make(chan struct{}),
+	}
+	if config.IsSet("health.eject-after") {
+		h.ejectAfter = config.GetInt64("health.eject-after")
+	}
+	if config.IsSet("health.probe-interval") {
+		h.probeInterval = time.Duration(config.GetInt("health.probe-interval")) * time.Second
+	}
+	if h.probePath == "" {
+		h.probePath = defaultProbePath
+	}
+	h.client = &http.Client{Timeout: h.probeInterval}
+	return h
+}
+
+// Record the outcome of a request to b. Servers that failed too often in a
+// row are ejected (0 disables ejection).
+func (h *healthChecker) report(b *backend, err error) {
+	if err == nil {
+		atomic.StoreInt64(&b.failures, 0)
+		return
+	}
+	failures := atomic.AddInt64(&b.failures, 1)
+	if h.ejectAfter > 0 && failures >= h.ejectAfter && atomic.CompareAndSwapInt32(&b.healthy, 1, 0) {
+		h.log.Warnf("Ejecting openLambda server %s after %d consecutive failures: %v", b.url, failures, err)
+		h.wg.Add(1)
+		go h.probe(b)
+	}
+}
+
+// Probe an ejected server until it responds
+func (h *healthChecker) probe(b *backend) {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(h.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+
+		resp, err := h.client.Get(b.url + h.probePath)
+		if err != nil {
+			continue
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			continue
+		}
+
+		atomic.StoreInt64(&b.failures, 0)
+		atomic.StoreInt32(&b.healthy, 1)
+		h.log.Infof("openLambda server %s is healthy again", b.url)
+		return
+	}
+}
+
+// Stop all probes
+func (h *healthChecker) close() {
+	close(h.stop)
+	h.wg.Wait()
+}
+
+// Responses that indicate a problem of the server rather than of the function
+func isServerFailure(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,256 @@
+package openlambda
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackends(urls ...string) []*backend {
+	backends := make([]*backend, len(urls))
+	for i, url := range urls {
+		backends[i] = &backend{url: url, healthy: 1}
+	}
+	return backends
+}
+
+func TestRoundRobin(t *testing.T) {
+	backends := newBackends("a", "b", "c")
+	b, err := newBalancer(BalanceRoundRobin, backends)
+	require.Nil(t, err)
+
+	counts := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		counts[b.pick("f").url]++
+	}
+	assert.Equal(t, map[string]int{"a": 10, "b": 10, "c": 10}, counts)
+
+	// unhealthy servers are skipped
+	backends[1].healthy = 0
+	for i := 0; i < 10; i++ {
+		assert.NotEqual(t, "b", b.pick("f").url)
+	}
+
+	for _, backend := range backends {
+		backend.healthy = 0
+	}
+	assert.Nil(t, b.pick("f"))
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	backends := newBackends("a", "b", "c")
+	b, err := newBalancer(BalanceLeastOutstanding, backends)
+	require.Nil(t, err)
+
+	backends[0].outstanding = 2
+	backends[1].outstanding = 1
+	backends[2].outstanding = 3
+	assert.Equal(t, "b", b.pick("f").url)
+
+	backends[1].healthy = 0
+	assert.Equal(t, "a", b.pick("f").url)
+
+	// ties are spread over the servers
+	backends[1].healthy = 1
+	for _, backend := range backends {
+		backend.outstanding = 0
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		counts[b.pick("f").url]++
+	}
+	assert.Len(t, counts, 3)
+}
+
+func TestConsistentHash(t *testing.T) {
+	backends := newBackends("http://w1:5000", "http://w2:5000", "http://w3:5000")
+	b, err := newBalancer(BalanceConsistentHash, backends)
+	require.Nil(t, err)
+
+	// functions stick to their server
+	servers := make(map[string]string)
+	used := make(map[string]bool)
+	for _, fName := range []string{"echo", "sleep", "resize", "hello", "matmul", "cfbench", "io", "net"} {
+		servers[fName] = b.pick(fName).url
+		used[servers[fName]] = true
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, servers[fName], b.pick(fName).url)
+		}
+	}
+	assert.True(t, len(used) > 1, "all functions hashed to the same server")
+
+	// only the functions of an unhealthy server move
+	backends[0].healthy = 0
+	for fName, url := range servers {
+		if url == backends[0].url {
+			assert.NotEqual(t, url, b.pick(fName).url)
+		} else {
+			assert.Equal(t, url, b.pick(fName).url)
+		}
+	}
+}
+
+func TestUnknownBalancer(t *testing.T) {
+	_, err := newBalancer("random", newBackends("a"))
+	assert.NotNil(t, err)
+}
+
+func TestEjectAndProbe(t *testing.T) {
+	var up int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&up) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	config := readConfig(t, `
+olservers : [ "`+server.URL+`" ]
+health :
+  eject-after : 2
+`)
+	health := newHealthChecker(logrus.New(), config)
+	health.probeInterval = 10 * time.Millisecond
+	defer health.close()
+
+	b := newBackends(server.URL)[0]
+	health.report(b, assert.AnError)
+	assert.True(t, b.isHealthy())
+	health.report(b, nil)
+	health.report(b, assert.AnError)
+	assert.True(t, b.isHealthy(), "failures must be consecutive")
+	health.report(b, assert.AnError)
+	assert.False(t, b.isHealthy())
+
+	// the probe fails while the server returns 503
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, b.isHealthy())
+
+	atomic.StoreInt32(&up, 1)
+	require.Eventually(t, b.isHealthy, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&b.failures))
+}
+
+func TestInvokeBalancing(t *testing.T) {
+	var nGood, nBad int32
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&nGood, 1)
+		w.Write([]byte(`{"hello":"world"}`))
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&nBad, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+
+	config := readConfig(t, `
+olservers : [ "`+good.URL+`", "`+bad.URL+`" ]
+balancer : 'round-robin'
+health :
+  eject-after : 3
+  probe-interval : 60
+retry :
+  base-delay : 0.001
+`)
+	service, err := NewConfig(logrus.New(), config)
+	require.Nil(t, err)
+	defer service.Destroy()
+
+	for i := 0; i < 20; i++ {
+		resp, err := service.Invoke("echo", "{}")
+		require.Nil(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusOK, resp.Status)
+		assert.Equal(t, good.URL, resp.Metadata["server"])
+	}
+	// the failing server was ejected after three requests, which were
+	// retried on the other server
+	assert.Equal(t, int32(3), atomic.LoadInt32(&nBad))
+	assert.Equal(t, int32(20), atomic.LoadInt32(&nGood))
+
+	ol := service.(*olConfig)
+	stats := backendStats(ol.backends)
+	assert.Equal(t, 20.0, stats["srkInvocations["+good.URL+"]"])
+	assert.Equal(t, 1.0, stats["srkHealthy["+good.URL+"]"])
+	assert.Equal(t, 3.0, stats["srkErrors["+bad.URL+"]"])
+	assert.Equal(t, 0.0, stats["srkHealthy["+bad.URL+"]"])
+	assert.Equal(t, 0.0, stats["srkOutstanding["+good.URL+"]"])
+	stats = ol.stats.report()
+	assert.Equal(t, 3.0, stats["srkRetries"])
+	assert.Equal(t, 3.0, stats["srkRetries(echo)"])
+	assert.Equal(t, 23.0, stats["srkInvocations"])
+
+	// no server left
+	atomic.StoreInt32(&ol.backends[0].healthy, 0)
+	_, err = service.Invoke("echo", "{}")
+	assert.NotNil(t, err)
+}
+
+func TestInvokeErrors(t *testing.T) {
+	var nRequests int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&nRequests, 1)
+		switch r.URL.Path {
+		case "/run/broken":
+			http.Error(w, "ZeroDivisionError: division by zero", http.StatusInternalServerError)
+		case "/run/missing":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	})
+	server1 := httptest.NewServer(handler)
+	defer server1.Close()
+	server2 := httptest.NewServer(handler)
+	defer server2.Close()
+
+	config := readConfig(t, `
+olservers : [ "`+server1.URL+`", "`+server2.URL+`" ]
+health :
+  eject-after : 1
+retry :
+  base-delay : 0.001
+`)
+	service, err := NewConfig(logrus.New(), config)
+	require.Nil(t, err)
+	defer service.Destroy()
+	ol := service.(*olConfig)
+
+	// errors of the function are neither retried nor count for the health
+	resp, err := service.Invoke("broken", "{}")
+	require.NotNil(t, err)
+	assert.Equal(t, srk.ErrFunction, srk.KindOf(err))
+	assert.Contains(t, err.Error(), "division by zero")
+	require.NotNil(t, resp)
+	assert.True(t, resp.FunctionError)
+	assert.Equal(t, http.StatusInternalServerError, resp.Status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&nRequests))
+
+	_, err = service.Invoke("missing", "{}")
+	assert.Equal(t, srk.ErrNotFound, srk.KindOf(err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&nRequests))
+	assert.True(t, ol.backends[0].isHealthy())
+	assert.True(t, ol.backends[1].isHealthy())
+
+	stats := ol.stats.report()
+	assert.Equal(t, 1.0, stats["srkErrors(broken)"])
+	assert.Equal(t, 1.0, stats["srkErrors(missing)"])
+	assert.Equal(t, 0.0, stats["srkRetries"])
+
+	// connection failures are (a refused connection is not retried)
+	server1.Close()
+	server2.Close()
+	_, err = service.Invoke("echo", "{}")
+	assert.Equal(t, srk.ErrTransport, srk.KindOf(err))
+	assert.NotEqual(t, ol.backends[0].isHealthy(), ol.backends[1].isHealthy())
+}
@@ -0,0 +1,79 @@
+package openlambda
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+)
+
+// Log of a detached worker in the openlambda working directory
+const workerLog = "worker.out"
+
+// Timestamps of the Go log package used by the worker
+const (
+	logTimeFormat       = "2006/01/02 15:04:05"
+	logTimeFormatMicros = "2006/01/02 15:04:05.000000"
+)
+
+// Read the log of the local worker. The worker logs the output of all
+// functions (and its own messages) to the same file, so the log is not
+// limited to fName. Logs of remote servers are not available.
+func (self *olConfig) Logs(fName string, since time.Time) ([]srk.LogEntry, error) {
+
+	if !self.isLocal {
+		return nil, errors.New("Logs are only available for a local openlambda worker")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(self.dir, workerLog))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read the worker log")
+	}
+
+	var entries []srk.LogEntry
+	for _, entry := range parseWorkerLog(string(data)) {
+		if !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Parse the lines of a worker log. Lines without a timestamp (e.g. the
+// traceback of a function) get the time of the previous line.
+func parseWorkerLog(data string) []srk.LogEntry {
+	var entries []srk.LogEntry
+	var last time.Time
+	for _, line := range strings.Split(strings.TrimRight(data, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := srk.LogEntry{Time: last, Message: line}
+		if t, message, ok := parseLogTime(line); ok {
+			entry.Time, entry.Message = t, message
+		}
+		last = entry.Time
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Split a line of the Go log package ("2006/01/02 15:04:05[.000000] message",
+// in local time) into time and message
+func parseLogTime(line string) (time.Time, string, bool) {
+	for _, format := range []string{logTimeFormatMicros, logTimeFormat} {
+		if len(line) < len(format) {
+			continue
+		}
+		if t, err := time.ParseInLocation(format, line[:len(format)], time.Local); err == nil {
+			return t, strings.TrimPrefix(line[len(format):], " "), true
+		}
+	}
+	return time.Time{}, "", false
+}
@@ -0,0 +1,57 @@
+package openlambda
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWorkerLog(t *testing.T) {
+	entries := parseWorkerLog(`2020/05/01 10:00:00 Worker started
+2020/05/01 10:00:01.250000 Invoke echo
+Traceback (most recent call last):
+
+2020/05/01 10:00:02 done
+`)
+	require.Len(t, entries, 4)
+	assert.Equal(t, "Worker started", entries[0].Message)
+	assert.Equal(t, time.Date(2020, 5, 1, 10, 0, 1, 250000000, time.Local), entries[1].Time)
+	assert.Equal(t, "Invoke echo", entries[1].Message)
+	assert.Equal(t, "Traceback (most recent call last):", entries[2].Message)
+	assert.Equal(t, entries[1].Time, entries[2].Time)
+	assert.Equal(t, "done", entries[3].Message)
+}
+
+func TestLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-ol")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, workerLog), []byte("2020/05/01 10:00:00 old\n2020/05/01 10:00:05 new\n"), 0644))
+
+	service, err := NewConfig(logrus.New(), readConfig(t, `
+olservers : [ 'http://localhost:5000' ]
+olcmd : 'true'
+oldir : '`+dir+`'
+`))
+	require.Nil(t, err)
+	defer service.Destroy()
+	ol := service.(*olConfig)
+
+	entries, err := ol.Logs("echo", time.Date(2020, 5, 1, 10, 0, 1, 0, time.Local))
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "new", entries[0].Message)
+
+	// remote servers don't share their logs
+	service, err = NewConfig(logrus.New(), readConfig(t, "olservers : [ 'http://worker1:5000' ]\n"))
+	require.Nil(t, err)
+	defer service.Destroy()
+	_, err = service.(*olConfig).Logs("echo", time.Time{})
+	assert.NotNil(t, err)
+}
@@ -3,26 +3,20 @@ package openlambda
 
 import (
 	"bytes"
-	"encoding/json"
-	"io/ioutil"
+	"context"
 	"net/http"
-	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/shell"
 	"github.com/serverlessresearch/srk/pkg/srk"
 	"github.com/spf13/viper"
 )
 
-type olStats struct {
-	tInvoke int64
-	nInvoke int64
-}
-
 type olConfig struct {
 	// Command to run base openlambda manager ('ol')
 	cmd string
@@ -30,8 +24,21 @@ type olConfig struct {
 	dir string
 	// List of URL (including port) to send invocations to
 	urls []string
-	// Atomically increments for every message sent (urls[lastUrl % len(urls)] is the last used URL)
-	lastUrl uint64
+	// Servers and the registries to install packages to
+	servers []olServer
+	// Timeout for registry operations
+	registryTimeout time.Duration
+	// Runtime configuration
+	runtimes       map[string]olRuntime
+	defaultRuntime string
+	// Client-side state of every server, in the order of urls
+	backends []*backend
+	// Picks the server of every invocation
+	balancer balancer
+	// Ejects failing servers and brings them back
+	health *healthChecker
+	// Retries of failed invocations
+	retry *srk.RetryPolicy
 	// Tracks whether we are interacting with a local OL server or remote
 	isLocal bool
 	log     srk.Logger
@@ -42,21 +49,46 @@ func NewConfig(logger srk.Logger, config *viper.Viper) (srk.FunctionService, err
 	if !config.IsSet("olservers") {
 		return nil, errors.New("Option 'olservers' is required")
 	}
-	urls := config.GetStringSlice("olservers")
-	isLocal := (len(urls) == 1 && urls[0][:16] == "http://localhost")
+	servers, err := parseServers(config, config.GetString("oldir"))
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, len(servers))
+	for i, server := range servers {
+		urls[i] = server.url
+	}
+	isLocal := (len(urls) == 1 && isLocalURL(urls[0]))
 
 	if isLocal && !(config.IsSet("olcmd") && config.IsSet("oldir")) {
 		return nil, errors.New("Options 'olcmd' and 'oldir' are required in local mode")
 	}
 
 	olCfg := &olConfig{
-		cmd:     config.GetString("olcmd"),
-		dir:     config.GetString("oldir"),
-		urls:    urls,
-		lastUrl: 0,
-		isLocal: isLocal,
-		log:     logger,
-		stats:   olStats{0, 0},
+		cmd:             config.GetString("olcmd"),
+		dir:             config.GetString("oldir"),
+		urls:            urls,
+		servers:         servers,
+		registryTimeout: defaultRegistryTimeout,
+		isLocal:         isLocal,
+		log:             logger,
+	}
+	if olCfg.runtimes, err = parseRuntimes(config); err != nil {
+		return nil, err
+	}
+	olCfg.defaultRuntime = config.GetString("default-runtime")
+	if config.IsSet("registry-timeout") {
+		olCfg.registryTimeout = time.Duration(config.GetInt("registry-timeout")) * time.Second
+	}
+	olCfg.backends = make([]*backend, len(urls))
+	for i, url := range urls {
+		olCfg.backends[i] = &backend{url: url, healthy: 1}
+	}
+	if olCfg.balancer, err = newBalancer(config.GetString("balancer"), olCfg.backends); err != nil {
+		return nil, err
+	}
+	olCfg.health = newHealthChecker(logger, config)
+	if olCfg.retry, err = srk.NewRetryPolicy(config); err != nil {
+		return nil, err
 	}
 
 	if err := olCfg.launchOlWorker(); err != nil {
@@ -67,117 +99,247 @@ func NewConfig(logger srk.Logger, config *viper.Viper) (srk.FunctionService, err
 }
 
 func (self *olConfig) ReportStats() (map[string]float64, error) {
-	olResp, err := http.Post(self.urls[0]+"/stats", "application/json", strings.NewReader(""))
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to POST stats request to ol worker")
+	stats := self.stats.report()
+	for k, v := range backendStats(self.backends) {
+		stats[k] = v
 	}
 
-	respBuf, err := ioutil.ReadAll(olResp.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to read stats response")
-	}
-
-	stats := make(map[string]float64)
-
-	var rawDecoded interface{}
-	if err = json.Unmarshal(respBuf, &rawDecoded); err != nil {
-		return nil, errors.Wrap(err, "Failed to interpret OL statistics")
-	}
-
-	decoded := rawDecoded.(map[string]interface{})
-	for k, v := range decoded {
-		if floatv, ok := v.(float64); ok {
-			stats[k] = floatv
-		} else {
-			self.log.Warnf("Ignoring non-numeric statistics result from openLambda: %v=%v", k, v)
+	// servers that are down must not hide the statistics of the others
+	var failed []string
+	for _, url := range self.urls {
+		serverStats, err := self.serverStats(url)
+		if err != nil {
+			self.log.Warnf("Failed to get statistics of openLambda server %s: %v", url, err)
+			failed = append(failed, url)
+			continue
 		}
+		for k, v := range serverStats {
+			stats[k] = v
+		}
+	}
+	if len(failed) == len(self.urls) {
+		return nil, errors.Errorf("Failed to get statistics of openLambda servers %v", failed)
 	}
-	stats["srkInvoke"] = (float64)(self.stats.tInvoke) / (float64)(self.stats.nInvoke)
 
 	return stats, nil
 }
 
 func (self *olConfig) ResetStats() error {
-	//Reset the statistics
-	_, err := http.Post(self.urls[0]+"/stats", "application/json", strings.NewReader("reset"))
-	if err != nil {
-		return err
+	self.stats.reset()
+	resetBackendStats(self.backends)
+
+	var failed []string
+	for _, url := range self.urls {
+		if _, err := postStats(url, "reset"); err != nil {
+			self.log.Warnf("Failed to reset statistics of openLambda server %s: %v", url, err)
+			failed = append(failed, url)
+		}
+	}
+	if len(failed) == len(self.urls) {
+		return errors.Errorf("Failed to reset statistics of openLambda servers %v", failed)
 	}
-	self.stats.tInvoke = 0
-	self.stats.nInvoke = 0
 	return nil
 }
 
+// Package the function as a tar.gz file, unless the package is up to date
 func (self *olConfig) Package(rawDir string) (string, error) {
-	if !self.isLocal {
-		return "", errors.New("'Package' command is only supported in local mode")
-	}
 	tarPath := filepath.Clean(rawDir) + ".tar.gz"
-	rerr := srk.TarDir(rawDir, rawDir, tarPath)
+	built, rerr := srk.BuildArchive(rawDir, tarPath, srk.TarDir)
 	if rerr != nil {
 		return "", rerr
 	}
+	if !built {
+		self.log.Info("Package is up to date: " + tarPath)
+	}
 	return tarPath, nil
 }
 
 func (self *olConfig) Install(rawDir string, env map[string]string, runtime string) error {
-	if !self.isLocal {
-		return errors.New("'Install' command is only supported in local mode")
-	}
-	if env != nil {
-		return errors.New("support for environment vars is not implemented yet")
+	fName := filepath.Base(filepath.Clean(rawDir))
+	tarPath := filepath.Clean(rawDir) + ".tar.gz"
+	if err := checkPackage(tarPath); err != nil {
+		return err
 	}
-	if runtime != "" {
-		return errors.New("support for runtime is not implemented yet")
+
+	installPath, cleanup, err := self.buildInstallPackage(tarPath, fName, env, runtime)
+	if err != nil {
+		return err
 	}
+	defer cleanup()
 
-	tarPath := filepath.Clean(rawDir) + ".tar.gz"
+	return self.installPackage(installPath, fName)
+}
 
-	installPath := filepath.Join(self.dir, "registry", filepath.Base(tarPath))
-	if err := srk.CopyFile(tarPath, installPath); err != nil {
+func (self *olConfig) Remove(fName string) error {
+	if err := self.removePackage(filepath.Base(filepath.Clean(fName))); err != nil {
 		return err
 	}
-	self.log.Info("Open Lambda function installed to: " + installPath)
+	self.log.Info("Open Lambda function removed")
 	return nil
 }
 
-func (self *olConfig) Remove(fName string) error {
-	if !self.isLocal {
-		return errors.New("'Remove' command is only supported in local mode")
+// List the functions in the registries of all servers. The hash is the
+// SHA-256 of the installed package, which includes the runtime files and the
+// environment, so they are not reported separately.
+func (self *olConfig) List() ([]srk.FunctionInfo, error) {
+	infos := make(map[string]*srk.FunctionInfo)
+	err := self.forEachRegistry(func(ctx context.Context, r registry) error {
+		packages, err := r.list(ctx)
+		if err == errListUnsupported {
+			self.log.Warnf("Registry %s can't be listed, its functions are missing", r)
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to list registry %s", r)
+		}
+		for _, p := range packages {
+			if infos[p.name] == nil {
+				infos[p.name] = &srk.FunctionInfo{Name: p.name}
+			}
+			addPackageInfo(infos[p.name], r, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	tarPath := filepath.Clean(fName) + ".tar.gz"
+	list := make([]srk.FunctionInfo, 0, len(infos))
+	for _, info := range infos {
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
 
-	installPath := filepath.Join(self.dir, "registry", filepath.Base(tarPath))
-	if err := os.Remove(installPath); err != nil {
-		return err
+func (self *olConfig) Describe(fName string) (*srk.FunctionInfo, error) {
+	var info *srk.FunctionInfo
+	err := self.forEachRegistry(func(ctx context.Context, r registry) error {
+		p, err := r.stat(ctx, fName)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read %s from registry %s", fName, r)
+		}
+		if p != nil {
+			if info == nil {
+				info = &srk.FunctionInfo{Name: fName}
+			}
+			addPackageInfo(info, r, *p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Add the package of a function in registry r to its description. The
+// install time is the time of the latest install to any registry.
+func addPackageInfo(info *srk.FunctionInfo, r registry, p packageInfo) {
+	if info.Config == nil {
+		info.Config = make(map[string]string)
+	}
+	if info.CodeHash == "" {
+		info.CodeHash = p.hash
+	} else if info.CodeHash != p.hash {
+		info.Config["hash-mismatch"] = "true"
+	}
+	if p.modTime.After(info.InstallTime) {
+		info.InstallTime = p.modTime
+	}
+	if registries := info.Config["registries"]; registries != "" {
+		info.Config["registries"] = registries + "," + r.String()
+	} else {
+		info.Config["registries"] = r.String()
 	}
-	self.log.Info("Open Lambda function removed")
-	return nil
 }
 
 func (self *olConfig) Destroy() {
+	self.health.close()
+	self.closeRegistries()
 	if self.isLocal {
 		self.terminateOlWorker()
 	}
 }
 
-func (self *olConfig) Invoke(fName string, args string) (resp *bytes.Buffer, rerr error) {
-	// Round-robin between servers
-	urlx := atomic.AddUint64(&self.lastUrl, 1) % uint64(len(self.urls))
-	url := self.urls[urlx]
-	start := time.Now()
-	olResp, err := http.Post(url+"/run/"+fName, "application/json", strings.NewReader(args))
+// Invoke a function, failed attempts are retried according to the retry
+// policy (each attempt may go to another server)
+func (self *olConfig) Invoke(fName string, args string) (resp *srk.InvokeResult, rerr error) {
+	attempts := 0
+	rerr = self.retry.Do(func() (err error) {
+		if attempts++; attempts > 1 {
+			self.stats.recordRetry(fName)
+		}
+		resp, err = self.invokeOnce(fName, args)
+		return err
+	})
+	return resp, rerr
+}
+
+// Invoke a function on one server. The worker reports errors raised by the
+// function with status 500.
+func (self *olConfig) invokeOnce(fName string, args string) (*srk.InvokeResult, error) {
+	b := self.balancer.pick(fName)
+	if b == nil {
+		self.stats.recordError(fName)
+		return nil, srk.NewInvokeError(srk.ErrTransport, fName, errors.New("No healthy openLambda server"))
+	}
+
+	atomic.AddInt64(&b.outstanding, 1)
+	defer atomic.AddInt64(&b.outstanding, -1)
+
+	url := b.url + "/run/" + fName
+	timer := srk.StartInvokeTimer()
+	request, err := http.NewRequest("POST", url, strings.NewReader(args))
+	if err != nil {
+		self.stats.recordError(fName)
+		return nil, errors.Wrap(err, "Failed to create request to ol worker")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	olResp, err := http.DefaultClient.Do(request.WithContext(timer.Context(context.Background())))
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to POST request to ol worker")
+		atomic.AddInt64(&b.nError, 1)
+		self.stats.recordError(fName)
+		self.health.report(b, err)
+		return nil, srk.HttpInvokeError(fName, errors.Wrap(err, "Failed to POST request to ol worker"))
 	}
 	respBuf := new(bytes.Buffer)
-	respBuf.ReadFrom(olResp.Body)
+	_, err = respBuf.ReadFrom(olResp.Body)
+	olResp.Body.Close()
+	if err != nil {
+		err = errors.Wrap(err, "Failed to read response of ol worker")
+	} else if olResp.StatusCode != http.StatusOK && olResp.StatusCode != http.StatusInternalServerError {
+		err = &srk.HttpStatusError{Method: "POST", Url: url, Status: olResp.Status, Code: olResp.StatusCode}
+	}
+	// only failures of the server count for its health
+	if statusErr, ok := err.(*srk.HttpStatusError); ok && !isServerFailure(statusErr.Code) {
+		self.health.report(b, nil)
+	} else {
+		self.health.report(b, err)
+	}
+
+	result := &srk.InvokeResult{
+		Body:          respBuf.Bytes(),
+		Status:        olResp.StatusCode,
+		FunctionError: olResp.StatusCode == http.StatusInternalServerError,
+		Metadata:      map[string]string{"server": b.url},
+		Timing:        timer.Timing(),
+	}
+	if err != nil {
+		err = srk.HttpInvokeError(fName, err)
+	} else if result.FunctionError {
+		err = srk.FunctionInvokeError(fName, result.Body)
+	}
+	if err != nil {
+		atomic.AddInt64(&b.nError, 1)
+	}
 
-	atomic.AddInt64(&self.stats.tInvoke, time.Since(start).Microseconds())
-	atomic.AddInt64(&self.stats.nInvoke, 1)
+	elapsed := result.Timing.Total.Microseconds()
+	self.stats.record(fName, elapsed, err != nil)
+	atomic.AddInt64(&b.tInvoke, elapsed)
+	atomic.AddInt64(&b.nInvoke, 1)
 
-	return respBuf, nil
+	return result, err
 }
 
 // Launch the open lambda worker process in the background. Returns when the
@@ -190,9 +352,8 @@ func (self *olConfig) launchOlWorker() error {
 	http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost = 0
 
 	if self.isLocal {
-		cmd := exec.Command(self.cmd, "worker", "-d", "--path="+self.dir)
-		if out, err := cmd.CombinedOutput(); err != nil {
-			return errors.Wrap(err, string(out))
+		if _, err := shell.Run(context.Background(), self.cmd, "worker", "-d", "--path="+self.dir); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -200,9 +361,8 @@ func (self *olConfig) launchOlWorker() error {
 
 // Clean up the open lambda worker launched by launchOlWorker()
 func (self *olConfig) terminateOlWorker() error {
-	cmd := exec.Command(self.cmd, "kill", "--path="+self.dir)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return errors.Wrap(err, "Failed to terminate the open lambda worker:\n"+string(out))
+	if _, err := shell.Run(context.Background(), self.cmd, "kill", "--path="+self.dir); err != nil {
+		return errors.Wrap(err, "Failed to terminate the open lambda worker")
 	}
 	return nil
 }
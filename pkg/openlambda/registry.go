@@ -0,0 +1,458 @@
+package openlambda
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/shell"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// Registry types
+const (
+	// A directory on the local host
+	RegistryLocal = "local"
+	// A directory on a remote host, accessed via ssh
+	RegistrySSH = "ssh"
+	// An HTTP endpoint that accepts PUT and DELETE of packages (e.g. WebDAV)
+	RegistryHTTP = "http"
+)
+
+// Default timeout for registry operations
+const defaultRegistryTimeout = 60 * time.Second
+
+// A registry is where an OL worker loads function packages from. Packages
+// are stored as NAME.tar.gz.
+type registry interface {
+	// Add (or replace) the package of function fName
+	install(ctx context.Context, tarPath string, fName string) error
+	// Remove the package of function fName
+	remove(ctx context.Context, fName string) error
+	// List the installed packages. Registries that can't be listed return
+	// errListUnsupported.
+	list(ctx context.Context) ([]packageInfo, error)
+	// Information about the package of function fName, nil if it is not
+	// installed
+	stat(ctx context.Context, fName string) (*packageInfo, error)
+	// Release any connections held by the registry
+	close() error
+	// Location of the registry, registries with the same location are only
+	// used once
+	String() string
+}
+
+// Returned by registries that can't list their packages
+var errListUnsupported = errors.New("Registry can't list its packages")
+
+// A package in a registry
+type packageInfo struct {
+	name string
+	// hex SHA-256 of the package
+	hash    string
+	modTime time.Time
+}
+
+// Prints "<name> <mtime> <sha256>" for every package in directory $1 (or
+// only for package $2 if given)
+const listPackagesScript = `for f in "$1"/${2:-*}.tar.gz; do [ -f "$f" ] || continue; printf '%s %s %s\n' "$(basename "$f" .tar.gz)" "$(stat -c %Y "$f")" "$(sha256sum < "$f" | cut -d ' ' -f 1)"; done`
+
+// A registry directory on the local host or on a remote host
+type dirRegistry struct {
+	host     shell.Remote
+	hostName string
+	dir      string
+}
+
+// The package is uploaded to a hidden name in the registry and renamed once it
+// is complete, so that workers never load a partial package
+func (r *dirRegistry) install(ctx context.Context, tarPath string, fName string) error {
+	dst := path.Join(r.dir, fName+".tar.gz")
+	tmp := path.Join(r.dir, "."+fName+".tar.gz.upload")
+	if err := r.host.Upload(ctx, tarPath, tmp); err != nil {
+		r.host.Run(ctx, "rm", "-f", tmp)
+		return err
+	}
+	if _, err := r.host.Run(ctx, "mv", "-f", tmp, dst); err != nil {
+		r.host.Run(ctx, "rm", "-f", tmp)
+		return err
+	}
+	return nil
+}
+
+func (r *dirRegistry) remove(ctx context.Context, fName string) error {
+	_, err := r.host.Run(ctx, "rm", path.Join(r.dir, fName+".tar.gz"))
+	return err
+}
+
+func (r *dirRegistry) list(ctx context.Context) ([]packageInfo, error) {
+	return r.listPackages(ctx, "")
+}
+
+func (r *dirRegistry) stat(ctx context.Context, fName string) (*packageInfo, error) {
+	packages, err := r.listPackages(ctx, fName)
+	if err != nil || len(packages) == 0 {
+		return nil, err
+	}
+	return &packages[0], nil
+}
+
+func (r *dirRegistry) listPackages(ctx context.Context, fName string) ([]packageInfo, error) {
+	out, err := r.host.Run(ctx, shell.Shell, "-c", listPackagesScript, "sh", r.dir, fName)
+	if err != nil {
+		return nil, err
+	}
+	var packages []packageInfo
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		mtime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("Invalid modification time of package %s: %s", fields[0], fields[1])
+		}
+		packages = append(packages, packageInfo{name: fields[0], hash: fields[2], modTime: time.Unix(mtime, 0)})
+	}
+	return packages, nil
+}
+
+func (r *dirRegistry) close() error {
+	return r.host.Close()
+}
+
+func (r *dirRegistry) String() string {
+	if r.hostName == "" {
+		return r.dir
+	}
+	return r.hostName + ":" + r.dir
+}
+
+// A registry served over HTTP
+type httpRegistry struct {
+	url    string
+	client *http.Client
+}
+
+func (r *httpRegistry) install(ctx context.Context, tarPath string, fName string) error {
+	data, err := ioutil.ReadFile(tarPath)
+	if err != nil {
+		return err
+	}
+	return r.do(ctx, http.MethodPut, fName, data)
+}
+
+func (r *httpRegistry) remove(ctx context.Context, fName string) error {
+	return r.do(ctx, http.MethodDelete, fName, nil)
+}
+
+func (r *httpRegistry) list(ctx context.Context) ([]packageInfo, error) {
+	return nil, errListUnsupported
+}
+
+// Download the package to hash it, the modification time is taken from the
+// Last-Modified header (if the server sends one)
+func (r *httpRegistry) stat(ctx context.Context, fName string) (*packageInfo, error) {
+	url := r.packageURL(fName)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode >= 300 {
+		return nil, errors.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return nil, err
+	}
+	info := &packageInfo{name: fName, hash: hex.EncodeToString(hash.Sum(nil))}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.modTime = modTime
+	}
+	return info, nil
+}
+
+func (r *httpRegistry) packageURL(fName string) string {
+	return strings.TrimSuffix(r.url, "/") + "/" + fName + ".tar.gz"
+}
+
+func (r *httpRegistry) do(ctx context.Context, method string, fName string, data []byte) error {
+	url := r.packageURL(fName)
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("%s %s returned %s: %s", method, url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (r *httpRegistry) close() error {
+	return nil
+}
+
+func (r *httpRegistry) String() string {
+	return r.url
+}
+
+// An OL worker and the registry it loads packages from (nil if packages
+// can't be installed from SRK)
+type olServer struct {
+	url      string
+	registry registry
+}
+
+// Parse the 'olservers' option. Servers are either given as URL or as a map
+// with the URL and the configuration of the server's registry:
+//
+//   olservers :
+//     - 'http://localhost:5000'
+//     - url : 'http://worker1:5000'
+//       registry :
+//         type : 'ssh'
+//         host : 'worker1'
+//         ...
+//
+// localDir is used as registry of local servers without a registry
+// configuration. Servers sharing a registry share the same registry object.
+func parseServers(config *viper.Viper, localDir string) ([]olServer, error) {
+	var rawServers []interface{}
+	switch v := config.Get("olservers").(type) {
+	case []interface{}:
+		rawServers = v
+	case []string:
+		for _, url := range v {
+			rawServers = append(rawServers, url)
+		}
+	default:
+		return nil, errors.New("Option 'olservers' must be a list")
+	}
+
+	servers := make([]olServer, 0, len(rawServers))
+	registries := make(map[string]registry)
+	for i, rawServer := range rawServers {
+		var server olServer
+		var registryCfg map[string]interface{}
+
+		if url, ok := rawServer.(string); ok {
+			server.url = url
+		} else {
+			serverCfg, err := cast.ToStringMapE(rawServer)
+			if err != nil {
+				return nil, errors.Errorf("Server %d in 'olservers' must be a URL or a map", i)
+			}
+			server.url = cast.ToString(serverCfg["url"])
+			if serverCfg["registry"] != nil {
+				if registryCfg, err = cast.ToStringMapE(serverCfg["registry"]); err != nil {
+					return nil, errors.Errorf("Invalid registry configuration of server %s", server.url)
+				}
+			}
+		}
+		if server.url == "" {
+			return nil, errors.Errorf("Server %d in 'olservers' has no URL", i)
+		}
+		server.url = strings.TrimSuffix(server.url, "/")
+
+		var err error
+		if registryCfg != nil {
+			server.registry, err = newRegistry(registryCfg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid registry configuration of server %s", server.url)
+			}
+		} else if isLocalURL(server.url) && localDir != "" {
+			server.registry = &dirRegistry{host: &shell.Local{}, dir: filepath.Join(localDir, "registry")}
+		}
+
+		if server.registry != nil {
+			if existing, ok := registries[server.registry.String()]; ok {
+				server.registry.close()
+				server.registry = existing
+			} else {
+				registries[server.registry.String()] = server.registry
+			}
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+func newRegistry(config map[string]interface{}) (registry, error) {
+	registryType := cast.ToString(config["type"])
+	dir := cast.ToString(config["dir"])
+
+	switch registryType {
+	case RegistryLocal, "":
+		if dir == "" {
+			return nil, errors.New("Option 'dir' is required")
+		}
+		dir, err := homedir.Expand(dir)
+		if err != nil {
+			return nil, err
+		}
+		return &dirRegistry{host: &shell.Local{}, dir: dir}, nil
+
+	case RegistrySSH:
+		if dir == "" {
+			return nil, errors.New("Option 'dir' is required")
+		}
+		// remote paths are relative to the login directory
+		dir = strings.TrimPrefix(dir, "~/")
+
+		sshCfg := shell.SSHConfig{
+			Host:                  cast.ToString(config["host"]),
+			User:                  cast.ToString(config["user"]),
+			KeyFile:               cast.ToString(config["pem"]),
+			KnownHostsFile:        cast.ToString(config["known-hosts"]),
+			InsecureIgnoreHostKey: cast.ToBool(config["insecure-ignore-host-key"]),
+		}
+		host, err := shell.NewSSHRemote(sshCfg)
+		if err != nil {
+			return nil, err
+		}
+		return &dirRegistry{host: host, hostName: sshCfg.Host, dir: dir}, nil
+
+	case RegistryHTTP:
+		url := cast.ToString(config["url"])
+		if url == "" {
+			return nil, errors.New("Option 'url' is required")
+		}
+		return &httpRegistry{url: url, client: &http.Client{}}, nil
+	}
+	return nil, errors.Errorf("Unknown registry type '%s'", registryType)
+}
+
+// Install a package to the registries of all servers. Registries that have
+// the same package already are skipped.
+func (self *olConfig) installPackage(tarPath string, fName string) error {
+	hash, err := fileHash(tarPath)
+	if err != nil {
+		return err
+	}
+	return self.forEachRegistry(func(ctx context.Context, r registry) error {
+		if installed, err := r.stat(ctx, fName); err != nil {
+			self.log.Warnf("Failed to check package %s in registry %s: %v", fName, r, err)
+		} else if installed != nil && installed.hash == hash {
+			self.log.Info("Open Lambda function is up to date in: " + r.String())
+			return nil
+		}
+
+		if err := r.install(ctx, tarPath, fName); err != nil {
+			return errors.Wrapf(err, "Failed to install %s to registry %s", fName, r)
+		}
+		self.log.Info("Open Lambda function installed to: " + r.String())
+		return nil
+	})
+}
+
+// Remove a package from the registries of all servers
+func (self *olConfig) removePackage(fName string) error {
+	return self.forEachRegistry(func(ctx context.Context, r registry) error {
+		if err := r.remove(ctx, fName); err != nil {
+			return errors.Wrapf(err, "Failed to remove %s from registry %s", fName, r)
+		}
+		return nil
+	})
+}
+
+// Call f once for every distinct registry. Fails if no server has a
+// registry, warns about servers without one.
+func (self *olConfig) forEachRegistry(f func(ctx context.Context, r registry) error) error {
+	done := make(map[registry]bool)
+	var missing []string
+	for _, server := range self.servers {
+		if server.registry == nil {
+			missing = append(missing, server.url)
+			continue
+		}
+		if done[server.registry] {
+			continue
+		}
+		done[server.registry] = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), self.registryTimeout)
+		err := f(ctx, server.registry)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(done) == 0 {
+		return errors.New("No registry configured for any server in 'olservers'")
+	}
+	if len(missing) > 0 {
+		self.log.Warnf("No registry configured for servers %v, they may not find the function", missing)
+	}
+	return nil
+}
+
+// Close the connections of all registries
+func (self *olConfig) closeRegistries() {
+	done := make(map[registry]bool)
+	for _, server := range self.servers {
+		if server.registry == nil || done[server.registry] {
+			continue
+		}
+		done[server.registry] = true
+		if err := server.registry.close(); err != nil {
+			self.log.Warnf("Failed to close registry %s: %v", server.registry, err)
+		}
+	}
+}
+
+// hex SHA-256 of a file
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func isLocalURL(url string) bool {
+	return strings.HasPrefix(url, "http://localhost") || strings.HasPrefix(url, "http://127.0.0.1")
+}
+
+// Make sure the package of a function exists before installing it
+func checkPackage(tarPath string) error {
+	if _, err := os.Stat(tarPath); err != nil {
+		return errors.Wrapf(err, "Package %s not found, run 'srk function package' first", tarPath)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package openlambda
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readConfig(t *testing.T, yaml string) *viper.Viper {
+	config := viper.New()
+	config.SetConfigType("yaml")
+	require.Nil(t, config.ReadConfig(bytes.NewBufferString(yaml)))
+	return config
+}
+
+func TestParseServers(t *testing.T) {
+	config := readConfig(t, `
+olservers :
+  - 'http://localhost:5000/'
+  - url : 'http://worker1:5000'
+    registry :
+      type : 'http'
+      url : 'http://registry:8080/registry'
+  - url : 'http://worker2:5000'
+    registry :
+      type : 'http'
+      url : 'http://registry:8080/registry'
+  - 'http://worker3:5000'
+`)
+	servers, err := parseServers(config, "/ol")
+	require.Nil(t, err)
+	require.Len(t, servers, 4)
+
+	assert.Equal(t, "http://localhost:5000", servers[0].url)
+	assert.Equal(t, "/ol/registry", servers[0].registry.String())
+	assert.Equal(t, "http://registry:8080/registry", servers[1].registry.String())
+	// servers with the same registry share it
+	assert.True(t, servers[1].registry == servers[2].registry)
+	assert.Nil(t, servers[3].registry)
+
+	config = viper.New()
+	config.Set("olservers", []string{"http://worker1:5000"})
+	servers, err = parseServers(config, "")
+	require.Nil(t, err)
+	assert.Equal(t, "http://worker1:5000", servers[0].url)
+
+	_, err = parseServers(readConfig(t, "olservers :\n  - url : 'http://w:5000'\n    registry :\n      type : 'ftp'\n"), "")
+	assert.NotNil(t, err)
+	_, err = parseServers(readConfig(t, "olservers :\n  - registry :\n      type : 'http'\n"), "")
+	assert.NotNil(t, err)
+}
+
+// A registry that accepts PUT and DELETE
+type testRegistry struct {
+	lock     sync.Mutex
+	packages map[string][]byte
+	puts     int
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	name := strings.TrimPrefix(req.URL.Path, "/registry/")
+	switch req.Method {
+	case http.MethodGet:
+		data, ok := r.packages[name]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(data)
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(req.Body)
+		r.packages[name] = data
+		r.puts++
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if _, ok := r.packages[name]; !ok {
+			http.NotFound(w, req)
+			return
+		}
+		delete(r.packages, name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestRemoteInstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-ol")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	reg := &testRegistry{packages: make(map[string][]byte)}
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	localRegistry := filepath.Join(dir, "worker2", "registry")
+	require.Nil(t, os.MkdirAll(localRegistry, 0755))
+
+	config := readConfig(t, `
+olservers :
+  - url : 'http://worker1:5000'
+    registry :
+      type : 'http'
+      url : '`+server.URL+`/registry'
+  - url : 'http://worker2:5000'
+    registry :
+      type : 'local'
+      dir : '`+localRegistry+`'
+`)
+	service, err := NewConfig(logrus.New(), config)
+	require.Nil(t, err)
+	defer service.Destroy()
+
+	rawDir := filepath.Join(dir, "functions", "echo")
+	require.Nil(t, os.MkdirAll(rawDir, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(rawDir, "f.py"), []byte("def f(event): pass\n"), 0644))
+
+	tarPath, err := service.Package(rawDir)
+	require.Nil(t, err)
+	require.Nil(t, service.Install(rawDir, nil, ""))
+
+	tarData, err := ioutil.ReadFile(tarPath)
+	require.Nil(t, err)
+	assert.Equal(t, tarData, reg.packages["echo.tar.gz"])
+	installed, err := ioutil.ReadFile(filepath.Join(localRegistry, "echo.tar.gz"))
+	require.Nil(t, err)
+	assert.Equal(t, tarData, installed)
+	// the package was renamed into place
+	entries, err := ioutil.ReadDir(localRegistry)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "echo.tar.gz", entries[0].Name())
+
+	// the http registry can't be listed, its package is only described
+	hash := sha256.Sum256(tarData)
+	list, err := service.List()
+	require.Nil(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "echo", list[0].Name)
+	assert.Equal(t, hex.EncodeToString(hash[:]), list[0].CodeHash)
+	assert.Equal(t, localRegistry, list[0].Config["registries"])
+	assert.False(t, list[0].InstallTime.IsZero())
+
+	info, err := service.Describe("echo")
+	require.Nil(t, err)
+	require.NotNil(t, info)
+	assert.Equal(t, hex.EncodeToString(hash[:]), info.CodeHash)
+	assert.Equal(t, server.URL+"/registry,"+localRegistry, info.Config["registries"])
+	assert.Equal(t, "", info.Config["hash-mismatch"])
+
+	// unchanged packages are not uploaded again
+	_, err = service.Package(rawDir)
+	require.Nil(t, err)
+	require.Nil(t, service.Install(rawDir, nil, ""))
+	assert.Equal(t, 1, reg.puts)
+
+	require.Nil(t, service.Remove("echo"))
+	assert.Empty(t, reg.packages)
+	_, err = os.Stat(filepath.Join(localRegistry, "echo.tar.gz"))
+	assert.True(t, os.IsNotExist(err))
+
+	// removing a missing package fails
+	assert.NotNil(t, service.Remove("echo"))
+	info, err = service.Describe("echo")
+	assert.Nil(t, err)
+	assert.Nil(t, info)
+}
+
+func TestInstallWithoutRegistry(t *testing.T) {
+	config := viper.New()
+	config.Set("olservers", []string{"http://worker1:5000"})
+	service, err := NewConfig(logrus.New(), config)
+	require.Nil(t, err)
+	defer service.Destroy()
+
+	err = service.Remove("echo")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "No registry configured")
+}
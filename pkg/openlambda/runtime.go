@@ -0,0 +1,231 @@
+package openlambda
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+const (
+	// OL calls the function f(event) in f.py
+	entryModule = "f"
+	// the function's own f.py when it is wrapped by a generated entry point
+	wrappedModule = "srk_f"
+	// environment of the function, loaded by the generated entry point
+	envFile = "srk_env.json"
+	// python packages installed by OL when the sandbox is created
+	requirementsFile = "requirements.txt"
+)
+
+// A runtime maps a function's conventions onto OL's
+type olRuntime struct {
+	// Handler "module.function" called with (event, context) as on AWS
+	// Lambda. If empty, the function provides OL's f(event) itself.
+	handler string
+	// Python packages to install in the sandbox
+	packages []string
+}
+
+func parseRuntimes(config *viper.Viper) (map[string]olRuntime, error) {
+	runtimes := make(map[string]olRuntime)
+	for name, rawRuntime := range config.GetStringMap("runtimes") {
+		runtimeCfg, err := cast.ToStringMapE(rawRuntime)
+		if err != nil {
+			return nil, errors.Errorf("Invalid configuration of runtime %s", name)
+		}
+		runtime := olRuntime{
+			handler:  cast.ToString(runtimeCfg["handler"]),
+			packages: cast.ToStringSlice(runtimeCfg["packages"]),
+		}
+		if runtime.handler != "" {
+			i := strings.LastIndex(runtime.handler, ".")
+			if i <= 0 || i == len(runtime.handler)-1 {
+				return nil, errors.Errorf("Handler of runtime %s must have the form 'module.function'", name)
+			}
+			if runtime.handler[:i] == entryModule {
+				return nil, errors.Errorf("Handler of runtime %s must not be in module '%s'", name, entryModule)
+			}
+		}
+		runtimes[name] = runtime
+	}
+	return runtimes, nil
+}
+
+// Build the package that is installed to the registries: the function's
+// package plus an entry point that sets the environment and calls the
+// runtime's handler. Returns the package of the function unchanged if there is
+// nothing to add. cleanup must be called once the package is installed.
+func (self *olConfig) buildInstallPackage(tarPath string, fName string, env map[string]string, runtimeName string) (string, func(), error) {
+	noCleanup := func() {}
+
+	if runtimeName == "" {
+		runtimeName = self.defaultRuntime
+	}
+	var runtime olRuntime
+	if runtimeName != "" {
+		var exists bool
+		if runtime, exists = self.runtimes[runtimeName]; !exists {
+			return "", noCleanup, errors.Errorf("Runtime '%s' does not exist in configuration", runtimeName)
+		}
+	}
+	if len(env) == 0 && runtime.handler == "" && len(runtime.packages) == 0 {
+		return tarPath, noCleanup, nil
+	}
+
+	tmpDir, err := ioutil.TempDir("", "srk-ol")
+	if err != nil {
+		return "", noCleanup, errors.Wrap(err, "Failed to create temporary directory")
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+
+	srcDir := filepath.Join(tmpDir, fName)
+	if _, err := srk.Untar(tarPath, srcDir); err != nil {
+		cleanup()
+		return "", noCleanup, errors.Wrap(err, "Failed to unpack function package")
+	}
+	if err := addRuntimeFiles(srcDir, fName, env, runtime); err != nil {
+		cleanup()
+		return "", noCleanup, err
+	}
+
+	installPath := filepath.Join(tmpDir, fName+".tar.gz")
+	if err := srk.TarDir(srcDir, srcDir, installPath); err != nil {
+		cleanup()
+		return "", noCleanup, errors.Wrap(err, "Failed to package function")
+	}
+	return installPath, cleanup, nil
+}
+
+// Add the generated entry point, environment and requirements to the
+// function in dir
+func addRuntimeFiles(dir string, fName string, env map[string]string, runtime olRuntime) error {
+	entryPath := filepath.Join(dir, entryModule+".py")
+
+	vars := entryVars{Function: fName}
+	if runtime.handler != "" {
+		i := strings.LastIndex(runtime.handler, ".")
+		vars.Module, vars.Handler = runtime.handler[:i], runtime.handler[i+1:]
+		vars.Context = true
+	} else {
+		// wrap the function's own entry point
+		if _, err := os.Stat(entryPath); err != nil {
+			return errors.Errorf("Function has no %s.py and no handler is configured", entryModule)
+		}
+		if err := os.Rename(entryPath, filepath.Join(dir, wrappedModule+".py")); err != nil {
+			return err
+		}
+		vars.Module, vars.Handler = wrappedModule, entryModule
+	}
+
+	if env == nil {
+		env = map[string]string{}
+	}
+	envData, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, envFile), envData, 0644); err != nil {
+		return errors.Wrap(err, "Failed to write function environment")
+	}
+
+	var entry bytes.Buffer
+	if err := entryTemplate.Execute(&entry, vars); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(entryPath, entry.Bytes(), 0644); err != nil {
+		return errors.Wrap(err, "Failed to write function entry point")
+	}
+
+	if len(runtime.packages) > 0 {
+		return addRequirements(filepath.Join(dir, requirementsFile), runtime.packages)
+	}
+	return nil
+}
+
+// Add packages to a requirements file, keeping the packages listed already
+func addRequirements(path string, packages []string) error {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	listed := make(map[string]bool)
+	var lines []string
+	for _, line := range strings.Split(string(existing), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			listed[line] = true
+			lines = append(lines, line)
+		}
+	}
+	added := append([]string{}, packages...)
+	sort.Strings(added)
+	for _, pkg := range added {
+		if !listed[pkg] {
+			lines = append(lines, pkg)
+		}
+	}
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+type entryVars struct {
+	Function string
+	Module   string
+	Handler  string
+	// call the handler with an AWS Lambda style context
+	Context bool
+}
+
+var entryTemplate = template.Must(template.New("entry").Funcs(template.FuncMap{
+	// JSON strings are valid python string literals
+	"py": func(s string) (string, error) {
+		quoted, err := json.Marshal(s)
+		return string(quoted), err
+	},
+}).Parse(`# Generated by SRK: OpenLambda entry point of function {{py .Function}}
+import importlib
+import json
+import os
+
+with open(os.path.join(os.path.dirname(os.path.abspath(__file__)), "` + envFile + `")) as _env:
+    os.environ.update(json.load(_env))
+
+_handler = getattr(importlib.import_module({{py .Module}}), {{py .Handler}})
+{{if .Context}}
+import uuid
+
+
+class _Context:
+    """The parts of the AWS Lambda context that make sense on OpenLambda"""
+
+    function_name = {{py .Function}}
+    function_version = "$LATEST"
+    memory_limit_in_mb = None
+    log_group_name = None
+    log_stream_name = None
+
+    def __init__(self):
+        self.aws_request_id = str(uuid.uuid4())
+
+    def get_remaining_time_in_millis(self):
+        # OpenLambda does not expose a deadline, report the AWS Lambda maximum
+        return 900000
+
+
+def f(event):
+    return _handler(event, _Context())
+{{else}}
+
+def f(event):
+    return _handler(event)
+{{end -}}
+`))
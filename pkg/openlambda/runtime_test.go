@@ -0,0 +1,113 @@
+package openlambda
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/serverlessresearch/srk/pkg/srk"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Build the install package of a function with the given files and unpack it
+func buildAndUnpack(t *testing.T, dir string, files map[string]string, env map[string]string, runtime string) string {
+	config := readConfig(t, `
+olservers : [ 'http://worker1:5000' ]
+runtimes :
+  aws-python :
+    handler : 'lambda_function.lambda_handler'
+    packages : [ 'requests' ]
+  native-requests :
+    packages : [ 'requests' ]
+`)
+	service, err := NewConfig(logrus.New(), config)
+	require.Nil(t, err)
+	defer service.Destroy()
+	ol := service.(*olConfig)
+
+	rawDir := filepath.Join(dir, "functions", "echo")
+	require.Nil(t, os.MkdirAll(rawDir, 0755))
+	for name, content := range files {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(rawDir, name), []byte(content), 0644))
+	}
+	tarPath, err := ol.Package(rawDir)
+	require.Nil(t, err)
+
+	installPath, cleanup, err := ol.buildInstallPackage(tarPath, "echo", env, runtime)
+	require.Nil(t, err)
+	defer cleanup()
+
+	unpacked := filepath.Join(dir, "unpacked")
+	_, err = srk.Untar(installPath, unpacked)
+	require.Nil(t, err)
+	return unpacked
+}
+
+// Call f(event) like OL does and return the printed result
+func runEntry(t *testing.T, dir string, event string) string {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 is not available")
+	}
+	cmd := exec.Command(python, "-c", "import json, f; print(json.dumps(f.f(json.loads('"+event+"'))))")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.Nil(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func TestHandlerRuntime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-ol")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	unpacked := buildAndUnpack(t, dir, map[string]string{
+		"lambda_function.py": "import os\ndef lambda_handler(event, context):\n    return [event['x'], os.environ['GREETING'], context.function_name]\n",
+		"requirements.txt":   "numpy\n",
+	}, map[string]string{"GREETING": "it's \"quoted\""}, "aws-python")
+
+	requirements, err := ioutil.ReadFile(filepath.Join(unpacked, requirementsFile))
+	require.Nil(t, err)
+	assert.Equal(t, "numpy\nrequests\n", string(requirements))
+
+	assert.Equal(t, `[1, "it's \"quoted\"", "echo"]`, runEntry(t, unpacked, `{"x": 1}`))
+}
+
+func TestNativeRuntime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-ol")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// the function's own f.py is wrapped
+	unpacked := buildAndUnpack(t, dir, map[string]string{
+		"f.py": "import os\ndef f(event):\n    return [event['x'], os.environ['GREETING']]\n",
+	}, map[string]string{"GREETING": "hello"}, "")
+
+	_, err = os.Stat(filepath.Join(unpacked, wrappedModule+".py"))
+	assert.Nil(t, err)
+	assert.Equal(t, `[1, "hello"]`, runEntry(t, unpacked, `{"x": 1}`))
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	service, err := NewConfig(logrus.New(), readConfig(t, "olservers : [ 'http://worker1:5000' ]\n"))
+	require.Nil(t, err)
+	defer service.Destroy()
+	ol := service.(*olConfig)
+
+	// nothing to add: the package is installed as it is
+	installPath, cleanup, err := ol.buildInstallPackage("/some/echo.tar.gz", "echo", map[string]string{}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "/some/echo.tar.gz", installPath)
+	cleanup()
+
+	_, _, err = ol.buildInstallPackage("/some/echo.tar.gz", "echo", nil, "missing")
+	assert.NotNil(t, err)
+
+	_, err = NewConfig(logrus.New(), readConfig(t, "olservers : [ 'http://w:5000' ]\nruntimes :\n  bad :\n    handler : 'nomodule'\n"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,172 @@
+package openlambda
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// Client-side statistics of a function
+type fnStats struct {
+	// Completed invocations, failed invocations and total invocation time
+	// (microseconds). Every attempt of a retried invocation is counted.
+	nInvoke int64
+	nError  int64
+	tInvoke int64
+	// Retried invocations
+	nRetry int64
+}
+
+// Client-side statistics of all functions
+type olStats struct {
+	mutex     sync.Mutex
+	functions map[string]*fnStats
+}
+
+// Record an invocation of fName that took t microseconds
+func (s *olStats) record(fName string, t int64, failed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f := s.function(fName)
+	f.nInvoke++
+	f.tInvoke += t
+	if failed {
+		f.nError++
+	}
+}
+
+// Record an invocation of fName that did not reach a server
+func (s *olStats) recordError(fName string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.function(fName).nError++
+}
+
+// Record a retry of a failed invocation of fName
+func (s *olStats) recordRetry(fName string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.function(fName).nRetry++
+}
+
+// Must be called with the mutex held
+func (s *olStats) function(fName string) *fnStats {
+	if s.functions == nil {
+		s.functions = make(map[string]*fnStats)
+	}
+	f, ok := s.functions[fName]
+	if !ok {
+		f = &fnStats{}
+		s.functions[fName] = f
+	}
+	return f
+}
+
+// Totals and per-function statistics, function names are added to the keys in
+// parentheses. Mean invocation times are only reported for functions that
+// were invoked.
+func (s *olStats) report() map[string]float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := make(map[string]float64)
+	var total fnStats
+	for fName, f := range s.functions {
+		addInvokeStats(stats, "("+fName+")", f)
+		total.nInvoke += f.nInvoke
+		total.nError += f.nError
+		total.tInvoke += f.tInvoke
+		total.nRetry += f.nRetry
+		stats["srkRetries("+fName+")"] = float64(f.nRetry)
+	}
+	addInvokeStats(stats, "", &total)
+	stats["srkRetries"] = float64(total.nRetry)
+	return stats
+}
+
+func (s *olStats) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.functions = nil
+}
+
+func addInvokeStats(stats map[string]float64, suffix string, f *fnStats) {
+	stats["srkInvocations"+suffix] = float64(f.nInvoke)
+	stats["srkErrors"+suffix] = float64(f.nError)
+	if f.nInvoke > 0 {
+		stats["srkInvoke"+suffix] = float64(f.tInvoke) / float64(f.nInvoke)
+	}
+}
+
+// Client-side statistics of each server, keys are namespaced by server URL
+func backendStats(backends []*backend) map[string]float64 {
+	stats := make(map[string]float64)
+	for _, b := range backends {
+		suffix := "[" + b.url + "]"
+		addInvokeStats(stats, suffix, &fnStats{
+			nInvoke: atomic.LoadInt64(&b.nInvoke),
+			nError:  atomic.LoadInt64(&b.nError),
+			tInvoke: atomic.LoadInt64(&b.tInvoke),
+		})
+		stats["srkOutstanding"+suffix] = float64(atomic.LoadInt64(&b.outstanding))
+		stats["srkHealthy"+suffix] = float64(atomic.LoadInt32(&b.healthy))
+	}
+	return stats
+}
+
+func resetBackendStats(backends []*backend) {
+	for _, b := range backends {
+		atomic.StoreInt64(&b.nInvoke, 0)
+		atomic.StoreInt64(&b.nError, 0)
+		atomic.StoreInt64(&b.tInvoke, 0)
+	}
+}
+
+// Send a request to the stats endpoint of an OL worker
+func postStats(url string, body string) ([]byte, error) {
+	olResp, err := http.Post(url+"/stats", "application/json", strings.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to POST stats request to ol worker")
+	}
+	defer olResp.Body.Close()
+
+	respBuf, err := ioutil.ReadAll(olResp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read stats response")
+	}
+	if olResp.StatusCode >= 300 {
+		return nil, errors.Errorf("ol worker returned %s: %s", olResp.Status, strings.TrimSpace(string(respBuf)))
+	}
+	return respBuf, nil
+}
+
+// Statistics of an OL worker, keys are namespaced by the worker's URL
+func (self *olConfig) serverStats(url string) (map[string]float64, error) {
+	respBuf, err := postStats(url, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded map[string]interface{}
+	if err = json.Unmarshal(respBuf, &decoded); err != nil {
+		return nil, errors.Wrap(err, "Failed to interpret OL statistics")
+	}
+
+	stats := make(map[string]float64)
+	for k, v := range decoded {
+		if floatv, ok := v.(float64); ok {
+			stats[k+"["+url+"]"] = floatv
+		} else {
+			self.log.Warnf("Ignoring non-numeric statistics result from openLambda %s: %v=%v", url, k, v)
+		}
+	}
+	return stats, nil
+}
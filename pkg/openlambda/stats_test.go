@@ -0,0 +1,122 @@
+package openlambda
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A fake OL worker that counts invocations and stats resets
+type fakeWorker struct {
+	*httptest.Server
+	nRun   int32
+	nReset int32
+}
+
+func newFakeWorker() *fakeWorker {
+	w := &fakeWorker{}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stats":
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) == "reset" {
+				atomic.AddInt32(&w.nReset, 1)
+			}
+			rw.Write([]byte(`{"run.cnt": 2, "run.ms-avg": 1.5, "version": "dev"}`))
+		default:
+			atomic.AddInt32(&w.nRun, 1)
+			rw.Write([]byte(`{}`))
+		}
+	}))
+	return w
+}
+
+func TestReportStats(t *testing.T) {
+	w1, w2 := newFakeWorker(), newFakeWorker()
+	defer w1.Close()
+	defer w2.Close()
+
+	service, err := NewConfig(logrus.New(), readConfig(t, `
+olservers : [ "`+w1.URL+`", "`+w2.URL+`" ]
+`))
+	require.Nil(t, err)
+	defer service.Destroy()
+
+	// no invocations: no NaN
+	stats, err := service.ReportStats()
+	require.Nil(t, err)
+	for k, v := range stats {
+		assert.False(t, math.IsNaN(v), k)
+	}
+	assert.Equal(t, 0.0, stats["srkInvocations"])
+	assert.NotContains(t, stats, "srkInvoke")
+
+	for i := 0; i < 3; i++ {
+		_, err = service.Invoke("echo", "{}")
+		require.Nil(t, err)
+	}
+	_, err = service.Invoke("sleep", "{}")
+	require.Nil(t, err)
+
+	stats, err = service.ReportStats()
+	require.Nil(t, err)
+
+	// server statistics of all servers
+	for _, url := range []string{w1.URL, w2.URL} {
+		assert.Equal(t, 2.0, stats["run.cnt["+url+"]"])
+		assert.Equal(t, 1.5, stats["run.ms-avg["+url+"]"])
+		assert.Equal(t, 2.0, stats["srkInvocations["+url+"]"])
+	}
+	assert.NotContains(t, stats, "run.cnt")
+	assert.NotContains(t, stats, "version["+w1.URL+"]")
+
+	// client statistics per function
+	assert.Equal(t, 4.0, stats["srkInvocations"])
+	assert.Equal(t, 3.0, stats["srkInvocations(echo)"])
+	assert.Equal(t, 1.0, stats["srkInvocations(sleep)"])
+	assert.Equal(t, 0.0, stats["srkErrors(echo)"])
+	assert.Contains(t, stats, "srkInvoke(echo)")
+	assert.Contains(t, stats, "srkInvoke(sleep)")
+	assert.Contains(t, stats, "srkInvoke")
+
+	require.Nil(t, service.ResetStats())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&w1.nReset))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&w2.nReset))
+
+	stats, err = service.ReportStats()
+	require.Nil(t, err)
+	assert.Equal(t, 0.0, stats["srkInvocations"])
+	assert.NotContains(t, stats, "srkInvocations(echo)")
+	assert.Equal(t, 0.0, stats["srkInvocations["+w1.URL+"]"])
+}
+
+func TestReportStatsServerDown(t *testing.T) {
+	w1, w2 := newFakeWorker(), newFakeWorker()
+	defer w1.Close()
+
+	service, err := NewConfig(logrus.New(), readConfig(t, `
+olservers : [ "`+w1.URL+`", "`+w2.URL+`" ]
+`))
+	require.Nil(t, err)
+	defer service.Destroy()
+
+	// the statistics of the remaining server are reported
+	w2.Close()
+	stats, err := service.ReportStats()
+	require.Nil(t, err)
+	assert.Contains(t, stats, "run.cnt["+w1.URL+"]")
+	assert.NotContains(t, stats, "run.cnt["+w2.URL+"]")
+	assert.Nil(t, service.ResetStats())
+
+	w1.Close()
+	_, err = service.ReportStats()
+	assert.NotNil(t, err)
+	assert.NotNil(t, service.ResetStats())
+}
@@ -0,0 +1,65 @@
+package shell
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// A Remote for the local host. This lets code that manages a (possibly)
+// remote host treat both cases the same way.
+type Local struct {
+	Runner Runner
+}
+
+func (l *Local) Run(ctx context.Context, args ...string) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("no command given")
+	}
+	return l.Runner.Output(ctx, args[0], args[1:]...)
+}
+
+func (l *Local) Upload(ctx context.Context, src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		if err := os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+			return err
+		}
+		_, err := l.Runner.Output(ctx, "cp", "-a", src, dst)
+		return err
+	}
+
+	if err := os.MkdirAll(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	// "src/." copies the contents of src, including hidden files
+	_, err = l.Runner.Output(ctx, "cp", "-a", filepath.Clean(src)+string(filepath.Separator)+".", dst)
+	return err
+}
+
+func (l *Local) WriteFile(ctx context.Context, dst string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(dst, data, perm); err != nil {
+		return err
+	}
+	return os.Chmod(dst, perm)
+}
+
+func (l *Local) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+func (l *Local) Close() error {
+	return nil
+}
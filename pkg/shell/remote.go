@@ -0,0 +1,405 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const defaultConnectTimeout = 30 * time.Second
+
+// A Remote runs commands and transfers files on another host.
+type Remote interface {
+	// Run a command on the remote host. args is an argument vector, each
+	// argument is quoted for the remote shell. Returns the standard output of
+	// the command. A non-zero exit status is reported as an error that
+	// includes the standard error output.
+	Run(ctx context.Context, args ...string) (string, error)
+
+	// Copy the local file or directory src to dst on the remote host.
+	// Directories are copied recursively and merged with an existing dst.
+	// Missing parent directories of dst are created.
+	Upload(ctx context.Context, src, dst string) error
+
+	// Create or replace the remote file dst with data. Missing parent
+	// directories are created.
+	WriteFile(ctx context.Context, dst string, data []byte, perm os.FileMode) error
+
+	// Open a connection from the remote host to address (e.g. network "unix"
+	// for a socket on the remote host)
+	Dial(ctx context.Context, network, address string) (net.Conn, error)
+
+	// Release any connections held by the remote
+	Close() error
+}
+
+// Configuration of an SSH remote
+type SSHConfig struct {
+	// Hostname or IP of the remote host, optionally with a port (defaults to 22)
+	Host string
+	User string
+	// Private key file used for authentication
+	KeyFile string
+	// known_hosts file used to verify the remote host key (defaults to
+	// ~/.ssh/known_hosts)
+	KnownHostsFile string
+	// Skip host key verification. Only use this for throwaway hosts.
+	InsecureIgnoreHostKey bool
+	// Timeout for establishing the connection (defaults to 30s)
+	ConnectTimeout time.Duration
+}
+
+// A Remote that uses a native SSH connection. The connection is established
+// on first use and reused for all subsequent commands and transfers.
+type SSHRemote struct {
+	addr   string
+	config *ssh.ClientConfig
+
+	m      sync.Mutex
+	client *ssh.Client
+	sftp   *sftp.Client
+}
+
+func NewSSHRemote(cfg SSHConfig) (*SSHRemote, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("ssh host is required")
+	}
+
+	keyFile, err := homedir.Expand(cfg.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid ssh key path")
+	}
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read ssh key")
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse ssh key %s", keyFile)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if cfg.InsecureIgnoreHostKey {
+		log.Warnf("host key verification for %s is disabled", cfg.Host)
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		knownHostsFile := cfg.KnownHostsFile
+		if knownHostsFile == "" {
+			knownHostsFile = "~/.ssh/known_hosts"
+		}
+		if knownHostsFile, err = homedir.Expand(knownHostsFile); err != nil {
+			return nil, errors.Wrap(err, "invalid known_hosts path")
+		}
+		if hostKeyCallback, err = knownhosts.New(knownHostsFile); err != nil {
+			return nil, errors.Wrap(err, "failed to load known hosts")
+		}
+	}
+
+	timeout := cfg.ConnectTimeout
+	if timeout == 0 {
+		timeout = defaultConnectTimeout
+	}
+
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	return &SSHRemote{
+		addr: addr,
+		config: &ssh.ClientConfig{
+			User:            cfg.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         timeout,
+		},
+	}, nil
+}
+
+// Returns the current connection, establishing a new one if needed
+func (r *SSHRemote) connect(ctx context.Context) (*ssh.Client, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.client != nil {
+		return r.client, nil
+	}
+
+	dialer := net.Dialer{Timeout: r.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", r.addr)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, r.addr, r.config)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "ssh handshake with %s failed", r.addr)
+	}
+	conn.SetDeadline(time.Time{})
+
+	r.client = ssh.NewClient(c, chans, reqs)
+	return r.client, nil
+}
+
+// Drop client if it is still the cached connection so that the next
+// operation reconnects
+func (r *SSHRemote) reset(client *ssh.Client) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.client != client {
+		return
+	}
+	if r.sftp != nil {
+		r.sftp.Close()
+		r.sftp = nil
+	}
+	r.client.Close()
+	r.client = nil
+}
+
+// Open a new session, reconnecting once if the cached connection is dead
+func (r *SSHRemote) session(ctx context.Context) (*ssh.Session, error) {
+	for attempt := 0; ; attempt++ {
+		client, err := r.connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		session, err := client.NewSession()
+		if err == nil {
+			return session, nil
+		}
+		r.reset(client)
+		if attempt > 0 {
+			return nil, errors.Wrap(err, "failed to open ssh session")
+		}
+	}
+}
+
+func (r *SSHRemote) sftpClient(ctx context.Context) (*sftp.Client, error) {
+	client, err := r.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.sftp == nil {
+		if r.sftp, err = sftp.NewClient(client); err != nil {
+			return nil, errors.Wrap(err, "failed to start sftp session")
+		}
+	}
+	return r.sftp, nil
+}
+
+func (r *SSHRemote) Run(ctx context.Context, args ...string) (string, error) {
+	cmd := QuoteArgs(args)
+	log.Debugf("ssh %s %s", r.addr, cmd)
+
+	session, err := r.session(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(cmd)
+	}()
+
+	select {
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		return "", errors.Wrapf(ctx.Err(), "remote command '%s' did not finish", cmd)
+	case err = <-done:
+	}
+
+	if err != nil {
+		if exitErr, ok := err.(*ssh.ExitError); ok {
+			return stdout.String(), fmt.Errorf("remote command '%s' exited with status %d: %s",
+				cmd, exitErr.ExitStatus(), strings.TrimSpace(stderr.String()))
+		}
+		return stdout.String(), errors.Wrapf(err, "remote command '%s' failed", cmd)
+	}
+	return stdout.String(), nil
+}
+
+// Run fn with the sftp client, aborting the sftp session if ctx expires
+func (r *SSHRemote) withSftp(ctx context.Context, fn func(*sftp.Client) error) error {
+	client, err := r.sftpClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(client)
+	}()
+
+	select {
+	case <-ctx.Done():
+		r.m.Lock()
+		if r.sftp == client {
+			r.sftp = nil
+		}
+		r.m.Unlock()
+		client.Close()
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+func (r *SSHRemote) Upload(ctx context.Context, src, dst string) error {
+	log.Debugf("upload %s to %s:%s", src, r.addr, dst)
+
+	return r.withSftp(ctx, func(client *sftp.Client) error {
+		return filepath.Walk(src, func(localPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			rel, err := filepath.Rel(src, localPath)
+			if err != nil {
+				return err
+			}
+			remotePath := path.Join(dst, filepath.ToSlash(rel))
+
+			switch {
+			case info.IsDir():
+				if err := client.MkdirAll(remotePath); err != nil {
+					return errors.Wrapf(err, "failed to create remote directory %s", remotePath)
+				}
+				return client.Chmod(remotePath, info.Mode().Perm())
+			case info.Mode().IsRegular():
+				f, err := os.Open(localPath)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				return writeRemote(client, remotePath, f, info.Mode().Perm())
+			default:
+				log.Warnf("skipping upload of non-regular file %s", localPath)
+				return nil
+			}
+		})
+	})
+}
+
+func (r *SSHRemote) WriteFile(ctx context.Context, dst string, data []byte, perm os.FileMode) error {
+	return r.withSftp(ctx, func(client *sftp.Client) error {
+		return writeRemote(client, dst, bytes.NewReader(data), perm)
+	})
+}
+
+// Write src to the remote file dst. The data goes to a temporary file next to
+// dst that replaces dst once it is complete, so an interrupted transfer never
+// leaves a truncated dst behind.
+func writeRemote(client *sftp.Client, dst string, src io.Reader, perm os.FileMode) error {
+	if err := client.MkdirAll(path.Dir(dst)); err != nil {
+		return errors.Wrapf(err, "failed to create remote directory %s", path.Dir(dst))
+	}
+
+	tmp := path.Join(path.Dir(dst), fmt.Sprintf(".%s.%d.tmp", path.Base(dst), time.Now().UnixNano()))
+	f, err := client.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create remote file %s", tmp)
+	}
+	_, err = io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = client.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = client.PosixRename(tmp, dst)
+	}
+	if err != nil {
+		client.Remove(tmp)
+		return errors.Wrapf(err, "failed to write remote file %s", dst)
+	}
+	return nil
+}
+
+func (r *SSHRemote) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	client, err := r.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial(network, address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s via %s", address, r.addr)
+	}
+	return conn, nil
+}
+
+func (r *SSHRemote) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.sftp != nil {
+		r.sftp.Close()
+		r.sftp = nil
+	}
+	if r.client != nil {
+		err := r.client.Close()
+		r.client = nil
+		return err
+	}
+	return nil
+}
+
+// Quote s for use as a single word in a POSIX shell command line
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("@%_-+=:,./", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Quote each argument and join them into a single shell command line
+func QuoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,274 @@
+package shell_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/serverlessresearch/srk/pkg/shell"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// An in-process SSH server that runs exec requests with the local shell and
+// serves the sftp subsystem from the local filesystem.
+type testSSHServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+	// Number of accepted connections
+	conns int32
+}
+
+func newTestSSHServer(t *testing.T, clientKey ssh.PublicKey) *testSSHServer {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	require.Nil(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	srv := &testSSHServer{listener: listener, hostKey: hostKey}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&srv.conns, 1)
+			go srv.serve(conn, config)
+		}
+	}()
+	return srv
+}
+
+func (srv *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		channel, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go srv.handleSession(channel, requests)
+	}
+}
+
+func (srv *testSSHServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			command := string(req.Payload[4:])
+			req.Reply(true, nil)
+
+			cmd := exec.Command("/bin/sh", "-c", command)
+			cmd.Stdout = channel
+			cmd.Stderr = channel.Stderr()
+			status := uint32(0)
+			if err := cmd.Run(); err != nil {
+				status = 1
+				if exitErr, ok := err.(*exec.ExitError); ok {
+					if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Exited() {
+						status = uint32(ws.ExitStatus())
+					}
+				}
+			}
+			payload := make([]byte, 4)
+			binary.BigEndian.PutUint32(payload, status)
+			channel.SendRequest("exit-status", false, payload)
+			return
+		case "subsystem":
+			if string(req.Payload[4:]) != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			server.Serve()
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// Creates a client key, a server, and a matching known_hosts file. Returns the
+// configuration for connecting to the server.
+func setupRemote(t *testing.T, dir string) (*testSSHServer, shell.SSHConfig) {
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	sshPub, err := ssh.NewPublicKey(clientPub)
+	require.Nil(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(clientPriv)
+	require.Nil(t, err)
+	keyFile := filepath.Join(dir, "id_test")
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	srv := newTestSSHServer(t, sshPub)
+
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{srv.listener.Addr().String()}, srv.hostKey.PublicKey())
+	require.Nil(t, ioutil.WriteFile(knownHostsFile, []byte(line+"\n"), 0600))
+
+	return srv, shell.SSHConfig{
+		Host:           srv.listener.Addr().String(),
+		User:           "tester",
+		KeyFile:        keyFile,
+		KnownHostsFile: knownHostsFile,
+		ConnectTimeout: 5 * time.Second,
+	}
+}
+
+func TestSSHRemote(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-ssh")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	srv, cfg := setupRemote(t, dir)
+	defer srv.listener.Close()
+
+	remote, err := shell.NewSSHRemote(cfg)
+	require.Nil(t, err)
+	defer remote.Close()
+
+	ctx := context.Background()
+
+	// Arguments containing quotes and spaces must arrive unchanged
+	out, err := remote.Run(ctx, "printf", "%s|%s", "it's", "a b")
+	assert.Nil(t, err)
+	assert.Equal(t, "it's|a b", out)
+
+	_, err = remote.Run(ctx, "/bin/sh", "-c", "echo oops >&2; exit 3")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "status 3")
+	assert.Contains(t, err.Error(), "oops")
+
+	// Upload a directory tree
+	src := filepath.Join(dir, "src")
+	require.Nil(t, os.MkdirAll(filepath.Join(src, "sub"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0755))
+	dst := filepath.Join(dir, "dst with space")
+	assert.Nil(t, remote.Upload(ctx, src, dst))
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "sub", "b.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "b", string(data))
+	info, err := os.Stat(filepath.Join(dst, "sub", "b.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// Missing parent directories are created like on the local host
+	single := filepath.Join(dir, "new", "dir", "a.txt")
+	assert.Nil(t, remote.Upload(ctx, filepath.Join(src, "a.txt"), single))
+	data, err = ioutil.ReadFile(single)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", string(data))
+
+	envFile := filepath.Join(dir, "functions", "env")
+	assert.Nil(t, remote.WriteFile(ctx, envFile, []byte("KEY='quoted value'\n"), 0644))
+	assert.Nil(t, remote.WriteFile(ctx, envFile, []byte("KEY='quoted value'\n"), 0644))
+	data, err = ioutil.ReadFile(envFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "KEY='quoted value'\n", string(data))
+
+	// Files are written to a temporary name and renamed into place
+	for _, d := range []string{filepath.Dir(single), filepath.Dir(envFile), filepath.Join(dst, "sub")} {
+		entries, err := ioutil.ReadDir(d)
+		assert.Nil(t, err)
+		for _, entry := range entries {
+			assert.False(t, strings.HasSuffix(entry.Name(), ".tmp"), entry.Name())
+		}
+	}
+
+	// All operations share a single connection
+	assert.Equal(t, int32(1), atomic.LoadInt32(&srv.conns))
+
+	// Commands are cancelled when the context expires
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = remote.Run(timeoutCtx, "sleep", "5")
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second)
+}
+
+func TestSSHRemoteHostKeyMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-ssh")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	srv, cfg := setupRemote(t, dir)
+	defer srv.listener.Close()
+
+	// Replace the known host key with an unrelated one
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	otherKey, err := ssh.NewSignerFromKey(otherPriv)
+	require.Nil(t, err)
+	line := knownhosts.Line([]string{cfg.Host}, otherKey.PublicKey())
+	require.Nil(t, ioutil.WriteFile(cfg.KnownHostsFile, []byte(line+"\n"), 0600))
+
+	remote, err := shell.NewSSHRemote(cfg)
+	require.Nil(t, err)
+	defer remote.Close()
+
+	_, err = remote.Run(context.Background(), "true")
+	assert.NotNil(t, err)
+
+	cfg.InsecureIgnoreHostKey = true
+	insecure, err := shell.NewSSHRemote(cfg)
+	require.Nil(t, err)
+	defer insecure.Close()
+
+	_, err = insecure.Run(context.Background(), "true")
+	assert.Nil(t, err)
+}
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, "''", shell.Quote(""))
+	assert.Equal(t, "/tmp/file.txt", shell.Quote("/tmp/file.txt"))
+	assert.Equal(t, `'it'\''s'`, shell.Quote("it's"))
+	assert.Equal(t, `'a b' '$HOME'`, shell.QuoteArgs([]string{"a b", "$HOME"}))
+}
@@ -1,62 +1,168 @@
+// Package shell runs commands on the local host or on remote hosts.
+// Commands are always given as argument vectors; nothing is interpreted by a
+// shell unless a shell is run explicitly (see Sh).
 package shell
 
 import (
-	"errors"
-	"io/ioutil"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"os/exec"
+	"strings"
+	"sync"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-const (
-	Shell = "/bin/bash"
-	Exec  = "-c"
-)
-
-func Run(exe string, args ...string) ([]byte, []byte, error) {
+const Shell = "/bin/sh"
 
-	log.Debugf("exec %s %v", exe, args)
+// Result of a command that ran to completion
+type Result struct {
+	ExitCode int
+	Stdout   []byte
+	Stderr   []byte
+}
 
-	cmd := exec.Command(exe, args...)
+// Returned when a command exits with a non-zero status
+type ExitError struct {
+	Cmd    string
+	Result *Result
+}
 
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, nil, err
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("command '%s' exited with status %d", e.Cmd, e.Result.ExitCode)
+	if stderr := strings.TrimSpace(string(e.Result.Stderr)); stderr != "" {
+		msg += ": " + stderr
 	}
+	return msg
+}
 
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, nil, err
-	}
+// A Runner runs local commands. The zero value is ready to use.
+type Runner struct {
+	// Working directory of the commands (defaults to the current directory)
+	Dir string
+	// Environment of the commands in "key=value" form (defaults to the
+	// environment of this process)
+	Env []string
+	// Optional standard input of the commands
+	Stdin io.Reader
+	// Output lines are logged at debug level as they are produced (defaults
+	// to the standard logrus logger)
+	Logger log.FieldLogger
+}
 
-	if err := cmd.Start(); err != nil {
-		return nil, nil, err
+// Run a command until it exits or ctx is done. stdout and stderr are read
+// concurrently (so a chatty process can't block on a full pipe) and streamed
+// to the logger line by line.
+//
+// The result is returned whenever the command ran to completion. A non-zero
+// exit status is reported as an *ExitError. If ctx is done first the process
+// is killed and ctx.Err() is returned (wrapped).
+func (r *Runner) Run(ctx context.Context, name string, args ...string) (*Result, error) {
+	logger := r.Logger
+	if logger == nil {
+		logger = log.StandardLogger()
+	}
+	cmdLine := QuoteArgs(append([]string{name}, args...))
+	logger.Debugf("exec %s", cmdLine)
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = r.Dir
+	cmd.Env = r.Env
+	cmd.Stdin = r.Stdin
+
+	var stdout, stderr bytes.Buffer
+	stdoutLog := &lineLogger{log: logger.WithField("stream", "stdout")}
+	stderrLog := &lineLogger{log: logger.WithField("stream", "stderr")}
+	cmd.Stdout = io.MultiWriter(&stdout, stdoutLog)
+	cmd.Stderr = io.MultiWriter(&stderr, stderrLog)
+
+	err := cmd.Run()
+	stdoutLog.flush()
+	stderrLog.flush()
+
+	if ctx.Err() != nil {
+		return nil, errors.Wrapf(ctx.Err(), "command '%s' did not finish", cmdLine)
 	}
-	defer cmd.Wait()
 
-	stdout, err := ioutil.ReadAll(stdoutPipe)
+	res := &Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
 	if err != nil {
-		return nil, nil, err
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, errors.Wrapf(err, "failed to run '%s'", cmdLine)
+		}
+		res.ExitCode = exitErr.ExitCode()
+		return res, &ExitError{Cmd: cmdLine, Result: res}
 	}
+	return res, nil
+}
 
-	stderr, err := ioutil.ReadAll(stderrPipe)
+// Run a command and return its standard output. Output on stderr is not
+// considered an error, only a non-zero exit status is.
+func (r *Runner) Output(ctx context.Context, name string, args ...string) (string, error) {
+	res, err := r.Run(ctx, name, args...)
 	if err != nil {
-		return nil, nil, err
+		return "", err
 	}
+	return string(res.Stdout), nil
+}
 
-	return stdout, stderr, err
+var defaultRunner Runner
+
+// Run a command with the default Runner
+func Run(ctx context.Context, name string, args ...string) (*Result, error) {
+	return defaultRunner.Run(ctx, name, args...)
 }
 
-func RunSimple(exe string, args ...string) (string, error) {
+// Run a command with the default Runner and return its standard output
+func Output(ctx context.Context, name string, args ...string) (string, error) {
+	return defaultRunner.Output(ctx, name, args...)
+}
 
-	stdout, stderr, err := Run(exe, args...)
-	if err != nil {
-		return "", err
-	}
+// Run script with the system shell. Additional args are available to the
+// script as $1, $2, ... which avoids having to quote them into the script.
+func Sh(ctx context.Context, script string, args ...string) (string, error) {
+	return Output(ctx, Shell, append([]string{"-c", script, "sh"}, args...)...)
+}
 
-	if len(stderr) > 0 {
-		return "", errors.New(string(stderr))
+// Copy src to dst (like 'cp -a')
+func Cp(ctx context.Context, src, dst string) error {
+	_, err := Output(ctx, "cp", "-a", src, dst)
+	return err
+}
+
+// Writes each complete line to a logger
+type lineLogger struct {
+	log  log.FieldLogger
+	m    sync.Mutex
+	part []byte
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.part = append(l.part, p...)
+	for {
+		i := bytes.IndexByte(l.part, '\n')
+		if i < 0 {
+			break
+		}
+		l.log.Debug(string(l.part[:i]))
+		l.part = l.part[i+1:]
 	}
+	return len(p), nil
+}
+
+// Log any trailing partial line
+func (l *lineLogger) flush() {
+	l.m.Lock()
+	defer l.m.Unlock()
 
-	return string(stdout), nil
+	if len(l.part) > 0 {
+		l.log.Debug(string(l.part))
+		l.part = nil
+	}
 }
@@ -1,20 +1,122 @@
 package shell_test
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/serverlessresearch/srk/pkg/shell"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRun(t *testing.T) {
 
 	message := "hello, world"
 
-	stdout, stderr, err := shell.Run(shell.Shell, shell.Exec, "/bin/echo -n "+message+" | tee /dev/stderr")
+	res, err := shell.Run(context.Background(), shell.Shell, "-c", "/bin/echo -n "+message+" | tee /dev/stderr")
 	assert.Nil(t, err)
 
-	assert.Equal(t, message, string(stdout))
-	assert.Equal(t, message, string(stderr))
+	assert.Equal(t, 0, res.ExitCode)
+	assert.Equal(t, message, string(res.Stdout))
+	assert.Equal(t, message, string(res.Stderr))
+}
+
+func TestRunExitStatus(t *testing.T) {
+
+	res, err := shell.Run(context.Background(), shell.Shell, "-c", "echo out; echo err >&2; exit 3")
+	assert.NotNil(t, err)
+	exitErr, ok := err.(*shell.ExitError)
+	require.True(t, ok)
+	assert.Equal(t, res, exitErr.Result)
+	assert.Equal(t, 3, res.ExitCode)
+	assert.Equal(t, "out\n", string(res.Stdout))
+	assert.Contains(t, err.Error(), "err")
+
+	// output on stderr alone is not a failure
+	out, err := shell.Output(context.Background(), shell.Shell, "-c", "echo out; echo warning >&2")
+	assert.Nil(t, err)
+	assert.Equal(t, "out\n", out)
+}
+
+func TestRunLargeStderr(t *testing.T) {
+
+	// writes more than a pipe buffer to stderr before writing to stdout
+	script := "head -c 1000000 /dev/zero | tr '\\0' x >&2; echo done"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := shell.Run(ctx, shell.Shell, "-c", script)
+	require.Nil(t, err)
+	assert.Equal(t, "done\n", string(res.Stdout))
+	assert.Len(t, res.Stderr, 1000000)
+}
+
+func TestRunContext(t *testing.T) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := shell.Run(ctx, "sleep", "5")
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second)
+}
+
+func TestRunnerStreamsOutput(t *testing.T) {
+
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	runner := shell.Runner{Logger: logger}
+
+	_, err := runner.Run(context.Background(), "printf", "one\ntwo\npartial")
+	assert.Nil(t, err)
+
+	var lines []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["stream"] == "stdout" {
+			lines = append(lines, entry.Message)
+		}
+	}
+	assert.Equal(t, []string{"one", "two", "partial"}, lines)
+}
+
+func TestSh(t *testing.T) {
+
+	out, err := shell.Sh(context.Background(), `printf %s "$1"`, "it's $HOME")
+	assert.Nil(t, err)
+	assert.Equal(t, "it's $HOME", out)
+}
+
+func TestLocal(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "srk-local")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	require.Nil(t, os.MkdirAll(filepath.Join(src, "sub"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, ".hidden"), []byte("h"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0644))
+
+	local := &shell.Local{}
+	ctx := context.Background()
+	dst := filepath.Join(dir, "dst")
+	assert.Nil(t, local.Upload(ctx, src, dst))
+
+	out, err := local.Run(ctx, "cat", filepath.Join(dst, ".hidden"), filepath.Join(dst, "sub", "b.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hb", out)
+
+	assert.Nil(t, local.WriteFile(ctx, filepath.Join(dst, "new", "env"), []byte("A=1\n"), 0600))
+	out, err = local.Run(ctx, "cat", filepath.Join(dst, "new", "env"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(out, "A=1"))
 }
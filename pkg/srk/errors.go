@@ -0,0 +1,124 @@
+package srk
+
+// Classes of invocation errors returned by all function services
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The class of an invocation error
+type ErrorKind int
+
+const (
+	// Not classified (e.g. an invalid configuration)
+	ErrUnknown ErrorKind = iota
+	// The request didn't reach the service or the response was lost, or the
+	// service failed (e.g. HTTP 502)
+	ErrTransport
+	// The service rejected the request because of too many requests
+	ErrThrottled
+	// The function was invoked and raised an error
+	ErrFunction
+	// The request or the function timed out
+	ErrTimeout
+	// The function (or the version or alias) doesn't exist
+	ErrNotFound
+)
+
+// Every class, e.g. to report statistics per class
+var ErrorKinds = []ErrorKind{ErrTransport, ErrThrottled, ErrFunction, ErrTimeout, ErrNotFound}
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrTransport:
+		return "transport"
+	case ErrThrottled:
+		return "throttled"
+	case ErrFunction:
+		return "function"
+	case ErrTimeout:
+		return "timeout"
+	case ErrNotFound:
+		return "notFound"
+	}
+	return "unknown"
+}
+
+// An error of an invocation. Function services return invocation errors as
+// *InvokeError (possibly wrapped with errors.Wrap), use KindOf() to get the
+// class of an error.
+type InvokeError struct {
+	Kind ErrorKind
+	// The function that was invoked
+	FName string
+	// The underlying error, e.g. of the HTTP client or the error message of
+	// the function
+	Err error
+}
+
+func NewInvokeError(kind ErrorKind, fName string, err error) *InvokeError {
+	return &InvokeError{Kind: kind, FName: fName, Err: err}
+}
+
+func (self *InvokeError) Error() string {
+	return "invocation of " + self.FName + " failed (" + self.Kind.String() + "): " + self.Err.Error()
+}
+
+func (self *InvokeError) Cause() error {
+	return self.Err
+}
+
+func (self *InvokeError) Unwrap() error {
+	return self.Err
+}
+
+// The class of an error returned by a function service, ErrUnknown if it
+// isn't an *InvokeError (or wraps one)
+func KindOf(err error) ErrorKind {
+	for err != nil {
+		if e, ok := err.(*InvokeError); ok {
+			return e.Kind
+		}
+		err = unwrapError(err)
+	}
+	return ErrUnknown
+}
+
+// Classify the error of an HTTP invocation request: timeouts, unexpected
+// statuses (*HttpStatusError: 404 is not found, 429 is throttled) and
+// transport failures
+func HttpInvokeError(fName string, err error) *InvokeError {
+	if e, ok := err.(*InvokeError); ok {
+		return e
+	}
+	if e, ok := err.(*HttpStatusError); ok {
+		switch e.Code {
+		case http.StatusNotFound:
+			return NewInvokeError(ErrNotFound, fName, err)
+		case http.StatusTooManyRequests:
+			return NewInvokeError(ErrThrottled, fName, err)
+		}
+		return NewInvokeError(ErrTransport, fName, err)
+	}
+	for cause := err; cause != nil; cause = unwrapError(cause) {
+		if e, ok := cause.(net.Error); ok && e.Timeout() {
+			return NewInvokeError(ErrTimeout, fName, err)
+		}
+	}
+	return NewInvokeError(ErrTransport, fName, err)
+}
+
+// Classify an error raised by a function. AWS Lambda (and emulators like
+// lambci) report functions that exceeded their timeout as function errors
+// with a "Task timed out" message.
+func FunctionInvokeError(fName string, body []byte) *InvokeError {
+	msg := strings.TrimSpace(string(body))
+	if strings.Contains(msg, "Task timed out") {
+		return NewInvokeError(ErrTimeout, fName, errors.New(msg))
+	}
+	return NewInvokeError(ErrFunction, fName, errors.New(msg))
+}
@@ -0,0 +1,71 @@
+package srk
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestKindOf(t *testing.T) {
+	err := NewInvokeError(ErrThrottled, "echo", errors.New("slow down"))
+	assert.Equal(t, ErrThrottled, KindOf(err))
+	assert.Equal(t, ErrThrottled, KindOf(errors.Wrap(err, "benchmark failed")))
+	assert.Equal(t, ErrUnknown, KindOf(errors.New("invalid configuration")))
+	assert.Equal(t, ErrUnknown, KindOf(nil))
+	assert.Equal(t, "invocation of echo failed (throttled): slow down", err.Error())
+}
+
+func TestHttpInvokeError(t *testing.T) {
+	reset := &url.Error{Op: "Post", URL: "http://localhost", Err: syscall.ECONNRESET}
+	timeout := &url.Error{Op: "Post", URL: "http://localhost", Err: &net.OpError{Op: "read", Err: timeoutError{}}}
+
+	for err, kind := range map[error]ErrorKind{
+		reset:                                  ErrTransport,
+		timeout:                                ErrTimeout,
+		errors.Wrap(timeout, "Failed to POST"): ErrTimeout,
+		&HttpStatusError{Code: http.StatusNotFound}:        ErrNotFound,
+		&HttpStatusError{Code: http.StatusTooManyRequests}: ErrThrottled,
+		&HttpStatusError{Code: http.StatusBadGateway}:      ErrTransport,
+	} {
+		invokeErr := HttpInvokeError("echo", err)
+		assert.Equal(t, kind, invokeErr.Kind, "%v", err)
+		assert.Equal(t, err, invokeErr.Err)
+	}
+
+	// already classified
+	err := NewInvokeError(ErrFunction, "echo", errors.New("failed"))
+	assert.Equal(t, err, HttpInvokeError("echo", err))
+}
+
+func TestFunctionInvokeError(t *testing.T) {
+	err := FunctionInvokeError("echo", []byte(`{"errorMessage": "division by zero"}`))
+	assert.Equal(t, ErrFunction, err.Kind)
+	assert.Contains(t, err.Error(), "division by zero")
+
+	err = FunctionInvokeError("echo", []byte(`{"errorMessage": "2020-04-01T12:00:00.000Z Task timed out after 3.00 seconds"}`))
+	assert.Equal(t, ErrTimeout, err.Kind)
+}
+
+func TestRetryInvokeErrors(t *testing.T) {
+	reset := &url.Error{Op: "Post", URL: "http://localhost", Err: syscall.ECONNRESET}
+
+	assert.True(t, IsRetryable(NewInvokeError(ErrThrottled, "echo", errors.New("slow down"))))
+	assert.True(t, IsRetryable(NewInvokeError(ErrTransport, "echo", reset)))
+	assert.True(t, IsRetryable(HttpInvokeError("echo", &HttpStatusError{Code: http.StatusServiceUnavailable})))
+	assert.False(t, IsRetryable(NewInvokeError(ErrTransport, "echo", errors.New("No healthy server"))))
+	// even if the cause looks retryable
+	assert.False(t, IsRetryable(NewInvokeError(ErrFunction, "echo", &HttpStatusError{Code: http.StatusInternalServerError})))
+	assert.False(t, IsRetryable(NewInvokeError(ErrTimeout, "echo", reset)))
+	assert.False(t, IsRetryable(NewInvokeError(ErrNotFound, "echo", errors.New("not installed"))))
+}
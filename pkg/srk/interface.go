@@ -5,7 +5,7 @@
 package srk
 
 import (
-	"bytes"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -37,13 +37,20 @@ type FunctionService interface {
 	// Removes a function from the service. Does not affect packages.
 	Remove(fName string) (rerr error)
 
+	// List the functions installed to the service, ordered by name
+	List() ([]FunctionInfo, error)
+
+	// Describe an installed function
+	// Returns: nil if the function is not installed
+	Describe(fName string) (*FunctionInfo, error)
+
 	// Invoke function
 	// fName: Name of function
 	// args: JSON-encoded argument string
-	// Returns: function response as a bytes buffer. The exact format of this
-	// response may depend on the FaaS service. resp may be nil (indicating no
-	// valid response was received)
-	Invoke(fName string, args string) (resp *bytes.Buffer, rerr error)
+	// Returns: function response and information about the invocation. The
+	// exact format of the response body may depend on the FaaS service. resp
+	// may be nil (indicating no valid response was received)
+	Invoke(fName string, args string) (resp *InvokeResult, rerr error)
 
 	// Users must call Destroy on any created services to perform cleanup.
 	// Failure to destroy may leave the system in an inconsistent state that
@@ -60,6 +67,151 @@ type FunctionService interface {
 	ResetStats() error
 }
 
+// Description of a function installed to a service. Services fill in what
+// they know about a function, other fields are empty.
+type FunctionInfo struct {
+	Name string
+	// Runtime the function was installed with, e.g. a runtime of the SRK
+	// configuration or of the service
+	Runtime string
+	// Environment variables of the function
+	Env map[string]string
+	// Hash of the installed code. The format depends on the service (e.g.
+	// the base64 SHA-256 of the package on AWS Lambda).
+	CodeHash string
+	// Time of the last install
+	InstallTime time.Time
+	// Service-specific configuration, e.g. the memory size or the port
+	Config map[string]string
+}
+
+// The result of an invocation
+type InvokeResult struct {
+	// Response of the function, a description of the error if FunctionError
+	// is set
+	Body []byte
+	// Status code of the response, e.g. the HTTP status (0 if the service
+	// doesn't have one)
+	Status int
+	// The function raised an error
+	FunctionError bool
+	// Backend-specific information about the invocation, e.g. the version of
+	// an AWS Lambda function that was executed
+	Metadata map[string]string
+	// Client-side timing of the invocation
+	Timing InvokeTiming
+}
+
+// The body of the response as a string
+func (self *InvokeResult) String() string {
+	return string(self.Body)
+}
+
+// Client-side times from the start of an invocation until a connection was
+// established, the first byte of the response was received and the response
+// was complete. Connect and FirstByte are 0 if the service doesn't measure
+// them. With retries, they are the times of the last attempt.
+type InvokeTiming struct {
+	Connect   time.Duration
+	FirstByte time.Duration
+	Total     time.Duration
+}
+
+// A version of a layer: additional files (e.g. libraries or a custom runtime)
+// that are made available to functions of a runtime
+type Layer struct {
+	Name    string
+	Version int
+	// Reference to this version in the runtimes configuration of the service
+	// (e.g. a directory name or an ARN)
+	Ref string
+}
+
+// Function services that manage layers provide this interface in addition to
+// FunctionService
+type LayerService interface {
+
+	// Create a new version of layer name from the contents of directory dir.
+	// Versions start at 1 and increase with every call.
+	// Returns: the new layer version
+	CreateLayer(name string, dir string) (*Layer, error)
+
+	// List all versions of all layers, ordered by name and version
+	ListLayers() ([]Layer, error)
+
+	// Remove a version of a layer. Functions installed with this version
+	// may keep using it (depending on the service).
+	RemoveLayer(name string, version int) error
+}
+
+// An alias is a named pointer to a version of a function
+type FunctionAlias struct {
+	Name    string
+	Version string
+}
+
+// Function services that keep published versions of functions provide this
+// interface in addition to FunctionService. Versions and aliases can be
+// invoked by passing "NAME:VERSION" or "NAME:ALIAS" to Invoke().
+type VersionService interface {
+
+	// Publish the installed code and configuration of function fName as a
+	// new, immutable version.
+	// Returns: the new version
+	PublishVersion(fName string) (string, error)
+
+	// List the published versions of function fName, oldest first
+	ListVersions(fName string) ([]string, error)
+
+	// Create an alias of function fName or point an existing alias to
+	// version. The latest published version is used if version is empty.
+	SetAlias(fName string, alias string, version string) error
+
+	// List the aliases of function fName, ordered by name
+	ListAliases(fName string) ([]FunctionAlias, error)
+
+	// Remove an alias of function fName. The version it points to is kept.
+	RemoveAlias(fName string, alias string) error
+}
+
+// Function services with per-function settings (e.g. memory size or timeout)
+// provide this interface in addition to FunctionService
+type SettingsService interface {
+
+	// Set service-specific settings of function fName, e.g. "memory": "1024".
+	// They override the configuration in the following Install() calls of
+	// the function. Unknown settings or invalid values are an error.
+	SetFunctionSettings(fName string, settings map[string]string) error
+}
+
+// Function services that can queue invocations without waiting for the
+// function provide this interface in addition to FunctionService
+type AsyncService interface {
+
+	// Queue an invocation of function fName with args (a JSON-encoded
+	// argument string) and return once the service accepted it.
+	// Returns: information about the accepted invocation (e.g. the status
+	// and a request id), the body is empty
+	InvokeAsync(fName string, args string) (resp *InvokeResult, rerr error)
+}
+
+// A line that a function printed (or that the service logged about it)
+type LogEntry struct {
+	Time    time.Time
+	Message string
+}
+
+// Function services that keep the output of functions provide this interface
+// in addition to FunctionService
+type LogService interface {
+
+	// Read the log of function fName from since on (the whole log that is
+	// still available if since is zero). Services may keep the logs of
+	// functions for a limited time only.
+	// Returns: log entries, oldest first
+	Logs(fName string, since time.Time) ([]LogEntry, error)
+}
+
 type BenchArgs struct {
 	FName       string
 	FArgs       string
@@ -0,0 +1,180 @@
+package srk
+
+// Retry policy shared by all function services
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultMaxAttempts = 4
+	DefaultBaseDelay   = 100 * time.Millisecond
+	DefaultMaxDelay    = 5 * time.Second
+)
+
+// Error codes of cloud APIs (e.g. AWS) that indicate throttling
+var throttlingCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"TooManyRequestsException":               true,
+	"RequestLimitExceeded":                   true,
+	"ProvisionedThroughputExceededException": true,
+}
+
+// A RetryPolicy retries failed requests with exponential backoff and jitter.
+// Only errors classified by IsRetryable() are retried. The policy counts its
+// retries so that services can report them in their statistics.
+type RetryPolicy struct {
+	// Maximum number of attempts of a request (1 never retries)
+	MaxAttempts int
+	// Delay before the first retry, doubled with every further retry
+	BaseDelay time.Duration
+	// Upper bound of the delay between two attempts
+	MaxDelay time.Duration
+
+	retries int64
+}
+
+// Create a retry policy from the "retry" section of a service configuration
+// (keys max-attempts, base-delay and max-delay, delays are in seconds).
+// Missing values (or a nil config) use the defaults.
+func NewRetryPolicy(config *viper.Viper) (*RetryPolicy, error) {
+	policy := &RetryPolicy{
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
+		MaxDelay:    DefaultMaxDelay,
+	}
+	if config == nil {
+		return policy, nil
+	}
+
+	if config.IsSet("retry.max-attempts") {
+		policy.MaxAttempts = config.GetInt("retry.max-attempts")
+	}
+	if config.IsSet("retry.base-delay") {
+		policy.BaseDelay = time.Duration(config.GetFloat64("retry.base-delay") * float64(time.Second))
+	}
+	if config.IsSet("retry.max-delay") {
+		policy.MaxDelay = time.Duration(config.GetFloat64("retry.max-delay") * float64(time.Second))
+	}
+
+	if policy.MaxAttempts < 1 {
+		return nil, errors.New("retry.max-attempts must be at least 1")
+	}
+	if policy.BaseDelay < 0 || policy.MaxDelay < 0 {
+		return nil, errors.New("retry delays must not be negative")
+	}
+	return policy, nil
+}
+
+// Call op until it succeeds, returns an error that is not retryable or the
+// maximum number of attempts is reached. Returns the error of the last
+// attempt.
+func (self *RetryPolicy) Do(op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= self.MaxAttempts || !IsRetryable(err) {
+			return err
+		}
+		atomic.AddInt64(&self.retries, 1)
+		time.Sleep(self.Backoff(attempt))
+	}
+}
+
+// The delay after the given (failed) attempt, starting at 1. The delay is
+// chosen at random up to BaseDelay * 2^(attempt-1), capped at MaxDelay ("full
+// jitter"), which spreads out the retries of concurrent requests.
+func (self *RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := self.BaseDelay
+	for i := 1; i < attempt && delay < self.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > self.MaxDelay {
+		delay = self.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// Number of retries since the policy was created or ResetRetries() was called
+func (self *RetryPolicy) Retries() int64 {
+	return atomic.LoadInt64(&self.retries)
+}
+
+func (self *RetryPolicy) ResetRetries() {
+	atomic.StoreInt64(&self.retries, 0)
+}
+
+// An HTTP request that returned an unexpected status
+type HttpStatusError struct {
+	Method string
+	Url    string
+	Status string
+	Code   int
+}
+
+func (self *HttpStatusError) Error() string {
+	return self.Method + " " + self.Url + " returned status " + self.Status
+}
+
+func (self *HttpStatusError) StatusCode() int {
+	return self.Code
+}
+
+// Reports whether a failed request may succeed when it is repeated: the
+// service was throttled (HTTP 429 or a throttling error code), failed with a
+// server error (HTTP 5xx), or the connection was reset. Errors raised by the
+// function, timeouts and missing functions are not retried. Wrapped errors
+// (errors.Wrap, AWS errors) are classified by their cause.
+func IsRetryable(err error) bool {
+	for err != nil {
+		if e, ok := err.(*InvokeError); ok {
+			switch e.Kind {
+			case ErrThrottled:
+				return true
+			case ErrFunction, ErrTimeout, ErrNotFound:
+				return false
+			}
+		}
+		if e, ok := err.(interface{ StatusCode() int }); ok {
+			code := e.StatusCode()
+			if code == http.StatusTooManyRequests || code >= 500 {
+				return true
+			}
+		}
+		if e, ok := err.(interface{ Code() string }); ok && throttlingCodes[e.Code()] {
+			return true
+		}
+		switch err {
+		case syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE, io.EOF, io.ErrUnexpectedEOF:
+			return true
+		}
+		err = unwrapError(err)
+	}
+	return false
+}
+
+// The error wrapped by err, nil if there is none
+func unwrapError(err error) error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	case interface{ Cause() error }:
+		return e.Cause()
+	case interface{ OrigErr() error }:
+		// AWS errors
+		return e.OrigErr()
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package srk
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	policy, err := NewRetryPolicy(nil)
+	require.Nil(t, err)
+	assert.Equal(t, DefaultMaxAttempts, policy.MaxAttempts)
+	assert.Equal(t, DefaultBaseDelay, policy.BaseDelay)
+	assert.Equal(t, DefaultMaxDelay, policy.MaxDelay)
+
+	config := viper.New()
+	config.SetConfigType("yaml")
+	require.Nil(t, config.ReadConfig(bytes.NewBufferString(`
+retry :
+  max-attempts : 6
+  base-delay : 0.25
+  max-delay : 2
+`)))
+	policy, err = NewRetryPolicy(config)
+	require.Nil(t, err)
+	assert.Equal(t, 6, policy.MaxAttempts)
+	assert.Equal(t, 250*time.Millisecond, policy.BaseDelay)
+	assert.Equal(t, 2*time.Second, policy.MaxDelay)
+
+	config.Set("retry.max-attempts", 0)
+	_, err = NewRetryPolicy(config)
+	assert.NotNil(t, err)
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	// succeeds on the second attempt
+	attempts := 0
+	err := policy.Do(func() error {
+		if attempts++; attempts < 2 {
+			return syscall.ECONNRESET
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, int64(1), policy.Retries())
+
+	// gives up after MaxAttempts
+	attempts = 0
+	err = policy.Do(func() error {
+		attempts++
+		return &HttpStatusError{Code: http.StatusServiceUnavailable}
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, int64(3), policy.Retries())
+
+	// other errors are returned immediately
+	attempts = 0
+	err = policy.Do(func() error {
+		attempts++
+		return errors.New("invalid request")
+	})
+	assert.EqualError(t, err, "invalid request")
+	assert.Equal(t, 1, attempts)
+
+	policy.ResetRetries()
+	assert.Equal(t, int64(0), policy.Retries())
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		assert.True(t, policy.Backoff(1) <= 10*time.Millisecond)
+		assert.True(t, policy.Backoff(2) <= 20*time.Millisecond)
+		assert.True(t, policy.Backoff(8) <= 50*time.Millisecond)
+		assert.True(t, policy.Backoff(1000) >= 0)
+	}
+
+	policy.BaseDelay = 0
+	assert.Equal(t, time.Duration(0), policy.Backoff(3))
+}
+
+func TestIsRetryable(t *testing.T) {
+	reset := &url.Error{Op: "Post", URL: "http://localhost", Err: &net.OpError{Op: "read", Net: "tcp",
+		Err: os.NewSyscallError("read", syscall.ECONNRESET)}}
+
+	for _, err := range []error{
+		reset,
+		errors.Wrap(reset, "Failed to POST request"),
+		&url.Error{Op: "Post", URL: "http://localhost", Err: io.EOF},
+		&HttpStatusError{Code: http.StatusTooManyRequests},
+		&HttpStatusError{Code: http.StatusBadGateway},
+		awserr.NewRequestFailure(awserr.New("TooManyRequestsException", "Rate exceeded", nil), 429, "id"),
+		awserr.NewRequestFailure(awserr.New("ServiceException", "internal", nil), 500, "id"),
+		awserr.New("ThrottlingException", "Rate exceeded", nil),
+		awserr.New("RequestError", "send request failed", reset),
+	} {
+		assert.True(t, IsRetryable(err), "%v", err)
+	}
+
+	for _, err := range []error{
+		nil,
+		errors.New("function failed"),
+		&HttpStatusError{Code: http.StatusNotFound},
+		awserr.NewRequestFailure(awserr.New("ResourceNotFoundException", "not found", nil), 404, "id"),
+		&url.Error{Op: "Post", URL: "http://localhost", Err: syscall.ECONNREFUSED},
+	} {
+		assert.False(t, IsRetryable(err), "%v", err)
+	}
+}
+
+func TestHttpPostStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	_, err := HttpPost(ts.URL, "{}")
+	require.NotNil(t, err)
+	statusErr, ok := err.(*HttpStatusError)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode())
+	assert.True(t, IsRetryable(err))
+}
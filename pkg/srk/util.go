@@ -7,12 +7,18 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -50,6 +56,11 @@ func CopyFile(src, dst string) error {
 	return nil
 }
 
+// Modification time of all entries of archives created by ZipDir and TarDir
+// (the earliest time zip can represent). Together with the lexical order of
+// entries, it makes archives of the same files identical.
+var archiveTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
 // Create a zip archive from srcPath stored at dstPath.
 // The paths in the archive will all be relative to basePath. For example,
 // ZipDir("foo/bar", "foo/bar", "bar.zip") would include all of the files in
@@ -65,13 +76,14 @@ func ZipDir(basePath, srcPath, dstPath string) error {
 
 	zipWriter := zip.NewWriter(destFile)
 	defer zipWriter.Close()
+	// filepath.Walk visits files in lexical order
 	err = filepath.Walk(srcPath, func(filePath string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
-		}
 		if err != nil {
 			return err
 		}
+		if info.IsDir() {
+			return nil
+		}
 		relPath, err := filepath.Rel(basePath, filePath)
 		if err != nil {
 			return errors.Wrap(err, "Couldn't make relative path while zipping")
@@ -84,6 +96,7 @@ func ZipDir(basePath, srcPath, dstPath string) error {
 
 		header.Name = relPath
 		header.Method = zip.Deflate
+		header.Modified = archiveTime
 		writer, err := zipWriter.CreateHeader(header)
 		if err != nil {
 			return err
@@ -188,6 +201,7 @@ func TarDir(basePath, srcPath, dstPath string) error {
 	tarWriter := tar.NewWriter(gzw)
 	defer tarWriter.Close()
 
+	// filepath.Walk visits files in lexical order
 	err = filepath.Walk(srcPath, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -203,6 +217,12 @@ func TarDir(basePath, srcPath, dstPath string) error {
 			return err
 		}
 		header.Name = relPath
+		// only keep what is needed to extract the file
+		header.ModTime = archiveTime
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
 
 		if err := tarWriter.WriteHeader(header); err != nil {
 			return err
@@ -235,6 +255,73 @@ func TarDir(basePath, srcPath, dstPath string) error {
 	return nil
 }
 
+// Hash the contents of a directory: the relative paths, permissions and
+// contents of all files and the targets of symbolic links. Unlike the hash
+// of an archive, it does not depend on modification times.
+// Returns: the hex-encoded SHA-256
+func HashDir(dir string) (string, error) {
+	hash := sha256.New()
+	// filepath.Walk visits files in lexical order
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%o\x00%d\x00", filepath.ToSlash(relPath), info.Mode(), info.Size())
+
+		switch {
+		case info.Mode().IsRegular():
+			f, err := os.Open(filePath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(hash, f)
+			return err
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			io.WriteString(hash, target)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to hash %s", dir)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Create an archive of dir at dstPath with build (e.g. ZipDir) unless dstPath
+// was built from the same contents already. The hash of the contents is kept
+// next to the archive (in dstPath + ".hash").
+// Returns: true if the archive was (re)built
+func BuildArchive(dir, dstPath string, build func(basePath, srcPath, dstPath string) error) (bool, error) {
+	hash, err := HashDir(dir)
+	if err != nil {
+		return false, err
+	}
+	hashPath := dstPath + ".hash"
+	if built, err := ioutil.ReadFile(hashPath); err == nil && string(built) == hash {
+		if _, err := os.Stat(dstPath); err == nil {
+			return false, nil
+		}
+	}
+
+	// a failed build must not look up to date
+	if err := os.Remove(hashPath); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := build(dir, dir, dstPath); err != nil {
+		return false, err
+	}
+	return true, ioutil.WriteFile(hashPath, []byte(hash), 0644)
+}
+
 // Untar will decompress a .tar.gz archive, moving all files and folders
 // within the tar file (parameter 1) to an output directory (parameter 2).
 func Untar(src, dst string) ([]string, error) {
@@ -280,8 +367,9 @@ func UntarStream(src io.Reader, dstPath string) ([]string, error) {
 		}
 
 		// the target location where the dir/file should be created
+		// (archives created by TarDir contain dstPath itself as ".")
 		target := filepath.Join(dstPath, header.Name)
-		if !strings.HasPrefix(target, filepath.Clean(dstPath)+string(os.PathSeparator)) {
+		if target != filepath.Clean(dstPath) && !strings.HasPrefix(target, filepath.Clean(dstPath)+string(os.PathSeparator)) {
 			return filenames, fmt.Errorf("%s: illegal file path", target)
 		}
 		filenames = append(filenames, target)
@@ -325,49 +413,77 @@ func UntarStream(src io.Reader, dstPath string) ([]string, error) {
 	}
 }
 
-const (
-	maxRetries = 3
-	retryDelay = 1 * time.Second
-)
-
-// post an HTTP request and return result
-func HttpPost(url, data string) (*bytes.Buffer, error) {
+// Header of the invoke API of AWS Lambda (and of emulators like lambci) that
+// reports errors raised by the function
+const FunctionErrorHeader = "X-Amz-Function-Error"
 
-	doPost := func() (*bytes.Buffer, error) {
+// post an HTTP request and return result. Statuses other than 200 OK are
+// returned as *HttpStatusError unless the response reports a function error.
+// The request is not retried, see RetryPolicy.
+func HttpPost(url, data string) (*InvokeResult, error) {
 
-		response, err := http.Post(url, "application/json", strings.NewReader(data))
-		if err != nil {
-			return nil, err
-		}
-		defer response.Body.Close()
-
-		if response.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("POST %s (%s) returned status %s", url, data, response.Status)
-		}
+	timer := StartInvokeTimer()
+	request, err := http.NewRequest("POST", url, strings.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request.WithContext(timer.Context(context.Background())))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
 
-		result := new(bytes.Buffer)
-		_, err = result.ReadFrom(response.Body)
-		if err != nil {
-			return nil, err
-		}
+	functionError := response.Header.Get(FunctionErrorHeader) != ""
+	if response.StatusCode != http.StatusOK && !functionError {
+		return nil, &HttpStatusError{Method: "POST", Url: url, Status: response.Status, Code: response.StatusCode}
+	}
 
-		return result, nil
+	result := new(bytes.Buffer)
+	_, err = result.ReadFrom(response.Body)
+	if err != nil {
+		return nil, err
 	}
 
-	var err error
-	var result *bytes.Buffer
+	return &InvokeResult{
+		Body:          result.Bytes(),
+		Status:        response.StatusCode,
+		FunctionError: functionError,
+		Timing:        timer.Timing(),
+	}, nil
+}
 
-	retries := 0
-	for {
+// Measures the client-side timing of an invocation. HTTP requests report
+// when they are connected and receive the first byte of the response if they
+// are sent with the context returned by Context().
+type InvokeTimer struct {
+	start time.Time
+	// nanoseconds since start, set by the HTTP client
+	connect   int64
+	firstByte int64
+}
 
-		result, err = doPost()
-		if err == nil || retries >= maxRetries {
-			break
-		}
+func StartInvokeTimer() *InvokeTimer {
+	return &InvokeTimer{start: time.Now()}
+}
 
-		time.Sleep(retryDelay)
-		retries++
-	}
+// A context for HTTP requests that records their timing in the timer
+func (self *InvokeTimer) Context(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			atomic.StoreInt64(&self.connect, int64(time.Since(self.start)))
+		},
+		GotFirstResponseByte: func() {
+			atomic.StoreInt64(&self.firstByte, int64(time.Since(self.start)))
+		},
+	})
+}
 
-	return result, err
+// Timing of the invocation, call when the response is complete
+func (self *InvokeTimer) Timing() InvokeTiming {
+	return InvokeTiming{
+		Connect:   time.Duration(atomic.LoadInt64(&self.connect)),
+		FirstByte: time.Duration(atomic.LoadInt64(&self.firstByte)),
+		Total:     time.Since(self.start),
+	}
 }
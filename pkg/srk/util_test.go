@@ -8,9 +8,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const inputDir = "testData"
@@ -135,6 +137,133 @@ func TestTar(t *testing.T) {
 	}
 }
 
+func TestTarContents(t *testing.T) {
+	var err error
+
+	if err = cleanOutput(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Archive the contents of d1 (the archive's root entry is ".")
+	d1 := filepath.Join(inputDir, "d1")
+	err = TarDir(d1, d1, filepath.Join(outputDir, "d1.tgz"))
+	if err != nil {
+		t.Fatalf("Failed to tar file: %v\n", err)
+	}
+
+	extractDir := filepath.Join(outputDir, "extracted")
+	if _, err = Untar(filepath.Join(outputDir, "d1.tgz"), extractDir); err != nil {
+		t.Fatalf("Failed to extract file: %v\n", err)
+	}
+
+	if err := checkCopiedFile(filepath.Join(d1, "t1"), filepath.Join(extractDir, "t1")); err != nil {
+		t.Fatalf("Extracted file does not match original: %v\n", err)
+	}
+}
+
+func TestHashDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-hash")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	copyDir := func(name string) string {
+		d := filepath.Join(dir, name)
+		require.Nil(t, os.MkdirAll(filepath.Join(d, "lib"), 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(d, "f.py"), []byte("def f(event):\n    return event\n"), 0644))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(d, "lib", "util.py"), []byte("x = 1\n"), 0644))
+		return d
+	}
+	a, b := copyDir("a"), copyDir("b")
+
+	hashA, err := HashDir(a)
+	require.Nil(t, err)
+	assert.Len(t, hashA, 64)
+
+	// modification times don't matter
+	require.Nil(t, os.Chtimes(filepath.Join(b, "f.py"), time.Unix(0, 0), time.Unix(0, 0)))
+	hashB, err := HashDir(b)
+	require.Nil(t, err)
+	assert.Equal(t, hashA, hashB)
+
+	// contents and names do
+	require.Nil(t, ioutil.WriteFile(filepath.Join(b, "lib", "util.py"), []byte("x = 2\n"), 0644))
+	hashB, err = HashDir(b)
+	require.Nil(t, err)
+	assert.NotEqual(t, hashA, hashB)
+
+	require.Nil(t, os.Rename(filepath.Join(a, "lib"), filepath.Join(a, "lib2")))
+	hashA2, err := HashDir(a)
+	require.Nil(t, err)
+	assert.NotEqual(t, hashA, hashA2)
+
+	_, err = HashDir(filepath.Join(dir, "missing"))
+	assert.NotNil(t, err)
+}
+
+func TestReproducibleArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-archive")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	require.Nil(t, os.MkdirAll(filepath.Join(src, "lib"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "f.py"), []byte("def f(event):\n    return event\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "lib", "util.py"), []byte("x = 1\n"), 0644))
+
+	for _, build := range []func(basePath, srcPath, dstPath string) error{ZipDir, TarDir} {
+		first := filepath.Join(dir, "first")
+		require.Nil(t, build(src, src, first))
+
+		// touching the files doesn't change the archive
+		touched := time.Now().Add(time.Hour)
+		require.Nil(t, os.Chtimes(filepath.Join(src, "f.py"), touched, touched))
+		require.Nil(t, os.Chtimes(filepath.Join(src, "lib"), touched, touched))
+		second := filepath.Join(dir, "second")
+		require.Nil(t, build(src, src, second))
+
+		firstData, err := ioutil.ReadFile(first)
+		require.Nil(t, err)
+		secondData, err := ioutil.ReadFile(second)
+		require.Nil(t, err)
+		assert.Equal(t, firstData, secondData)
+	}
+}
+
+func TestBuildArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-archive")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "echo")
+	require.Nil(t, os.MkdirAll(src, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "f.py"), []byte("x = 1\n"), 0644))
+	zipPath := src + ".zip"
+
+	built, err := BuildArchive(src, zipPath, ZipDir)
+	require.Nil(t, err)
+	assert.True(t, built)
+	built, err = BuildArchive(src, zipPath, ZipDir)
+	require.Nil(t, err)
+	assert.False(t, built)
+
+	// changed contents and missing archives are rebuilt
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "f.py"), []byte("x = 2\n"), 0644))
+	built, err = BuildArchive(src, zipPath, ZipDir)
+	require.Nil(t, err)
+	assert.True(t, built)
+	require.Nil(t, os.Remove(zipPath))
+	built, err = BuildArchive(src, zipPath, ZipDir)
+	require.Nil(t, err)
+	assert.True(t, built)
+
+	fnames, err := Unzip(zipPath, filepath.Join(dir, "out"))
+	require.Nil(t, err)
+	require.Len(t, fnames, 1)
+	data, err := ioutil.ReadFile(fnames[0])
+	require.Nil(t, err)
+	assert.Equal(t, "x = 2\n", string(data))
+}
+
 func TestHttpPost(t *testing.T) {
 
 	var received string
@@ -152,6 +281,25 @@ func TestHttpPost(t *testing.T) {
 
 	assert.Equal(t, data, received)
 	assert.Equal(t, data, result.String())
+	assert.Equal(t, http.StatusOK, result.Status)
+	assert.False(t, result.FunctionError)
+	assert.True(t, result.Timing.Connect > 0)
+	assert.True(t, result.Timing.FirstByte >= result.Timing.Connect)
+	assert.True(t, result.Timing.Total >= result.Timing.FirstByte)
+}
+
+func TestHttpPostFunctionError(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(FunctionErrorHeader, "Unhandled")
+		w.Write([]byte(`{"errorMessage": "failed"}`))
+	}))
+	defer ts.Close()
+
+	result, err := HttpPost(ts.URL, "{}")
+	assert.Nil(t, err)
+	assert.True(t, result.FunctionError)
+	assert.Contains(t, result.String(), "failed")
 }
 
 // func TestMain(m *testing.M) {
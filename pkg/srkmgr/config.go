@@ -0,0 +1,146 @@
+package srkmgr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Name of the file next to the configuration file that holds the runtime
+// layers set by SRK. It has the same structure as the configuration file and
+// its settings take precedence. SRK never writes the configuration file
+// itself.
+const runtimeLayersFile = "runtime-layers.yaml"
+
+const runtimeLayersHeader = "# Runtime layers set by 'srk layer', they take precedence over the layers in\n" +
+	"# the configuration file. Remove a runtime here to use the configured layers.\n"
+
+// Runtimes returns the names of the runtimes configured for the FaaS service
+// in use
+func (self *SrkManager) Runtimes() []string {
+	var names []string
+	for name := range self.Cfg.GetStringMap("service.faas." + self.faasName + ".runtimes") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RuntimeLayers returns the layers configured for a runtime of the FaaS
+// service in use
+func (self *SrkManager) RuntimeLayers(runtime string) []string {
+	return self.Cfg.GetStringSlice("service.faas." + self.faasName + ".runtimes." + runtime + ".layers")
+}
+
+// SetRuntimeLayers updates the layers of a runtime of the FaaS service in use
+// (creating the runtime if needed). The layers are written to the runtime
+// layers file next to the configuration file, which is left untouched. The
+// FaaS service only sees the new layers once it is created again.
+func (self *SrkManager) SetRuntimeLayers(runtime string, layers []string) error {
+	// viper would read a dotted name as nested runtimes
+	if runtime == "" || strings.Contains(runtime, ".") {
+		return errors.Errorf("Invalid runtime name '%s', runtime names must not be empty or contain '.'", runtime)
+	}
+
+	path := self.runtimeLayersPath()
+	settings, err := readRuntimeLayers(path)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(layers))
+	for i, layer := range layers {
+		values[i] = layer
+	}
+	// viper keys are case insensitive
+	keys := []string{"service", "faas", strings.ToLower(self.faasName), "runtimes", strings.ToLower(runtime), "layers"}
+	if err := setNested(settings, keys, values); err != nil {
+		return errors.Wrapf(err, "Failed to update layers of runtime %s in %s", runtime, path)
+	}
+	if err := writeRuntimeLayers(path, settings); err != nil {
+		return errors.Wrapf(err, "Failed to update layers of runtime %s", runtime)
+	}
+
+	update := make(map[string]interface{})
+	setNested(update, keys, values)
+	return self.Cfg.MergeConfigMap(update)
+}
+
+// Merge the runtime layers set by SRK (if any) into the configuration
+func (self *SrkManager) loadRuntimeLayers() error {
+	settings, err := readRuntimeLayers(self.runtimeLayersPath())
+	if err != nil {
+		return err
+	}
+	return self.Cfg.MergeConfigMap(settings)
+}
+
+func (self *SrkManager) runtimeLayersPath() string {
+	return filepath.Join(filepath.Dir(self.Cfg.ConfigFileUsed()), runtimeLayersFile)
+}
+
+// Read the runtime layers file, an empty map if it does not exist
+func readRuntimeLayers(path string) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "Failed to read runtime layers")
+	}
+	if err := yaml.Unmarshal(raw, &settings); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse %s", path)
+	}
+	if settings == nil {
+		settings = make(map[string]interface{})
+	}
+	return settings, nil
+}
+
+// Replace the runtime layers file atomically
+func writeRuntimeLayers(path string, settings map[string]interface{}) error {
+	raw, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), runtimeLayersFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(runtimeLayersHeader); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Set the value at a path of keys in nested maps, creating missing maps along
+// the way
+func setNested(m map[string]interface{}, keys []string, value interface{}) error {
+	for i, k := range keys[:len(keys)-1] {
+		child, exists := m[k]
+		if !exists || child == nil {
+			child = make(map[string]interface{})
+			m[k] = child
+		}
+		next, ok := child.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("%s is not a mapping", strings.Join(keys[:i+1], "."))
+		}
+		m = next
+	}
+	m[keys[len(keys)-1]] = value
+	return nil
+}
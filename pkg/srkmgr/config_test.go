@@ -0,0 +1,71 @@
+package srkmgr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// layers set by srk go to their own file, the configuration file and all other
+// settings stay as they are
+func TestSetRuntimeLayers(t *testing.T) {
+	example, err := ioutil.ReadFile("../../runtime/example-config.yaml")
+	require.Nil(t, err)
+	dir, err := ioutil.TempDir("", "srk-config")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	require.Nil(t, ioutil.WriteFile(path, example, 0644))
+
+	before := &SrkManager{Logger: logrus.New(), faasName: "lambciLambda"}
+	require.Nil(t, before.initConfig(&dir))
+	mgr := &SrkManager{Logger: logrus.New(), faasName: "lambciLambda"}
+	require.Nil(t, mgr.initConfig(&dir))
+
+	// runtime names are case insensitive like all viper keys
+	require.Nil(t, mgr.SetRuntimeLayers("cffs-Python", []string{"runtime-python37-2"}))
+	require.Nil(t, mgr.SetRuntimeLayers("custom", []string{"custom-1", "extra-1"}))
+	assert.NotNil(t, mgr.SetRuntimeLayers("python3.8", []string{"custom-1"}))
+	assert.NotNil(t, mgr.SetRuntimeLayers("", []string{"custom-1"}))
+
+	raw, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, string(example), string(raw))
+
+	// the new layers are seen right away and by later runs
+	after := &SrkManager{Logger: logrus.New(), faasName: "lambciLambda"}
+	require.Nil(t, after.initConfig(&dir))
+	for _, m := range []*SrkManager{mgr, after} {
+		assert.Equal(t, []string{"runtime-python37-2"}, m.RuntimeLayers("cffs-python"))
+		assert.Equal(t, []string{"custom-1", "extra-1"}, m.RuntimeLayers("custom"))
+		runtimes := append(before.Runtimes(), "custom")
+		sort.Strings(runtimes)
+		assert.Equal(t, runtimes, m.Runtimes())
+
+		for _, k := range before.Cfg.AllKeys() {
+			if k != "service.faas.lambcilambda.runtimes.cffs-python.layers" {
+				assert.Equal(t, before.Cfg.Get(k), m.Cfg.Get(k), k)
+			}
+		}
+		assert.Equal(t, len(before.Cfg.AllKeys())+1, len(m.Cfg.AllKeys()))
+
+		// the FaaS service gets all of its settings
+		sub := m.Cfg.Sub("service.faas.lambciLambda")
+		assert.Equal(t, before.Cfg.GetString("service.faas.lambciLambda.directory"), sub.GetString("directory"))
+		assert.Equal(t, []string{"custom-1", "extra-1"}, sub.GetStringSlice("runtimes.custom.layers"))
+	}
+
+	// updating one runtime keeps the others
+	require.Nil(t, after.SetRuntimeLayers("custom", []string{"custom-2"}))
+	layers, err := ioutil.ReadFile(filepath.Join(dir, runtimeLayersFile))
+	require.Nil(t, err)
+	assert.Contains(t, string(layers), "runtime-python37-2")
+	assert.Contains(t, string(layers), "custom-2")
+	assert.NotContains(t, string(layers), "custom-1")
+}
@@ -0,0 +1,322 @@
+package srkmgr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/serverlessresearch/srk/pkg/srk"
+)
+
+// Name of the function index in the build directory. It lives next to (not
+// in) the functions directory so that cleaning functions keeps it.
+const indexFile = "functions.json"
+
+// What SRK recorded about a function it created: where it came from and
+// where it was installed to
+type FunctionRecord struct {
+	Name string `json:"name"`
+	// Absolute path of the source file or directory
+	Source   string   `json:"source"`
+	Includes []string `json:"includes,omitempty"`
+	Files    []string `json:"files,omitempty"`
+	// Hash of the source, includes and files when the raw directory was
+	// created
+	SourceHash string `json:"sourceHash"`
+	// Hash of the raw directory, empty if it was cleaned
+	PackageHash string    `json:"packageHash,omitempty"`
+	PackageTime time.Time `json:"packageTime"`
+	// Installs of the function by provider name
+	Installs map[string]InstallRecord `json:"installs,omitempty"`
+}
+
+// An install of a function to a provider
+type InstallRecord struct {
+	// FaaS service of the provider (e.g. "awsLambda")
+	Service string `json:"service"`
+	Runtime string `json:"runtime,omitempty"`
+	// Hash of the raw directory that was installed
+	PackageHash string    `json:"packageHash"`
+	Time        time.Time `json:"time"`
+}
+
+type functionIndex struct {
+	Functions map[string]*FunctionRecord `json:"functions"`
+}
+
+// Function returns the record of a function, nil if SRK didn't create it
+func (self *SrkManager) Function(funcName string) (*FunctionRecord, error) {
+	index, err := self.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	return index.Functions[funcName], nil
+}
+
+// Functions returns the records of all functions, ordered by name
+func (self *SrkManager) Functions() ([]FunctionRecord, error) {
+	index, err := self.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]FunctionRecord, 0, len(index.Functions))
+	for _, record := range index.Functions {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records, nil
+}
+
+// PackageStale reports whether the source, includes or files of a function
+// changed since its raw directory was created. Functions without a record
+// (or without a raw directory) are not stale.
+func (self *SrkManager) PackageStale(funcName string) (bool, error) {
+	record, err := self.Function(funcName)
+	if err != nil || record == nil || record.PackageHash == "" {
+		return false, err
+	}
+	sourceHash, err := self.hashSources(record.Source, record.Includes, record.Files)
+	if err != nil {
+		return false, err
+	}
+	return sourceHash != record.SourceHash, nil
+}
+
+// RecordInstall records that a function was installed to the provider in use
+func (self *SrkManager) RecordInstall(funcName string, runtime string) error {
+	packageHash, err := srk.HashDir(self.GetRawPath(funcName))
+	if err != nil {
+		return err
+	}
+	return self.updateIndex(func(index *functionIndex) {
+		record := index.Functions[funcName]
+		if record == nil {
+			// installed from a raw directory that SRK didn't record
+			record = &FunctionRecord{Name: funcName}
+			index.Functions[funcName] = record
+		}
+		if record.Installs == nil {
+			record.Installs = make(map[string]InstallRecord)
+		}
+		record.Installs[self.providerName] = InstallRecord{
+			Service:     self.faasName,
+			Runtime:     runtime,
+			PackageHash: packageHash,
+			Time:        time.Now(),
+		}
+	})
+}
+
+// RecordRemove records that a function was removed from the provider in use
+func (self *SrkManager) RecordRemove(funcName string) error {
+	return self.updateIndex(func(index *functionIndex) {
+		if record := index.Functions[funcName]; record != nil {
+			delete(record.Installs, self.providerName)
+			self.dropUnused(index, funcName)
+		}
+	})
+}
+
+// RecordClean records that the local files of a function (of all functions
+// if funcName is empty) were removed
+func (self *SrkManager) RecordClean(funcName string) error {
+	return self.updateIndex(func(index *functionIndex) {
+		for name, record := range index.Functions {
+			if funcName == "" || name == funcName {
+				record.PackageHash = ""
+				self.dropUnused(index, name)
+			}
+		}
+	})
+}
+
+// InstalledFunctions returns the names of the functions installed to the
+// provider in use, ordered by name
+func (self *SrkManager) InstalledFunctions() ([]string, error) {
+	records, err := self.Functions()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, record := range records {
+		if _, ok := record.Installs[self.providerName]; ok {
+			names = append(names, record.Name)
+		}
+	}
+	return names, nil
+}
+
+// Check if the raw directory of a function was created from the same
+// sources and wasn't changed since. Sources are given as absolute paths.
+// Returns: the hash of the sources and whether the raw directory is current
+func (self *SrkManager) checkRaw(funcName string, source string, includes, files []string) (string, bool, error) {
+	sourceHash, err := self.hashSources(source, includes, files)
+	if err != nil {
+		return "", false, err
+	}
+	record, err := self.Function(funcName)
+	if err != nil || record == nil || record.PackageHash == "" || record.SourceHash != sourceHash {
+		return sourceHash, false, err
+	}
+	packageHash, err := srk.HashDir(self.GetRawPath(funcName))
+	if err != nil {
+		// e.g. removed without clean
+		return sourceHash, false, nil
+	}
+	return sourceHash, packageHash == record.PackageHash, nil
+}
+
+// Add a record for a newly created raw directory. Installs of an older
+// version of the function are kept. sourceHash is computed if it is empty.
+func (self *SrkManager) recordPackage(funcName string, source string, includes, files []string, sourceHash string) error {
+	var err error
+	if sourceHash == "" {
+		if sourceHash, err = self.hashSources(source, includes, files); err != nil {
+			return err
+		}
+	}
+	packageHash, err := srk.HashDir(self.GetRawPath(funcName))
+	if err != nil {
+		return err
+	}
+	return self.updateIndex(func(index *functionIndex) {
+		record := &FunctionRecord{
+			Name:        funcName,
+			Source:      source,
+			Includes:    includes,
+			Files:       files,
+			SourceHash:  sourceHash,
+			PackageHash: packageHash,
+			PackageTime: time.Now(),
+		}
+		if old := index.Functions[funcName]; old != nil {
+			record.Installs = old.Installs
+		}
+		index.Functions[funcName] = record
+	})
+}
+
+// Make the sources of a function absolute, staleness checks may run in
+// another working directory
+func absSources(source string, files []string) (string, []string, error) {
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return "", nil, err
+	}
+	var absFiles []string
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		absFile, err := filepath.Abs(file)
+		if err != nil {
+			return "", nil, err
+		}
+		absFiles = append(absFiles, absFile)
+	}
+	return source, absFiles, nil
+}
+
+// Forget a function that has neither local files nor installs
+func (self *SrkManager) dropUnused(index *functionIndex, funcName string) {
+	if record := index.Functions[funcName]; record.PackageHash == "" && len(record.Installs) == 0 {
+		delete(index.Functions, funcName)
+	}
+}
+
+// Hash everything that goes into the raw directory of a function
+func (self *SrkManager) hashSources(source string, includes, files []string) (string, error) {
+	paths := []string{source}
+	for _, include := range includes {
+		if include != "" {
+			paths = append(paths, self.includePath(include))
+		}
+	}
+	for _, file := range files {
+		if file != "" {
+			paths = append(paths, file)
+		}
+	}
+
+	hash := sha256.New()
+	for _, path := range paths {
+		pathHash, err := srk.HashDir(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s\x00%s\x00", path, pathHash)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (self *SrkManager) indexPath() string {
+	return filepath.Join(self.Cfg.GetString("buildDir"), indexFile)
+}
+
+// Read the index, an empty index if it doesn't exist yet
+func (self *SrkManager) readIndex() (*functionIndex, error) {
+	index := &functionIndex{}
+	raw, err := ioutil.ReadFile(self.indexPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "Failed to read function index")
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, index); err != nil {
+			return nil, errors.Wrapf(err, "Invalid function index %s", self.indexPath())
+		}
+	}
+	if index.Functions == nil {
+		index.Functions = make(map[string]*FunctionRecord)
+	}
+	return index, nil
+}
+
+// Read, change and write back the index. The file is replaced atomically so
+// that readers never see a partial index, updates of concurrent srk processes
+// are serialized by a lock file.
+func (self *SrkManager) updateIndex(update func(index *functionIndex)) error {
+	if err := os.MkdirAll(filepath.Dir(self.indexPath()), 0775); err != nil {
+		return errors.Wrap(err, "Failed to create build directory")
+	}
+	lock, err := os.OpenFile(self.indexPath()+".lock", os.O_RDWR|os.O_CREATE, 0664)
+	if err != nil {
+		return errors.Wrap(err, "Failed to lock function index")
+	}
+	// closing the file releases the lock
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return errors.Wrap(err, "Failed to lock function index")
+	}
+
+	index, err := self.readIndex()
+	if err != nil {
+		return err
+	}
+	update(index)
+
+	raw, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(self.indexPath()), indexFile+".*")
+	if err != nil {
+		return errors.Wrap(err, "Failed to write function index")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "Failed to write function index")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "Failed to write function index")
+	}
+	return os.Rename(tmp.Name(), self.indexPath())
+}
@@ -0,0 +1,163 @@
+package srkmgr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunctionIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-index")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "echo")
+	require.Nil(t, os.MkdirAll(source, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(source, "f.py"), []byte("def f(event): pass\n"), 0644))
+	include := filepath.Join(dir, "includes", "python", "bench")
+	require.Nil(t, os.MkdirAll(include, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(include, "bench.py"), []byte("x = 1\n"), 0644))
+
+	mgr := &SrkManager{Cfg: viper.New(), Logger: logrus.New(), providerName: "lambci", faasName: "lambciLambda"}
+	mgr.Cfg.Set("buildDir", filepath.Join(dir, "build"))
+	mgr.Cfg.Set("includeDir", filepath.Join(dir, "includes"))
+
+	require.Nil(t, mgr.CreateRaw(source, "echo", []string{"bench"}, nil))
+	record, err := mgr.Function("echo")
+	require.Nil(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, source, record.Source)
+	assert.Equal(t, []string{"bench"}, record.Includes)
+	assert.NotEmpty(t, record.PackageHash)
+
+	stale, err := mgr.PackageStale("echo")
+	require.Nil(t, err)
+	assert.False(t, stale)
+	// includes are part of the package
+	require.Nil(t, ioutil.WriteFile(filepath.Join(include, "bench.py"), []byte("x = 2\n"), 0644))
+	stale, err = mgr.PackageStale("echo")
+	require.Nil(t, err)
+	assert.True(t, stale)
+
+	require.Nil(t, mgr.RecordInstall("echo", "python3"))
+	mgr.providerName = "aws"
+	require.Nil(t, mgr.RecordInstall("echo", ""))
+	names, err := mgr.InstalledFunctions()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"echo"}, names)
+
+	// packaging again keeps the installs and is no longer stale
+	require.Nil(t, mgr.CreateRaw(source, "echo", []string{"bench"}, nil))
+	stale, err = mgr.PackageStale("echo")
+	require.Nil(t, err)
+	assert.False(t, stale)
+	record, err = mgr.Function("echo")
+	require.Nil(t, err)
+	require.Len(t, record.Installs, 2)
+	assert.Equal(t, "python3", record.Installs["lambci"].Runtime)
+	assert.Equal(t, "lambciLambda", record.Installs["lambci"].Service)
+
+	// functions are forgotten once they are neither installed nor packaged
+	require.Nil(t, mgr.RecordRemove("echo"))
+	require.Nil(t, mgr.RecordClean(""))
+	records, err := mgr.Functions()
+	require.Nil(t, err)
+	require.Len(t, records, 1)
+	assert.Empty(t, records[0].PackageHash)
+	assert.Contains(t, records[0].Installs, "lambci")
+
+	mgr.providerName = "lambci"
+	require.Nil(t, mgr.RecordRemove("echo"))
+	record, err = mgr.Function("echo")
+	require.Nil(t, err)
+	assert.Nil(t, record)
+}
+
+func TestCreateRawUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-index")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "echo")
+	require.Nil(t, os.MkdirAll(source, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(source, "f.py"), []byte("def f(event): pass\n"), 0644))
+
+	mgr := &SrkManager{Cfg: viper.New(), Logger: logrus.New(), providerName: "lambci", faasName: "lambciLambda"}
+	mgr.Cfg.Set("buildDir", filepath.Join(dir, "build"))
+
+	// a copied file gets a new modification time, a skipped one keeps it
+	rawFile := filepath.Join(mgr.GetRawPath("echo"), "f.py")
+	old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	copied := func() bool {
+		info, err := os.Stat(rawFile)
+		require.Nil(t, err)
+		return !info.ModTime().Equal(old)
+	}
+
+	require.Nil(t, mgr.CreateRaw(source, "echo", nil, nil))
+	require.Nil(t, os.Chtimes(rawFile, old, old))
+	require.Nil(t, mgr.CreateRaw(source, "echo", nil, nil))
+	assert.False(t, copied())
+
+	// changed sources
+	require.Nil(t, ioutil.WriteFile(filepath.Join(source, "f.py"), []byte("def f(event): return 1\n"), 0644))
+	require.Nil(t, mgr.CreateRaw(source, "echo", nil, nil))
+	assert.True(t, copied())
+
+	// changed raw directory
+	require.Nil(t, os.Chtimes(rawFile, old, old))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(mgr.GetRawPath("echo"), "extra"), []byte("x"), 0644))
+	require.Nil(t, mgr.CreateRaw(source, "echo", nil, nil))
+	assert.True(t, copied())
+	_, err = os.Stat(filepath.Join(mgr.GetRawPath("echo"), "extra"))
+	assert.True(t, os.IsNotExist(err))
+
+	// missing sources are reported by the copy, a broken index is an error
+	err = mgr.CreateRaw(filepath.Join(dir, "missing"), "missing", nil, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Adding source")
+	require.Nil(t, ioutil.WriteFile(mgr.indexPath(), []byte("{"), 0644))
+	err = mgr.CreateRaw(source, "echo", nil, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Invalid function index")
+}
+
+// concurrent srk processes don't lose each other's records
+func TestConcurrentIndexUpdates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srk-index")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		// every manager opens its own lock file like separate processes do
+		mgr := &SrkManager{Cfg: viper.New(), Logger: logrus.New(), providerName: "lambci", faasName: "lambciLambda"}
+		mgr.Cfg.Set("buildDir", filepath.Join(dir, "build"))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				name := fmt.Sprintf("f%d-%d", i, j)
+				assert.Nil(t, mgr.updateIndex(func(index *functionIndex) {
+					index.Functions[name] = &FunctionRecord{Name: name}
+				}))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	mgr := &SrkManager{Cfg: viper.New()}
+	mgr.Cfg.Set("buildDir", filepath.Join(dir, "build"))
+	index, err := mgr.readIndex()
+	require.Nil(t, err)
+	assert.Equal(t, 200, len(index.Functions))
+}
@@ -23,6 +23,10 @@ type SrkManager struct {
 	Provider *srk.Provider
 	Logger   srk.Logger
 	Cfg      *viper.Viper
+	// Name of the provider in use (the default provider of the configuration)
+	providerName string
+	// Name of the FaaS service in use (e.g. "awsLambda")
+	faasName string
 }
 
 // Creates a new SrkManager and initializes the session. You must call
@@ -89,7 +93,9 @@ func (self *SrkManager) GetRawPath(funcName string) string {
 }
 
 // CreateRaw places all provider-independent objects in a raw directory that
-// will be packaged by the FaaS service. Will replace any existing rawDir.
+// will be packaged by the FaaS service. Will replace any existing rawDir,
+// unless it was created from the same sources already. The function is
+// recorded in the function index of the build directory.
 //   source: is the path to the user-provided source directory
 //   funcName: Unique name to give this function
 //   includes: List of standard SRK libraries to include (just the names of the
@@ -105,7 +111,20 @@ func (self *SrkManager) CreateRaw(source string, funcName string, includes, file
 		return errors.Wrap(err, "Failed to create build directory at "+fBuildDir)
 	}
 
-	// Always cleanup old raw directories first
+	if source, files, err = absSources(source, files); err != nil {
+		return err
+	}
+	// missing sources are reported while copying
+	sourceHash, upToDate, err := self.checkRaw(funcName, source, includes, files)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return errors.Wrap(err, "Failed to check raw function")
+	}
+	if upToDate {
+		self.Logger.Info("Raw function is up to date: " + rawDir)
+		return nil
+	}
+
+	// Cleanup old raw directories first
 	if err := os.RemoveAll(rawDir); err != nil {
 		return errors.Wrap(err, "Failed to cleanup old build directory "+rawDir)
 	}
@@ -121,10 +140,7 @@ func (self *SrkManager) CreateRaw(source string, funcName string, includes, file
 		if include == "" {
 			continue
 		}
-		includePath := filepath.Join(
-			self.Cfg.GetString("includeDir"),
-			"python",
-			include)
+		includePath := self.includePath(include)
 		if _, err := os.Stat(includePath); err != nil {
 			return errors.Wrap(err, "Couldn't find include: "+include)
 		}
@@ -148,9 +164,20 @@ func (self *SrkManager) CreateRaw(source string, funcName string, includes, file
 		}
 	}
 
+	if err := self.recordPackage(funcName, source, includes, files, sourceHash); err != nil {
+		return errors.Wrap(err, "Failed to record function")
+	}
 	return nil
 }
 
+// Path of a standard SRK library
+func (self *SrkManager) includePath(include string) string {
+	return filepath.Join(
+		self.Cfg.GetString("includeDir"),
+		"python",
+		include)
+}
+
 func (self *SrkManager) CleanDirectory(glob string) error {
 
 	matches, err := filepath.Glob(glob)
@@ -193,6 +220,9 @@ func (self *SrkManager) initConfig(homePath *string) error {
 	if err := self.Cfg.ReadInConfig(); err != nil {
 		return errors.Wrap(err, "Failed to load config")
 	}
+	if err := self.loadRuntimeLayers(); err != nil {
+		return errors.Wrap(err, "Failed to load config")
+	}
 	return nil
 }
 
@@ -208,6 +238,9 @@ func (self *SrkManager) initFunctionService() error {
 		return errors.New("Provider \"" + providerName + "\" does not provide a FaaS service")
 	}
 
+	self.providerName = providerName
+	self.faasName = serviceName
+
 	var err error = nil
 	switch serviceName {
 	case "openLambda":
@@ -14,7 +14,9 @@ import (
 	"github.com/serverlessresearch/srk/srkServer/srkproto"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type pbByteStream interface {
@@ -137,13 +139,44 @@ func (s *srkServer) Install(ctx context.Context, arg *srkproto.InstallArg) (*srk
 	return &srkproto.InstallRet{}, s.mgr.Provider.Faas.Install(rawDir, env, runtime)
 }
 
+// Errors raised by the function are returned in the response (with
+// function_error set), other invocation errors as a gRPC status
 func (s *srkServer) Invoke(ctx context.Context, arg *srkproto.InvokeArg) (*srkproto.InvokeRet, error) {
 	r, err := s.mgr.Provider.Faas.Invoke(arg.Name, string(arg.Farg))
 	if err != nil {
-		return nil, err
+		if r == nil || srk.KindOf(err) != srk.ErrFunction {
+			return nil, invokeStatus(err)
+		}
+		err = nil
 	}
 
-	return &srkproto.InvokeRet{Body: r.Bytes()}, err
+	return &srkproto.InvokeRet{
+		Body:          r.Body,
+		Status:        int32(r.Status),
+		FunctionError: r.FunctionError,
+		Metadata:      r.Metadata,
+		ConnectTime:   r.Timing.Connect.Microseconds(),
+		FirstByteTime: r.Timing.FirstByte.Microseconds(),
+		TotalTime:     r.Timing.Total.Microseconds(),
+	}, err
+}
+
+// gRPC status of an invocation error
+func invokeStatus(err error) error {
+	code := codes.Unknown
+	switch srk.KindOf(err) {
+	case srk.ErrTransport:
+		code = codes.Unavailable
+	case srk.ErrThrottled:
+		code = codes.ResourceExhausted
+	case srk.ErrFunction:
+		code = codes.Aborted
+	case srk.ErrTimeout:
+		code = codes.DeadlineExceeded
+	case srk.ErrNotFound:
+		code = codes.NotFound
+	}
+	return status.Error(code, err.Error())
 }
 
 func (s *srkServer) Remove(ctx context.Context, arg *srkproto.RemoveArg) (*srkproto.RemoveRet, error) {
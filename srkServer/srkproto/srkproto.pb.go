@@ -24,6 +24,9 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+// The context can include metadata with the following fields:
+// env - array of environment variable definitions in KEY=VALUE format
+// runtime - name of the runtime to use (see SRK configuration doc)
 type InstallArg struct {
 	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -65,7 +68,8 @@ func (m *InstallArg) GetName() string {
 
 type InvokeArg struct {
 	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	// Function argument (json)
+	// Function argument. Currently, this argument must represent a string to
+	// be passed to the function, although this may change in future versions.
 	Farg                 []byte   `protobuf:"bytes,2,opt,name=farg,proto3" json:"farg,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -112,7 +116,20 @@ func (m *InvokeArg) GetFarg() []byte {
 }
 
 type InvokeRet struct {
-	Body                 []byte   `protobuf:"bytes,1,opt,name=Body,proto3" json:"Body,omitempty"`
+	Body []byte `protobuf:"bytes,1,opt,name=Body,proto3" json:"Body,omitempty"`
+	// Status code of the response, e.g. the HTTP status (0 if unknown)
+	Status int32 `protobuf:"varint,2,opt,name=status,proto3" json:"status,omitempty"`
+	// True if the function raised an error, Body then describes the error
+	FunctionError bool `protobuf:"varint,3,opt,name=function_error,json=functionError,proto3" json:"function_error,omitempty"`
+	// Backend-specific information about the invocation, e.g. the version of
+	// an AWS Lambda function that was executed
+	Metadata map[string]string `protobuf:"bytes,4,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// Client-side times in microseconds from the start of the invocation
+	// until a connection was established, the first byte of the response was
+	// received and the response was complete
+	ConnectTime          int64    `protobuf:"varint,5,opt,name=connect_time,json=connectTime,proto3" json:"connect_time,omitempty"`
+	FirstByteTime        int64    `protobuf:"varint,6,opt,name=first_byte_time,json=firstByteTime,proto3" json:"first_byte_time,omitempty"`
+	TotalTime            int64    `protobuf:"varint,7,opt,name=total_time,json=totalTime,proto3" json:"total_time,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -150,6 +167,48 @@ func (m *InvokeRet) GetBody() []byte {
 	return nil
 }
 
+func (m *InvokeRet) GetStatus() int32 {
+	if m != nil {
+		return m.Status
+	}
+	return 0
+}
+
+func (m *InvokeRet) GetFunctionError() bool {
+	if m != nil {
+		return m.FunctionError
+	}
+	return false
+}
+
+func (m *InvokeRet) GetMetadata() map[string]string {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+func (m *InvokeRet) GetConnectTime() int64 {
+	if m != nil {
+		return m.ConnectTime
+	}
+	return 0
+}
+
+func (m *InvokeRet) GetFirstByteTime() int64 {
+	if m != nil {
+		return m.FirstByteTime
+	}
+	return 0
+}
+
+func (m *InvokeRet) GetTotalTime() int64 {
+	if m != nil {
+		return m.TotalTime
+	}
+	return 0
+}
+
 type RemoveArg struct {
 	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -327,6 +386,7 @@ func init() {
 	proto.RegisterType((*InstallArg)(nil), "srkproto.InstallArg")
 	proto.RegisterType((*InvokeArg)(nil), "srkproto.InvokeArg")
 	proto.RegisterType((*InvokeRet)(nil), "srkproto.InvokeRet")
+	proto.RegisterMapType((map[string]string)(nil), "srkproto.InvokeRet.MetadataEntry")
 	proto.RegisterType((*RemoveArg)(nil), "srkproto.RemoveArg")
 	proto.RegisterType((*ByteTransfer)(nil), "srkproto.ByteTransfer")
 	proto.RegisterType((*PackageRet)(nil), "srkproto.PackageRet")
@@ -339,24 +399,34 @@ func init() {
 }
 
 var fileDescriptor_bed494ef91531b9d = []byte{
-	// 271 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x90, 0x41, 0x4b, 0x3b, 0x31,
-	0x10, 0xc5, 0xff, 0xf9, 0xa3, 0xad, 0x1d, 0x17, 0x85, 0xb1, 0x48, 0xd9, 0x8b, 0x4b, 0xf0, 0xb0,
-	0xa7, 0x1e, 0xac, 0xe0, 0xc1, 0x93, 0x3d, 0x08, 0xbd, 0x49, 0xf4, 0x0b, 0xc4, 0x75, 0xba, 0x96,
-	0x6d, 0x13, 0xc9, 0xa6, 0x0b, 0xfd, 0xdc, 0x7e, 0x01, 0x49, 0x36, 0xbb, 0x0d, 0x2c, 0xbd, 0x84,
-	0x99, 0xc7, 0xfb, 0xe5, 0x31, 0x0f, 0xae, 0x6a, 0x53, 0xfd, 0x18, 0x6d, 0xf5, 0xdc, 0xbf, 0x78,
-	0xd1, 0xed, 0x3c, 0x03, 0x58, 0xa9, 0xda, 0xca, 0xed, 0xf6, 0xc5, 0x94, 0x88, 0x70, 0xa6, 0xe4,
-	0x8e, 0x66, 0x2c, 0x63, 0xf9, 0x44, 0xf8, 0x99, 0x2f, 0x60, 0xb2, 0x52, 0x8d, 0xae, 0xe8, 0x84,
-	0xc1, 0x69, 0x6b, 0x69, 0xca, 0xd9, 0xff, 0x8c, 0xe5, 0x89, 0xf0, 0x33, 0xbf, 0xeb, 0x20, 0x41,
-	0xd6, 0x19, 0x96, 0xfa, 0xeb, 0xe0, 0xa1, 0x44, 0xf8, 0xd9, 0x19, 0x04, 0xed, 0x74, 0x73, 0xea,
-	0x57, 0x7e, 0x0f, 0xc9, 0xf2, 0x60, 0xe9, 0xc3, 0x48, 0x55, 0xaf, 0xc9, 0xe0, 0x14, 0xce, 0x8b,
-	0xef, 0xbd, 0xaa, 0xc2, 0x2f, 0xed, 0xc2, 0x13, 0x80, 0x37, 0x59, 0x54, 0xb2, 0x74, 0x41, 0x6e,
-	0x0b, 0xc7, 0xb8, 0xed, 0xb2, 0x8b, 0x10, 0x64, 0x1f, 0x7e, 0x19, 0x5c, 0xbf, 0xee, 0x55, 0x61,
-	0x37, 0x5a, 0xbd, 0x93, 0x69, 0x36, 0x05, 0xe1, 0x33, 0x8c, 0x03, 0x8c, 0xb7, 0xf3, 0xbe, 0xa1,
-	0x38, 0x35, 0x9d, 0x1e, 0xf5, 0x28, 0xe7, 0x5f, 0xce, 0xf0, 0x09, 0xc6, 0x21, 0x0b, 0x23, 0xd3,
-	0xb1, 0xcb, 0x74, 0xa8, 0x7a, 0x14, 0x1f, 0x61, 0xd4, 0x56, 0x83, 0x37, 0xb1, 0x23, 0x34, 0x9c,
-	0x0e, 0xc4, 0x9e, 0x6a, 0x8f, 0x89, 0xa9, 0xbe, 0xc1, 0x74, 0x20, 0x7a, 0xea, 0x73, 0xe4, 0xa5,
-	0xc5, 0x5f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x2a, 0x23, 0xf3, 0x19, 0x00, 0x02, 0x00, 0x00,
+	// 428 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x92, 0xcf, 0x6a, 0xdb, 0x40,
+	0x10, 0xc6, 0x2b, 0x3b, 0xfe, 0xa3, 0xb1, 0x9c, 0x94, 0x8d, 0x09, 0xc2, 0x50, 0xaa, 0x88, 0xb6,
+	0xe8, 0xe4, 0x43, 0x52, 0x68, 0x69, 0xe8, 0xa1, 0x81, 0x14, 0x72, 0x28, 0x94, 0x6d, 0xef, 0x66,
+	0xa3, 0x8c, 0x5d, 0x21, 0x6b, 0xb7, 0xac, 0xc6, 0x06, 0xbd, 0x5f, 0xdf, 0xa8, 0x2f, 0x50, 0x76,
+	0xf4, 0x27, 0x6a, 0xd3, 0x5c, 0xc4, 0xcc, 0xa7, 0xef, 0xa7, 0xd9, 0xfd, 0x46, 0x70, 0x5c, 0xda,
+	0xfc, 0xa7, 0x35, 0x64, 0x56, 0xfc, 0x14, 0xd3, 0xb6, 0x8f, 0x23, 0x80, 0x5b, 0x5d, 0x92, 0xda,
+	0xed, 0x3e, 0xd9, 0xad, 0x10, 0x70, 0xa4, 0x55, 0x81, 0xa1, 0x17, 0x79, 0x89, 0x2f, 0xb9, 0x8e,
+	0x2f, 0xc1, 0xbf, 0xd5, 0x07, 0x93, 0xe3, 0x13, 0x06, 0xa7, 0x6d, 0x94, 0xdd, 0x86, 0x83, 0xc8,
+	0x4b, 0x02, 0xc9, 0x75, 0xfc, 0x6b, 0xd0, 0x52, 0x12, 0xc9, 0x39, 0xae, 0xcd, 0x7d, 0xc5, 0x54,
+	0x20, 0xb9, 0x16, 0x67, 0x30, 0x2e, 0x49, 0xd1, 0xbe, 0x64, 0x6e, 0x24, 0x9b, 0x4e, 0xbc, 0x86,
+	0xe3, 0xcd, 0x5e, 0xa7, 0x94, 0x19, 0xbd, 0x46, 0x6b, 0x8d, 0x0d, 0x87, 0x91, 0x97, 0x4c, 0xe5,
+	0xbc, 0x55, 0x6f, 0x9c, 0x28, 0x3e, 0xc2, 0xb4, 0x40, 0x52, 0xf7, 0x8a, 0x54, 0x78, 0x14, 0x0d,
+	0x93, 0xd9, 0xc5, 0xf9, 0xaa, 0xbb, 0x64, 0x37, 0x79, 0xf5, 0xa5, 0xf1, 0xdc, 0x68, 0xb2, 0x95,
+	0xec, 0x10, 0x71, 0x0e, 0x41, 0x6a, 0xb4, 0xc6, 0x94, 0xd6, 0x94, 0x15, 0x18, 0x8e, 0x22, 0x2f,
+	0x19, 0xca, 0x59, 0xa3, 0x7d, 0xcf, 0x0a, 0x14, 0x6f, 0xe0, 0x64, 0x93, 0xd9, 0x92, 0xd6, 0x77,
+	0x15, 0x61, 0xed, 0x1a, 0xb3, 0x6b, 0xce, 0xf2, 0x75, 0x45, 0xc8, 0xbe, 0x17, 0x00, 0x64, 0x48,
+	0xed, 0x6a, 0xcb, 0x84, 0x2d, 0x3e, 0x2b, 0xee, 0xf5, 0xf2, 0x0a, 0xe6, 0x7f, 0x1d, 0x42, 0x3c,
+	0x87, 0x61, 0x8e, 0x55, 0x93, 0xa0, 0x2b, 0xc5, 0x02, 0x46, 0x07, 0xb5, 0xdb, 0x23, 0x27, 0xe1,
+	0xcb, 0xba, 0xf9, 0x30, 0x78, 0xef, 0xc5, 0x2f, 0xc1, 0x97, 0x58, 0x98, 0xc3, 0x53, 0xd9, 0xc7,
+	0xaf, 0x20, 0xe0, 0x83, 0x58, 0xa5, 0xcb, 0x0d, 0x5a, 0xf7, 0xa9, 0xf4, 0xc7, 0x5e, 0xe7, 0x4d,
+	0xd4, 0x75, 0x13, 0x07, 0x00, 0x5f, 0x55, 0x9a, 0xab, 0xad, 0xcb, 0x24, 0x0e, 0xba, 0x95, 0xbb,
+	0x6e, 0xd6, 0x8e, 0x90, 0x48, 0x17, 0xbf, 0x3d, 0x38, 0xf9, 0xdc, 0xe4, 0xfc, 0x0d, 0xed, 0x21,
+	0x4b, 0x51, 0x5c, 0xc1, 0xa4, 0x81, 0xc5, 0xd9, 0x43, 0xc4, 0xfd, 0xa9, 0xcb, 0xc5, 0x83, 0xde,
+	0x9b, 0xf3, 0x2c, 0xf1, 0xc4, 0x3b, 0x98, 0x34, 0xb3, 0xc4, 0xa2, 0xbf, 0x9f, 0xf6, 0x8f, 0x5b,
+	0x3e, 0x56, 0x19, 0x15, 0x6f, 0x61, 0x5c, 0x6f, 0x51, 0x9c, 0xfe, 0xbb, 0x57, 0x87, 0x9d, 0xfe,
+	0x67, 0xd9, 0x35, 0x55, 0x5f, 0xa6, 0x4f, 0x75, 0x09, 0x2e, 0x1f, 0x89, 0x4c, 0xdd, 0x8d, 0x59,
+	0xba, 0xfc, 0x33, 0x00, 0xe1, 0x57, 0xc9, 0xa2, 0x26, 0x03, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.